@@ -0,0 +1,372 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// Lint finds likely mistakes in a parsed program, which runs nonetheless:
+//
+//	unused              a name a function assigns but never reads, nor calls
+//	                    anything that may read it
+//	unread-assignment   a value assigned, then replaced before it is read
+//	unreachable         a statement after a return, break, or continue
+//	assign-in-condition x = y && { ... }, where == was likely meant
+//	shadow              a function assigning a name of an enclosing scope,
+//	                    which makes a new name rather than changing that one
+//	empty-block         {} before the last statement of a block
+//
+// The unreachable statements and empty blocks are dropped by the compiler,
+// see compile.Prune.
+//
+// As scoping is dynamic, any function called may read the names of its
+// callers, so a call counts as a read of every name.
+//
+// Shadowing is reported as diag.Info, and the others as diag.Warning. Names
+// starting with _ are not reported as unused. The diagnostics are sorted by
+// position.
+func Lint(node parser.Node) diag.List {
+
+	l := &linter{}
+	top := newLintScope(nil, nil)
+	top.collect(node)
+	l.block(top, node)
+
+	sort.SliceStable(l.list, func(i, j int) bool {
+		a, b := l.list[i], l.list[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return l.list
+}
+
+type linter struct {
+	list diag.List
+}
+
+func (l *linter) report(node parser.Node, sev diag.Severity, code diag.Code, format string, args ...interface{}) {
+	d := node.Item.Diagnose(code, fmt.Errorf(format, args...))
+	d.Severity = sev
+	l.list = append(l.list, d)
+}
+
+// lintScope is the names of the program, or of a function.
+type lintScope struct {
+	parent   *lintScope
+	params   map[string]bool
+	assigned map[string]parser.Node // the first assignment of each name
+	order    []string
+	read     map[string]bool
+	calls    bool // whether the scope calls a function, which may read any name
+}
+
+func newLintScope(parent *lintScope, params map[string]bool) *lintScope {
+	return &lintScope{
+		parent:   parent,
+		params:   params,
+		assigned: make(map[string]parser.Node),
+		read:     make(map[string]bool),
+	}
+}
+
+// collect records the names assigned in a scope, outside of the functions it
+// defines, before the scope is checked, so that a function defined before a
+// name is assigned still sees it.
+func (s *lintScope) collect(node parser.Node) {
+
+	if node.Type() == lex.Function {
+		return
+	}
+
+	if name, ok := assignedName(node); ok {
+		if _, seen := s.assigned[name]; !seen {
+			s.assigned[name] = node.Children[0]
+			s.order = append(s.order, name)
+		}
+	}
+
+	for _, c := range node.Children {
+		s.collect(c)
+	}
+}
+
+// outer checks if a name is assigned, or a parameter, in an enclosing scope.
+func (s *lintScope) outer(name string) bool {
+	for o := s.parent; o != nil; o = o.parent {
+		if _, ok := o.assigned[name]; ok || o.params[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// markRead records a read of a name in the scope, and those enclosing it,
+// since a function may read the names of its callers.
+func (s *lintScope) markRead(name string) {
+	for o := s; o != nil; o = o.parent {
+		o.read[name] = true
+	}
+}
+
+// markCall records a call in the scope, and those enclosing it.
+func (s *lintScope) markCall() {
+	for o := s; o != nil; o = o.parent {
+		o.calls = true
+	}
+}
+
+// assignedName returns the name an assignment assigns.
+func assignedName(node parser.Node) (string, bool) {
+	if node.Type() != lex.Assign || len(node.Children) != 2 || node.Children[0].Type() != lex.Ident {
+		return "", false
+	}
+	return node.Children[0].Item.Value, true
+}
+
+// block checks the statements of a block.
+func (l *linter) block(s *lintScope, node parser.Node) {
+
+	for i, stmt := range node.Children {
+
+		if name, ok := assignedName(stmt); ok {
+			l.unread(name, stmt, node.Children[i+1:])
+		}
+
+		l.visit(s, stmt)
+	}
+
+	// report what the compiler drops, and only the first unreachable
+	// statement.
+	_, pruned := compile.Prune(node.Children)
+	if len(pruned.Unreachable) > 0 {
+		l.report(leftmost(pruned.Unreachable[0]), diag.Warning, diag.Unreachable, "unreachable code")
+	}
+	for _, empty := range pruned.Empty {
+		l.report(empty, diag.Warning, diag.EmptyBlock, "empty block has no effect")
+	}
+}
+
+// unread reports an assignment whose value is replaced by a later statement
+// of the same block before it is read.
+func (l *linter) unread(name string, assign parser.Node, rest []parser.Node) {
+
+	for _, stmt := range rest {
+		if reads(stmt, name) || calls(stmt) {
+			return
+		}
+
+		if next, ok := assignedName(stmt); ok && next == name {
+			l.report(assign.Children[0], diag.Warning, diag.UnreadAssignment,
+				"value assigned to %s is replaced before it is read", name)
+			return
+		}
+
+		switch stmt.Type() {
+		case lex.Return, lex.Break, lex.Continue:
+			return
+		}
+	}
+}
+
+// reads checks if a node reads a name.
+func reads(node parser.Node, name string) bool {
+
+	found := false
+	eachRead(node, func(ident parser.Node) {
+		if ident.Item.Value == name {
+			found = true
+		}
+	})
+
+	return found
+}
+
+// calls checks if a node calls a function, other than in the functions it
+// defines.
+func calls(node parser.Node) bool {
+
+	switch node.Type() {
+	case lex.FuncApply:
+		return true
+	case lex.Function:
+		return false
+	}
+
+	for _, c := range node.Children {
+		if calls(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eachRead calls f for each identifier a node reads, e.g. not the name an
+// assignment assigns, or the member name of m.name.
+func eachRead(node parser.Node, f func(ident parser.Node)) {
+
+	switch node.Type() {
+	case lex.Ident:
+		f(node)
+		return
+	case lex.Assign:
+		if _, ok := assignedName(node); ok {
+			eachRead(node.Children[1], f)
+			return
+		}
+	case lex.Dot, lex.Is:
+		if len(node.Children) > 0 {
+			eachRead(node.Children[0], f)
+		}
+		return
+	case lex.Function:
+		// skip the parameters, and the return type annotation.
+		if len(node.Children) > 1 {
+			eachRead(node.Children[1], f)
+		}
+		return
+	}
+
+	for _, c := range node.Children {
+		eachRead(c, f)
+	}
+}
+
+// visit checks a node, within a scope.
+func (l *linter) visit(s *lintScope, node parser.Node) {
+
+	switch node.Type() {
+	case lex.Ident:
+		s.markRead(node.Item.Value)
+		return
+	case lex.Function:
+		l.function(s, node)
+		return
+	case lex.FuncApply:
+		s.markCall()
+	case lex.Dot, lex.Is:
+		if len(node.Children) > 0 {
+			l.visit(s, node.Children[0])
+		}
+		return
+	case lex.LeftBrace:
+		if !isMapLiteral(node) {
+			l.block(s, node)
+			return
+		}
+	case lex.Assign:
+		l.assign(s, node)
+		return
+	}
+
+	for _, c := range node.Children {
+		l.visit(s, c)
+	}
+}
+
+// assign checks an assignment.
+func (l *linter) assign(s *lintScope, node parser.Node) {
+
+	if len(node.Children) != 2 {
+		return
+	}
+
+	lhs, rhs := node.Children[0], node.Children[1]
+
+	if lhs.Type() == lex.Until {
+		l.report(node, diag.Warning, diag.AssignInCondition, "= in the condition of until, did you mean ==?")
+	}
+
+	if (rhs.Type() == lex.And || rhs.Type() == lex.Or) && controlsFlow(rhs) {
+		l.report(node, diag.Warning, diag.AssignInCondition,
+			"assigning the value of %s, did you mean ==?", rhs.Item.Value)
+	}
+
+	if name, ok := assignedName(node); ok && s.parent != nil && !s.params[name] && s.outer(name) {
+		l.report(lhs, diag.Info, diag.Shadow,
+			"assignment makes a new %s in this fn, hiding the %s of an enclosing scope", name, name)
+	}
+
+	if lhs.Type() != lex.Ident {
+		l.visit(s, lhs)
+	}
+	l.visit(s, rhs)
+}
+
+// controlsFlow checks if the operands of && or || run a block, or return,
+// rather than produce a value, e.g. x == y && { ... }.
+func controlsFlow(node parser.Node) bool {
+
+	for _, c := range node.Children {
+		switch c.Type() {
+		case lex.LeftBrace:
+			if !isMapLiteral(c) {
+				return true
+			}
+		case lex.Return, lex.Break, lex.Continue:
+			return true
+		case lex.And, lex.Or:
+			if controlsFlow(c) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isMapLiteral checks if braces are a map, e.g. {"a": 1}, rather than a block.
+func isMapLiteral(node parser.Node) bool {
+	return len(node.Children) > 0 && node.Children[0].Type() == lex.Colon
+}
+
+// function checks a function literal, in a scope of its own.
+func (l *linter) function(s *lintScope, node parser.Node) {
+
+	if len(node.Children) < 2 {
+		return
+	}
+
+	params := make(map[string]bool)
+	for _, p := range node.Children[0].Children {
+		if p.Type() == lex.Colon && len(p.Children) == 2 {
+			p = p.Children[0]
+		}
+		params[p.Item.Value] = true
+	}
+
+	inner := newLintScope(s, params)
+	inner.collect(node.Children[1])
+	l.visit(inner, node.Children[1])
+
+	if inner.calls {
+		return
+	}
+
+	for _, name := range inner.order {
+		if !inner.read[name] && !strings.HasPrefix(name, "_") {
+			l.report(inner.assigned[name], diag.Warning, diag.Unused, "%s is assigned but never read", name)
+		}
+	}
+}
+
+// leftmost returns the node of an expression that starts it, e.g. x of x + 1.
+func leftmost(node parser.Node) parser.Node {
+
+	for _, c := range node.Children {
+		if c.Item.Line < node.Item.Line || c.Item.Line == node.Item.Line && c.Item.Column < node.Item.Column {
+			return leftmost(c)
+		}
+	}
+
+	return node
+}
@@ -0,0 +1,51 @@
+package check
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pdk/meh/parser"
+)
+
+func TestLint(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		want []string
+	}{
+		{"f = fn(a) {\n    b = a * 2\n    return b\n}\nf(1)\n", nil},
+		{"f = fn(a) {\n    b = a * 2\n    return a\n}\n", []string{"2:5 warning unused"}},
+		{"f = fn() {\n    _b = 2\n    return 1\n}\n", nil},
+		{"x = 1\nx = 2\nx\n", []string{"1:1 warning unread-assignment"}},
+		{"x = 1\nx = x + 1\nx\n", nil},
+		{"f = fn() {\n    return 1\n    x = 2\n}\n", []string{"3:5 warning unreachable", "3:5 warning unused"}},
+		{"do {\n    break\n    x = 1\n    y = 2\n} until true\n", []string{"3:5 warning unreachable"}},
+		{"a = 1\nb = 2\nx = a == b && { a }\n", []string{"3:3 warning assign-in-condition"}},
+		{"a = 1\nb = 2\nx = a == b && a\n", nil},
+		{"do { a = 1 } until a = 1\n", []string{"1:22 warning assign-in-condition"}},
+		{"n = 1\nf = fn() {\n    n = 2\n    n\n}\n", []string{"3:5 info shadow"}},
+		{"n = 1\nf = fn(n) {\n    n = 2\n    n\n}\n", nil},
+		{"x = 1\n{}\nx\n", []string{"2:1 warning empty-block"}},
+		{"get_y = fn() { return y }\nwith_y = fn() { y = 7; return get_y() }\nwith_y()\n", nil},
+		{"show = fn() { print(x) }\nuse = fn() { x = 5; show() }\nuse()\n", nil},
+		{"show = fn() { print(x) }\nx = 1\nshow()\nx = 2\nshow()\n", nil},
+		{"f = fn() {\n    y = 7\n    g = fn() { y }\n    return 1\n}\n", []string{"3:5 warning unused"}},
+		{"x = 1\ny = x + 1\nx = 2\nx\n", nil},
+		{"x = 1\ny = 2\nx = 2\nx + y\n", []string{"1:1 warning unread-assignment"}},
+	} {
+		node, errs := parser.NewFromString("lint", c.src).Parse()
+		if len(errs) > 0 {
+			t.Fatalf("%q: %v", c.src, errs)
+		}
+
+		var got []string
+		for _, d := range Lint(node) {
+			got = append(got, fmt.Sprintf("%d:%d %s %s", d.Line, d.Column, d.Severity, d.Code))
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: lint %q, want %q", c.src, got, c.want)
+		}
+	}
+}
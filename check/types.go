@@ -0,0 +1,336 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// Types checks a parsed program against its type annotations, e.g.
+// `fn(a: int, b: string): int { ... }`. Annotations are not enforced at
+// runtime; this pass catches the obvious mismatches before execution. Types
+// that cannot be determined statically are not checked.
+func Types(node parser.Node) []error {
+	c := &checker{}
+	c.check(newScope(nil, nil), node)
+	return c.errs
+}
+
+// unknown is the type of an expression whose type cannot be determined.
+const unknown = ""
+
+// signature is the annotated type of a function.
+type signature struct {
+	params  []string
+	returns string
+}
+
+type scope struct {
+	parent *scope
+	fn     *signature // the function being checked, if any
+	types  map[string]string
+	funcs  map[string]*signature
+}
+
+func newScope(parent *scope, fn *signature) *scope {
+	return &scope{
+		parent: parent,
+		fn:     fn,
+		types:  make(map[string]string),
+		funcs:  make(map[string]*signature),
+	}
+}
+
+func (s *scope) lookup(name string) (string, *signature) {
+	if s == nil {
+		return unknown, nil
+	}
+
+	t, ok := s.types[name]
+	if !ok {
+		return s.parent.lookup(name)
+	}
+
+	return t, s.funcs[name]
+}
+
+// bind records the type of a name. A name assigned values of different types
+// is thereafter unknown.
+func (s *scope) bind(name, t string) {
+	if prior, ok := s.types[name]; ok && prior != t {
+		t = unknown
+	}
+	s.types[name] = t
+}
+
+type checker struct {
+	errs []error
+}
+
+func (c *checker) errorf(node parser.Node, format string, args ...interface{}) {
+	c.errs = append(c.errs, node.Error(fmt.Errorf(format, args...)))
+}
+
+// check checks a node, and returns the type of the value it produces.
+func (c *checker) check(s *scope, node parser.Node) string {
+
+	switch node.Type() {
+	case lex.Number:
+		if strings.Contains(node.Item.Value, ".") {
+			return "float"
+		}
+		return "int"
+	case lex.DoubleQuoteString, lex.SingleQuoteString, lex.BacktickString:
+		return "string"
+	case lex.Regex:
+		return "regex"
+	case lex.True, lex.False:
+		return "bool"
+	case lex.Nil:
+		return "nil"
+	case lex.Ident:
+		t, _ := s.lookup(node.Item.Value)
+		return t
+	case lex.Function:
+		c.function(s, node)
+		return "fn"
+	case lex.FuncApply:
+		return c.funcApply(s, node)
+	case lex.Assign:
+		return c.assign(s, node)
+	case lex.Return:
+		c.returns(s, node)
+		return unknown
+	case lex.Is:
+		c.check(s, node.Children[0])
+		c.typeName(node.Children[1])
+		return "bool"
+	case lex.Plus, lex.Minus, lex.Mult, lex.Div, lex.Modulo,
+		lex.Less, lex.LessOrEqual, lex.Greater, lex.GreaterOrEqual,
+		lex.Equal, lex.NotEqual:
+		return c.binaryOp(s, node)
+	case lex.And, lex.Or:
+		left := c.check(s, node.Children[0])
+		right := c.check(s, node.Children[1])
+		if left == right {
+			return left
+		}
+		return unknown
+	case lex.LeftBrace:
+		for _, n := range node.Children {
+			c.check(s, n)
+		}
+		return "tuple"
+	}
+
+	for _, n := range node.Children {
+		c.check(s, n)
+	}
+
+	return unknown
+}
+
+// typeName checks that an annotation names a known type.
+func (c *checker) typeName(node parser.Node) string {
+
+	name := node.Item.Value
+	if name != "any" && !compile.IsTypeName(name) {
+		c.errorf(node, "unknown type name %q", name)
+		return unknown
+	}
+
+	return name
+}
+
+// signatureOf returns the annotated signature of a function literal.
+func (c *checker) signatureOf(node parser.Node) *signature {
+
+	sig := &signature{}
+
+	if len(node.Children) == 0 {
+		return sig
+	}
+
+	for _, p := range node.Children[0].Children {
+		t := unknown
+		if p.Type().Match(lex.Colon) && len(p.Children) == 2 {
+			t = c.typeName(p.Children[1])
+		}
+		sig.params = append(sig.params, t)
+	}
+
+	if len(node.Children) == 3 {
+		sig.returns = c.typeName(node.Children[2])
+	}
+
+	return sig
+}
+
+func (c *checker) function(s *scope, node parser.Node) *signature {
+
+	sig := c.signatureOf(node)
+	c.body(s, node, sig)
+
+	return sig
+}
+
+// body checks the body of a function literal with a signature.
+func (c *checker) body(s *scope, node parser.Node, sig *signature) {
+
+	if len(node.Children) < 2 {
+		return
+	}
+
+	inner := newScope(s, sig)
+	for i, p := range node.Children[0].Children {
+		if p.Type().Match(lex.Colon) && len(p.Children) == 2 {
+			p = p.Children[0]
+		}
+		inner.bind(p.Item.Value, sig.params[i])
+	}
+
+	c.check(inner, node.Children[1])
+}
+
+func (c *checker) funcApply(s *scope, node parser.Node) string {
+
+	callee := node.Children[0]
+
+	var sig *signature
+	switch callee.Type() {
+	case lex.Ident:
+		_, sig = s.lookup(callee.Item.Value)
+	case lex.Function:
+		sig = c.function(s, callee)
+	default:
+		c.check(s, callee)
+	}
+
+	args := node.Children[1].Children
+	argTypes := []string{}
+	for _, a := range args {
+		argTypes = append(argTypes, c.check(s, a))
+	}
+
+	if sig == nil {
+		return unknown
+	}
+
+	if len(args) != len(sig.params) {
+		c.errorf(node, "function requires %d arguments, received %d",
+			len(sig.params), len(args))
+		return sig.returns
+	}
+
+	for i, t := range argTypes {
+		if !assignable(sig.params[i], t) {
+			c.errorf(args[i], "argument %d requires %s, received %s",
+				i+1, sig.params[i], t)
+		}
+	}
+
+	return sig.returns
+}
+
+func (c *checker) assign(s *scope, node parser.Node) string {
+
+	lhs, rhs := node.Children[0], node.Children[1]
+	if !lhs.Type().Match(lex.Ident) {
+		return c.check(s, rhs)
+	}
+	name := lhs.Item.Value
+
+	if rhs.Type().Match(lex.Function) {
+		// bind before checking the body, so recursive calls are checked.
+		sig := c.signatureOf(rhs)
+		s.bind(name, "fn")
+		s.funcs[name] = sig
+		c.body(s, rhs, sig)
+		return "fn"
+	}
+
+	t := c.check(s, rhs)
+	s.bind(name, t)
+	delete(s.funcs, name)
+
+	return t
+}
+
+func (c *checker) returns(s *scope, node parser.Node) {
+
+	t := "nil"
+	if len(node.Children) > 0 {
+		t = c.check(s, node.Children[0])
+	}
+
+	for s != nil && s.fn == nil {
+		s = s.parent
+	}
+
+	if s != nil && !assignable(s.fn.returns, t) {
+		c.errorf(node, "function returns %s, found return of %s", s.fn.returns, t)
+	}
+}
+
+func (c *checker) binaryOp(s *scope, node parser.Node) string {
+
+	left := c.check(s, node.Children[0])
+	right := c.check(s, node.Children[1])
+
+	numeric := isNumeric(left) && isNumeric(right)
+	strs := left == "string" && right == "string"
+
+	var result string
+	var ok bool
+
+	switch node.Type() {
+	case lex.Plus:
+		switch {
+		case left == "int" && right == "int":
+			result, ok = "int", true
+		case numeric:
+			result, ok = "float", true
+		case strs:
+			result, ok = "string", true
+		}
+	case lex.Minus, lex.Mult, lex.Div:
+		switch {
+		case left == "int" && right == "int":
+			result, ok = "int", true
+		case numeric:
+			result, ok = "float", true
+		}
+	case lex.Modulo:
+		result, ok = "int", left == "int" && right == "int"
+	default:
+		result, ok = "bool", numeric || strs
+	}
+
+	if left == unknown || right == unknown {
+		if node.Type().Match(lex.Plus, lex.Minus, lex.Mult, lex.Div, lex.Modulo) {
+			return unknown
+		}
+		return result
+	}
+
+	if !ok {
+		c.errorf(node, "cannot apply %s to %s and %s", node.Item.Value, left, right)
+	}
+
+	return result
+}
+
+func isNumeric(t string) bool {
+	return t == "int" || t == "float"
+}
+
+// assignable checks if a value of type actual satisfies the annotation
+// declared.
+func assignable(declared, actual string) bool {
+	return declared == unknown || actual == unknown ||
+		declared == "any" || declared == actual ||
+		(declared == "float" && actual == "int")
+}
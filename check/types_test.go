@@ -0,0 +1,54 @@
+package check
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pdk/meh/parser"
+)
+
+func TestTypes(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		errs []string
+	}{
+		{`f = fn(a: int, b: string): int { return a }; f(1, "x")`, nil},
+		{`f = fn(a: float) { a }; f(1)`, nil},
+		{`f = fn(a: any) { a }; f("x"); f(1)`, nil},
+		{`f = fn(a: int) { a }; f(x)`, nil},
+		{`f = fn(a: int) { a }; f("x")`, []string{"argument 1 requires int, received string"}},
+		{`f = fn(a: int, b: string) { a }; f(1)`, []string{"function requires 2 arguments, received 1"}},
+		{`fn(a: string) { a }(2.5)`, []string{"argument 1 requires string, received float"}},
+		{`f = fn(): int { return "x" }`, []string{"function returns int, found return of string"}},
+		{`f = fn(): string { return }`, []string{"function returns string, found return of nil"}},
+		{`f = fn(a: widget) { a }`, []string{`unknown type name "widget"`}},
+		{`x = 1 is widget`, []string{`unknown type name "widget"`}},
+		{`x = 1 + "a"`, []string{"cannot apply + to int and string"}},
+		{`x = "a" - "b"`, []string{"cannot apply - to string and string"}},
+		{`x = 1.5 % 2`, []string{"cannot apply % to float and int"}},
+		{`x = 1 < "a"`, []string{"cannot apply < to int and string"}},
+		{`x = 1; x = "a"; x + 1`, nil},
+		{`n = 2 * 3; f = fn(s: string) { s }; f(n)`, []string{"argument 1 requires string, received int"}},
+		{`f = fn(n: int): int { return f(n - 1) }; f("x")`, []string{"argument 1 requires int, received string"}},
+		{`f = fn(n: int): int { n <= 0 && return 0; return f("x") }`, []string{"argument 1 requires int, received string"}},
+		{`f = fn(n: int): string { return f(n - 1) + 1 }`, []string{"cannot apply + to string and int"}},
+		{`f = fn(a: int, b: int) { f(a) }`, []string{"function requires 2 arguments, received 1"}},
+	} {
+		node, perrs := parser.NewFromString("types", c.src).Parse()
+		if len(perrs) > 0 {
+			t.Fatalf("%s: %v", c.src, perrs)
+		}
+
+		errs := Types(node)
+		if len(errs) != len(c.errs) {
+			t.Errorf("%s: errors %v, want %q", c.src, errs, c.errs)
+			continue
+		}
+		for i, err := range errs {
+			if !strings.Contains(err.Error(), c.errs[i]) {
+				t.Errorf("%s: error %v, want %q", c.src, err, c.errs[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pdk/meh/compile"
+)
+
+// runBenchmarks runs the benchmarks of the *_test.meh files in directories,
+// searched recursively, or named, by default those under the current
+// directory:
+//
+//	meh bench [-run regexp] [-benchtime d] [-benchmem] [-o file] [-baseline file] [-threshold pct] [dir|file ...]
+//
+// Each file is run, and then each function it assigns to a name starting
+// with bench_ is called repeatedly, as go test -bench does: the number of
+// calls grows until they take at least the bench time, and the average time
+// of a call is reported. With -benchmem, the average memory a call
+// allocates, and the number of allocations, are reported too.
+//
+// The results can be saved with -o, and compared with those saved before
+// with -baseline: a benchmark that takes longer, or allocates more often,
+// than its baseline, by more than the threshold, is a regression, and fails
+// the run.
+func runBenchmarks(args []string) error {
+
+	fs := flag.NewFlagSet("meh bench", flag.ContinueOnError)
+	opts := benchFlags(fs, false)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.init(); err != nil {
+		return fmt.Errorf("bench: %v", err)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findFiles("bench", paths, "_test.meh")
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("bench: no *_test.meh files in %s", strings.Join(paths, " "))
+	}
+
+	failed := false
+	for _, name := range files {
+		if !benchFile(name, opts) {
+			failed = true
+		}
+	}
+
+	return opts.finish("bench", failed)
+}
+
+// benchFile runs the benchmarks of a file, reports the results, and returns
+// true if none failed.
+func benchFile(name string, opts *benchOptions) bool {
+
+	ctx, benches, err := loadTests(name, "bench_", nil)
+	if err != nil {
+		fmt.Printf("FAIL\t%s\n\t%s\n", name, indent(err))
+		return false
+	}
+
+	passed := true
+	for _, bench := range benches {
+		if !opts.filter.MatchString(bench.Item.Value) {
+			continue
+		}
+
+		bench := bench
+		r, err := runBenchmark(func() error {
+			return runTest(ctx, bench)
+		}, opts.benchTime)
+		if err != nil {
+			passed = false
+			fmt.Printf("--- FAIL: %s\n\t%s\n", bench.Item.Value, indent(err))
+			continue
+		}
+
+		opts.report(bench.Item.Value, r)
+	}
+
+	if !passed {
+		fmt.Printf("FAIL\t%s\n", name)
+		return false
+	}
+
+	fmt.Printf("ok\t%s\n", name)
+	return true
+}
+
+// benchOptions are the settings of a run of benchmarks, and the results it
+// saves or compares with a baseline.
+type benchOptions struct {
+	run       string
+	benchTime time.Duration
+	benchMem  bool
+	out       string
+	baseline  string
+	threshold float64
+
+	filter    *regexp.Regexp
+	base      map[string]baseline
+	saved     []string
+	regressed []string
+}
+
+// benchFlags defines the flags of a run of benchmarks.
+func benchFlags(fs *flag.FlagSet, benchMem bool) *benchOptions {
+
+	opts := &benchOptions{}
+	fs.StringVar(&opts.run, "run", "", "run only the benchmarks whose names match this regexp")
+	fs.DurationVar(&opts.benchTime, "benchtime", time.Second, "run each benchmark for at least this long")
+	fs.BoolVar(&opts.benchMem, "benchmem", benchMem, "report the memory allocated by each call")
+	fs.StringVar(&opts.out, "o", "", "save the results to this file, to be a later baseline")
+	fs.StringVar(&opts.baseline, "baseline", "", "compare the results with those saved in this file")
+	fs.Float64Var(&opts.threshold, "threshold", 10, "the percent by which a benchmark may be slower than its baseline")
+
+	return opts
+}
+
+// init compiles the filter, and reads the baseline, if any.
+func (opts *benchOptions) init() error {
+
+	filter, err := regexp.Compile(opts.run)
+	if err != nil {
+		return fmt.Errorf("-run: %v", err)
+	}
+	opts.filter = filter
+
+	if opts.baseline == "" {
+		return nil
+	}
+
+	opts.base, err = readBaseline(opts.baseline)
+	if err != nil {
+		return fmt.Errorf("-baseline: %v", err)
+	}
+
+	return nil
+}
+
+// report prints the result of a benchmark, as go test -bench does, with its
+// change from the baseline, if there is one, and records it.
+func (opts *benchOptions) report(name string, r benchResult) {
+
+	line := fmt.Sprintf("%s\t%10d\t%12d ns/op", name, r.n, r.nsPerOp())
+	if r.size > 0 {
+		line += fmt.Sprintf("\t%8.2f MB/s", float64(r.size)*float64(r.n)/r.took.Seconds()/1e6)
+	}
+	if opts.benchMem {
+		line += fmt.Sprintf("\t%8d B/op\t%8d allocs/op", r.bytes/uint64(r.n), r.allocsPerOp())
+	}
+	opts.saved = append(opts.saved, line)
+
+	if base, ok := opts.base[name]; ok {
+		line += "\t" + opts.compare(name, r, base)
+	}
+
+	fmt.Println(line)
+}
+
+// compare describes the change of a result from its baseline, recording a
+// regression.
+func (opts *benchOptions) compare(name string, r benchResult, base baseline) string {
+
+	delta := percent(r.nsPerOp(), base.nsPerOp)
+	change := fmt.Sprintf("%+.1f%% ns/op", delta)
+	regressed := delta > opts.threshold
+
+	if opts.benchMem && base.mem {
+		change += fmt.Sprintf(" %+d allocs/op", int64(r.allocsPerOp())-int64(base.allocsPerOp))
+		if percent(int64(r.allocsPerOp()), int64(base.allocsPerOp)) > opts.threshold {
+			regressed = true
+		}
+	}
+
+	if regressed {
+		opts.regressed = append(opts.regressed, name)
+		change += " REGRESSION"
+	}
+
+	return "(" + change + ")"
+}
+
+// finish saves the results, if asked, and returns an error if a benchmark
+// failed, or regressed.
+func (opts *benchOptions) finish(cmd string, failed bool) error {
+
+	if opts.out != "" {
+		out := strings.Join(opts.saved, "\n") + "\n"
+		if err := ioutil.WriteFile(opts.out, []byte(out), 0644); err != nil {
+			return fmt.Errorf("%s: -o: %v", cmd, err)
+		}
+	}
+
+	if len(opts.regressed) > 0 {
+		fmt.Printf("regressed from %s: %s\n", opts.baseline, strings.Join(opts.regressed, ", "))
+		failed = true
+	}
+
+	if failed {
+		fmt.Println("FAIL")
+		return compile.Exit{Code: 1}
+	}
+
+	return nil
+}
+
+// percent returns the change from old to new, in percent, counting any
+// change from zero as 100%.
+func percent(new, old int64) float64 {
+	if old == 0 {
+		if new == 0 {
+			return 0
+		}
+		return 100
+	}
+	return 100 * float64(new-old) / float64(old)
+}
+
+// baseline is a result saved with -o: the time of a call, and the number of
+// allocations, if the memory was reported.
+type baseline struct {
+	nsPerOp     int64
+	allocsPerOp uint64
+	mem         bool
+}
+
+// readBaseline reads the results saved with -o, or by go test -bench, by the
+// name of the benchmark, without the GOMAXPROCS suffix go test adds, e.g. -8.
+// Other lines, e.g. ok, are ignored, so that the output of a run can be
+// saved as well.
+func readBaseline(name string) (map[string]baseline, error) {
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	base := make(map[string]baseline)
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) < 4 || fields[3] != "ns/op" {
+			continue
+		}
+
+		ns, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fields[0], err)
+		}
+
+		b := baseline{nsPerOp: ns}
+		for i := 4; i+1 < len(fields); i += 2 {
+			if fields[i+1] == "allocs/op" {
+				b.allocsPerOp, _ = strconv.ParseUint(fields[i], 10, 64)
+				b.mem = true
+			}
+		}
+
+		base[benchName(fields[0])] = b
+	}
+
+	return base, lines.Err()
+}
+
+// benchName returns the name of a benchmark in a result, without the
+// GOMAXPROCS suffix of go test, if any.
+func benchName(name string) string {
+
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 {
+		return name
+	}
+
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return name
+	}
+
+	return name[:i]
+}
+
+// benchResult is the last round of a benchmark: the number of calls, the
+// time they took, and the memory they allocated. The size is the number of
+// bytes a call processes, if it is measured in MB/s.
+type benchResult struct {
+	n      int
+	took   time.Duration
+	allocs uint64
+	bytes  uint64
+	size   int64
+}
+
+func (r benchResult) nsPerOp() int64 {
+	return r.took.Nanoseconds() / int64(r.n)
+}
+
+func (r benchResult) allocsPerOp() uint64 {
+	return r.allocs / uint64(r.n)
+}
+
+// runBenchmark calls a benchmark function more times in each round, until a
+// round takes at least the bench time, and returns the last round.
+func runBenchmark(op func() error, benchTime time.Duration) (benchResult, error) {
+
+	n := 1
+	for {
+		r, err := benchRound(op, n)
+		if err != nil {
+			return benchResult{}, err
+		}
+
+		if r.took >= benchTime || n >= 1e9 {
+			return r, nil
+		}
+
+		n = nextRound(n, r.took, benchTime)
+	}
+}
+
+// nextRound predicts the number of calls that takes the bench time, from the
+// time the last round took, with a margin, growing by at most 100 times.
+func nextRound(n int, took, benchTime time.Duration) int {
+
+	next := 100 * n
+	if took > 0 {
+		predicted := int(int64(n) * int64(benchTime) / int64(took))
+		predicted += predicted / 5
+		if predicted < next {
+			next = predicted
+		}
+	}
+
+	if next <= n {
+		next = n + 1
+	}
+
+	return next
+}
+
+// benchRound calls a benchmark function n times.
+func benchRound(op func() error, n int) (benchResult, error) {
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := op(); err != nil {
+			return benchResult{}, err
+		}
+	}
+	took := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	return benchResult{
+		n:      n,
+		took:   took,
+		allocs: after.Mallocs - before.Mallocs,
+		bytes:  after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
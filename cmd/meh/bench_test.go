@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBaseline(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "meh-bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the output of go test -bench, and of meh perf -o.
+	name := filepath.Join(dir, "before.txt")
+	out := `goos: linux
+BenchmarkLex-8   	     100	  11866480 ns/op	  41.70 MB/s	 2513224 B/op	   60516 allocs/op
+BenchmarkCalls   	     500	   2381504 ns/op
+PASS
+`
+	if err := ioutil.WriteFile(name, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := readBaseline(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]baseline{
+		"BenchmarkLex":   {nsPerOp: 11866480, allocsPerOp: 60516, mem: true},
+		"BenchmarkCalls": {nsPerOp: 2381504},
+	}
+	if len(base) != len(want) {
+		t.Fatalf("read %v, want %v", base, want)
+	}
+	for n, w := range want {
+		if base[n] != w {
+			t.Errorf("%s: read %+v, want %+v", n, base[n], w)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdk/meh/parser"
+)
+
+// A built tool is a copy of meh with a compiled script appended, followed by
+// a trailer: the length of the script, as 8 bytes, little endian, and then
+// payloadMagic. meh checks its own executable for the trailer as it starts,
+// and if it is there runs the script instead of doing as its arguments say.
+
+// payloadMagic ends an executable with a script appended.
+const payloadMagic = "\x00meh-payload\x00\n"
+
+// trailerSize is the size of the trailer that follows an appended script.
+const trailerSize = 8 + len(payloadMagic)
+
+// runBuild builds a standalone executable from a script:
+//
+//	meh build [-o file] script.meh
+//	meh build script.meh -o file
+//
+// The executable runs the script, compiled, with its arguments as args, on
+// machines without meh. It is named after the script by default, e.g. tool
+// for tool.meh. The script runs with the default settings, e.g. not on the
+// VM.
+func runBuild(args []string) error {
+
+	fs := flag.NewFlagSet("meh build", flag.ContinueOnError)
+	outName := fs.String("o", "", "write the executable to this file (default: the script's name, without .meh)")
+
+	scripts, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if len(scripts) != 1 {
+		return fmt.Errorf("build: requires one script, received %d", len(scripts))
+	}
+
+	name := scripts[0]
+	if *outName == "" {
+		*outName = strings.TrimSuffix(filepath.Base(name), ".meh")
+		if *outName == filepath.Base(name) {
+			return fmt.Errorf("build: -o is required for a script not named *.meh")
+		}
+	}
+
+	input, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("build: %v", err)
+	}
+	defer input.Close()
+
+	parsed, err := parse(name, input)
+	if err != nil {
+		return err
+	}
+
+	if _, err := compileParsed(parsed); err != nil {
+		return err
+	}
+
+	script := bytes.Buffer{}
+	if err := parser.Encode(&script, parsed); err != nil {
+		return fmt.Errorf("build: %v", err)
+	}
+
+	meh, err := interpreter()
+	if err != nil {
+		return fmt.Errorf("build: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	out.Write(meh)
+	out.Write(script.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint64(script.Len()))
+	out.WriteString(payloadMagic)
+
+	if err := ioutil.WriteFile(*outName, out.Bytes(), 0755); err != nil {
+		return fmt.Errorf("build: %v", err)
+	}
+
+	return nil
+}
+
+// parseInterleaved parses flags given before, between, or after the other
+// arguments, e.g. `script.meh -o tool`, which fs.Parse would stop at, and
+// returns the other arguments. Arguments after "--" are not flags.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+
+	rest := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		parsed := len(args) - fs.NArg()
+		if fs.NArg() == 0 || parsed > 0 && args[parsed-1] == "--" {
+			return append(rest, fs.Args()...), nil
+		}
+
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// interpreter returns the content of the running executable.
+func interpreter() ([]byte, error) {
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(exe)
+}
+
+// embeddedScript returns the script appended to the running executable, and
+// false if it has none.
+func embeddedScript() ([]byte, bool) {
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, false
+	}
+
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil || end < int64(trailerSize) {
+		return nil, false
+	}
+
+	trailer := make([]byte, trailerSize)
+	if _, err := f.ReadAt(trailer, end-int64(trailerSize)); err != nil {
+		return nil, false
+	}
+
+	size, ok := payloadSize(trailer)
+	if !ok || size > uint64(end)-uint64(trailerSize) {
+		return nil, false
+	}
+
+	script := make([]byte, size)
+	if _, err := f.ReadAt(script, end-int64(trailerSize)-int64(size)); err != nil {
+		return nil, false
+	}
+
+	return script, true
+}
+
+// payloadSize returns the size of the script a trailer follows, and false if
+// it is not a trailer.
+func payloadSize(trailer []byte) (uint64, bool) {
+
+	if len(trailer) != trailerSize || string(trailer[8:]) != payloadMagic {
+		return 0, false
+	}
+
+	return binary.LittleEndian.Uint64(trailer[:8]), true
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterleaved(t *testing.T) {
+
+	for _, c := range []struct {
+		args []string
+		out  string
+		rest []string
+	}{
+		{[]string{"tool.meh"}, "", []string{"tool.meh"}},
+		{[]string{"-o", "tool", "tool.meh"}, "tool", []string{"tool.meh"}},
+		{[]string{"tool.meh", "-o", "tool"}, "tool", []string{"tool.meh"}},
+		{[]string{"a.meh", "-o", "tool", "b.meh"}, "tool", []string{"a.meh", "b.meh"}},
+		{[]string{"tool.meh", "--", "-o", "tool"}, "", []string{"tool.meh", "-o", "tool"}},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		out := fs.String("o", "", "")
+
+		rest, err := parseInterleaved(fs, c.args)
+		if err != nil {
+			t.Fatalf("%v: %v", c.args, err)
+		}
+		if *out != c.out || !reflect.DeepEqual(rest, c.rest) {
+			t.Errorf("%v: -o %q, rest %q, want %q, %q", c.args, *out, rest, c.out, c.rest)
+		}
+	}
+}
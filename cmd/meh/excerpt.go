@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+)
+
+// sources holds the text of the scripts parsed, by name, to show the lines
+// that errors are found on.
+var sources = struct {
+	sync.Mutex
+	text map[string]string
+}{text: make(map[string]string)}
+
+// rememberSource records the text of a script.
+func rememberSource(name, text string) {
+	sources.Lock()
+	sources.text[name] = text
+	sources.Unlock()
+}
+
+// sourceText returns the text of a script, and false if it was not parsed.
+func sourceText(name string) (string, bool) {
+	sources.Lock()
+	defer sources.Unlock()
+
+	text, ok := sources.text[name]
+	return text, ok
+}
+
+// sourceLine returns a line of a script, counting from 1, and false if the
+// script was not parsed, or is shorter.
+func sourceLine(name string, line int) (string, bool) {
+
+	text, ok := sourceText(name)
+	if !ok || line < 1 {
+		return "", false
+	}
+
+	lines := strings.Split(text, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// The ANSI escapes that color reports to a terminal.
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+	colorBold   = "\x1b[1m"
+	colorReset  = "\x1b[0m"
+)
+
+// useColor checks if reports to stderr should be colored: if it is a
+// terminal, and NO_COLOR is not set.
+func useColor() bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(os.Stderr)
+}
+
+// severityColor returns the color of a severity.
+func severityColor(s diag.Severity) string {
+	switch s {
+	case diag.Warning:
+		return colorYellow
+	case diag.Info:
+		return colorCyan
+	}
+	return colorRed
+}
+
+// colorize colors a diagnostic's line, e.g.
+//
+//	f.meh:2:3: error: ... [syntax]
+//
+// by making the position bold, and coloring the severity.
+func colorize(d diag.Diagnostic, text string) string {
+
+	sev := d.Severity.String() + ":"
+	i := strings.Index(text, sev)
+	if i < 0 {
+		return text
+	}
+
+	return colorBold + text[:i] + colorReset +
+		severityColor(d.Severity) + colorBold + sev + colorReset + text[i+len(sev):]
+}
+
+// excerpt returns the line of the script a diagnostic concerns, with carets
+// under the span it concerns, to the end of the line, e.g.
+//
+//	2 | x = 1 + "a"
+//	  |     ^^^^^^^
+//
+// or "" if the line is not known.
+func excerpt(d diag.Diagnostic, color bool) string {
+
+	line, ok := sourceLine(d.File, d.Line)
+	if !ok {
+		return ""
+	}
+
+	// keep the tabs before the column, so that the carets line up.
+	start := lex.Offset(line, d.Column)
+	pad := []rune(line[:start])
+	for i, r := range pad {
+		if r != '\t' {
+			pad[i] = ' '
+		}
+	}
+
+	end := len(line)
+	if d.EndLine == d.Line && d.EndColumn >= d.Column {
+		end = lex.Offset(line, d.EndColumn)
+		if end < len(line) {
+			_, size := utf8.DecodeRuneInString(line[end:])
+			end += size
+		}
+	}
+
+	carets := strings.Repeat("^", utf8.RuneCountInString(line[start:end]))
+	if carets == "" {
+		carets = "^"
+	}
+	if color {
+		carets = severityColor(d.Severity) + colorBold + carets + colorReset
+	}
+
+	number := fmt.Sprintf("%4d", d.Line)
+	return fmt.Sprintf("%s | %s\n%s | %s%s\n", number, line, strings.Repeat(" ", len(number)), string(pad), carets)
+}
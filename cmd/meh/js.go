@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pdk/meh/jsgen"
+)
+
+// runJS translates a script, or stdin, to JavaScript:
+//
+//	meh js [-name run] [-o file] [file]
+//
+// The JavaScript defines a function, run by default, which takes the names
+// to assign before the script runs, e.g. run({price: 2.5, qty: 4}), and
+// returns the value of its last statement. Only the builtins that do not
+// reach the host are available. See package jsgen.
+//
+// A script of asserts checks that the JavaScript agrees with the
+// interpreter, as ex/semantics.meh does:
+//
+//	meh js -o semantics.js ex/semantics.meh
+//	node -e 'require("./semantics.js").run()'
+func runJS(args []string) error {
+
+	fs := flag.NewFlagSet("meh js", flag.ContinueOnError)
+	fnName := fs.String("name", "run", "the name of the JavaScript function that runs the script")
+	outName := fs.String("o", "", "write the JavaScript to this file (default: stdout)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	name, input, err := openInput("js", fs.Args())
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	parsed, err := parse(name, input)
+	if err != nil {
+		return err
+	}
+
+	js, err := jsgen.Generate(*fnName, parsed)
+	if err != nil {
+		return err
+	}
+
+	if *outName == "" {
+		_, err = os.Stdout.WriteString(js)
+		return err
+	}
+
+	if err := ioutil.WriteFile(*outName, []byte(js), 0644); err != nil {
+		return fmt.Errorf("js: %v", err)
+	}
+
+	return nil
+}
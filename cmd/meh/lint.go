@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pdk/meh/check"
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/diag"
+)
+
+// runLint reports likely mistakes in the *.meh files in directories,
+// searched recursively, or named, by default those under the current
+// directory, without running them:
+//
+//	meh lint [--json-errors] [dir|file ...]
+//
+// See check.Lint for what is reported. The exit status is 1 if a script
+// cannot be parsed, or there were any warnings.
+func runLint(args []string) error {
+
+	fs := flag.NewFlagSet("meh lint", flag.ContinueOnError)
+	fs.BoolVar(jsonErrors, "json-errors", false, "report problems as JSON objects, one per line")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findFiles("lint", paths, ".meh")
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("lint: no *.meh files in %s", strings.Join(paths, " "))
+	}
+
+	list := diag.List{}
+	for _, name := range files {
+		list = append(list, lintFile(name)...)
+	}
+
+	reportDiagnostics(list)
+
+	for _, d := range list {
+		if d.Severity != diag.Info {
+			return compile.Exit{Code: 1}
+		}
+	}
+
+	return nil
+}
+
+// lintFile parses and lints a script.
+func lintFile(name string) diag.List {
+
+	f, err := os.Open(name)
+	if err != nil {
+		return diag.List{}.Append(err, diag.Syntax)
+	}
+	defer f.Close()
+
+	parsed, err := parse(name, f)
+	if err != nil {
+		return diag.List{}.Append(err, diag.Syntax)
+	}
+
+	return check.Lint(parsed)
+}
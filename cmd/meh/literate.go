@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// isMarkdown checks if a script is a Markdown file, whose meh code blocks
+// are run, e.g. README.md.
+func isMarkdown(name string) bool {
+	return strings.HasSuffix(name, ".md") || strings.HasSuffix(name, ".markdown")
+}
+
+// markdownScript returns the script made of the fenced code blocks of a
+// Markdown file whose info string is meh, e.g.
+//
+//	```meh
+//	x = 6 * 7
+//	```
+//
+// in order. The other lines are replaced by empty lines, so that positions in
+// the script are those in the Markdown file.
+func markdownScript(input io.Reader) (string, error) {
+
+	out := strings.Builder{}
+	fence := "" // the fence of the meh block being read, if any
+	skip := ""  // the fence of another block being skipped, if any
+
+	s := bufio.NewScanner(input)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		trimmed := strings.TrimLeft(line, " ")
+		indented := len(line)-len(trimmed) <= 3
+
+		switch {
+		case fence != "":
+			if indented && isClosingFence(trimmed, fence) {
+				fence = ""
+			} else {
+				out.WriteString(line)
+			}
+		case skip != "":
+			if indented && isClosingFence(trimmed, skip) {
+				skip = ""
+			}
+		case indented:
+			open, info := openingFence(trimmed)
+			if open != "" && info == "meh" {
+				fence = open
+			} else if open != "" {
+				skip = open
+			}
+		}
+
+		out.WriteString("\n")
+	}
+
+	return out.String(), s.Err()
+}
+
+// openingFence returns the fence a line opens a code block with, e.g. ```,
+// and the first word of its info string, or "" if it opens none.
+func openingFence(line string) (string, string) {
+
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n < 3 {
+			continue
+		}
+
+		info := strings.Fields(line[n:])
+		if len(info) == 0 {
+			return line[:n], ""
+		}
+
+		return line[:n], info[0]
+	}
+
+	return "", ""
+}
+
+// isClosingFence checks if a line closes a code block opened with a fence:
+// at least as many of the same characters, and nothing else.
+func isClosingFence(line, fence string) bool {
+	rest := strings.TrimLeft(line, fence[:1])
+	return len(line)-len(rest) >= len(fence) && strings.TrimSpace(rest) == ""
+}
@@ -2,131 +2,925 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
-	"golang.org/x/crypto/ssh/terminal"
-
+	"github.com/pdk/meh/check"
 	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/diag"
 	"github.com/pdk/meh/lex"
 	"github.com/pdk/meh/parser"
+	"github.com/pdk/meh/vm"
+	"github.com/peterh/liner"
+)
+
+// version is the version of meh, set when releasing with
+//
+//	go build -ldflags "-X main.version=v1.2.3"
+var version = "devel"
+
+var (
+	flags      = flag.NewFlagSet("meh", flag.ContinueOnError)
+	showVer    = flags.Bool("version", false, "print the version of meh, and the latest language level it supports")
+	langLevel  = flags.Int("lang", 0, "run scripts at this language level, unless they select one with a #meh:lang pragma (default: the latest)")
+	checkTypes = flags.Bool("check-types", false, "check type annotations before running")
+	emptyFalse = flags.Bool("empty-is-false", false, "treat nil, 0, \"\", and empty collections as false")
+	strictBool = flags.Bool("strict-logic", false, "make && and || always produce true or false")
+	seed       = flags.Int64("seed", 0, "seed for the random number builtins (default: the clock)")
+	compileTo  = flags.String("compile", "", "write the compiled script to this file, instead of running it")
+	useVM      = flags.Bool("vm", false, "run scripts on the bytecode VM")
+	trace      = flags.Bool("trace", false, "write each statement of the script to stderr, as it runs")
+	profile    = flags.Bool("profile", false, "report the hits and time of each node of the script to stderr")
+	jsonErrors = flags.Bool("json-errors", false, "report errors to stderr as JSON diagnostics, one per line")
+	checkOnly  = flags.Bool("check", false, "check that the scripts, or stdin, parse and compile, reporting every problem, instead of running them")
+	eachLine   = flags.String("n", "", "run this script for each line of the files, or of stdin, with line, fields, and nr assigned, printing each result other than nil and false")
+	watch      = flags.Bool("watch", false, "run the script again each time it changes, until interrupted")
+	debounce   = flags.Duration("debounce", 200*time.Millisecond, "with --watch, wait until the script has not changed for this long before running it")
+	clearTerm  = flags.Bool("clear", false, "with --watch, clear the screen before each run")
+	session    = flags.String("session", "", "load the REPL's names from this file, if it exists, and save them to it on exit")
+	plugins    stringList
+	inline     stringList
 )
 
+func init() {
+	flags.Var(&plugins, "plugin", "load builtins from this Go plugin (may be repeated)")
+	flags.Var(&inline, "e", "run this script, one line of it if repeated, with the arguments as args, and print its value")
+}
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 func main() {
-	if err := run(os.Args); err != nil {
-		log.Fatalf("program terminated: %v", err)
+	os.Exit(exitStatus(run(os.Args)))
+}
+
+// exitStatus returns the process exit status for the error returned by run:
+// the status requested by a script's exit(code), 0 for no error, or for a
+// request for help, which the flags have answered, or 1 for any other error,
+// which is reported.
+func exitStatus(err error) int {
+
+	var exit compile.Exit
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+
+	if err != nil {
+		reportError(err)
+		return 1
+	}
+
+	return 0
+}
+
+// reportError reports the error that terminated the program, as text, with
+// the line of the script it happened on, or as JSON diagnostics if requested.
+func reportError(err error) {
+
+	var list diag.List
+	if errors.As(err, &list) {
+		reportDiagnostics(list)
+		return
+	}
+
+	if *jsonErrors {
+		reportDiagnostics(diag.List{diag.From(err, diag.Runtime)})
+		return
 	}
+
+	log.Printf("program terminated: %v", err)
+	fmt.Fprint(os.Stderr, excerpt(diag.From(err, diag.Runtime), useColor()))
 }
 
+// reportDiagnostics reports diagnostics to stderr, as text, each with the
+// line of the script it concerns, colored if stderr is a terminal, or as JSON
+// if requested, one per line.
+func reportDiagnostics(list diag.List) {
+
+	list.Sort()
+
+	if !*jsonErrors {
+		color := useColor()
+		for _, d := range list {
+			text := d.Error()
+			if color {
+				text = colorize(d, text)
+			}
+			fmt.Fprintf(os.Stderr, "%s\n%s", text, excerpt(d, color))
+		}
+		return
+	}
+
+	enc := json.NewEncoder(os.Stderr)
+	for _, d := range list {
+		enc.Encode(d)
+	}
+}
+
+// subcommands are run by `meh name [args]`, instead of a script. A script
+// with the same name as a subcommand can be run as ./name.
+var subcommands = map[string]func(args []string) error{
+	"ast":    runAST,
+	"tokens": runTokens,
+	"test":   runTests,
+	"bench":  runBenchmarks,
+	"perf":   runPerf,
+	"lint":   runLint,
+	"build":  runBuild,
+	"js":     runJS,
+
+	"serve-eval": runServeEval,
+}
+
+// run runs meh with the command line arguments:
+//
+//	meh [flags] [script [args ...]]
+//
+// Flags end at the script's name. The arguments after it, including those
+// that look like flags, are the script's args, so that a script starting
+// with a #! line, e.g.
+//
+//	#!/usr/bin/env meh
+//
+// can be run as a command, ./script -v file.
 func run(args []string) error {
 
+	// a tool built by meh build runs its script, with all of its arguments.
+	if script, ok := embeddedScript(); ok {
+		return runFile(filepath.Base(args[0]), bytes.NewReader(script), args[1:])
+	}
+
 	if len(args) > 1 {
-		fileName := args[1]
+		if cmd, ok := subcommands[args[1]]; ok {
+			return cmd(args[2:])
+		}
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *showVer {
+		fmt.Printf("meh %s, language level %d, %s\n", version, compile.LatestLang, runtime.Version())
+		return nil
+	}
+
+	if *eachLine != "" {
+		if len(inline) > 0 {
+			return fmt.Errorf("-e cannot be used with -n")
+		}
+		if *trace {
+			return fmt.Errorf("--trace cannot be used with -n")
+		}
+		if *profile {
+			return fmt.Errorf("--profile cannot be used with -n")
+		}
+		return runLines(*eachLine, flags.Args())
+	}
+
+	if *checkOnly {
+		return checkFiles(flags.Args())
+	}
+
+	if len(inline) > 0 {
+		return runInline(strings.Join(inline, "\n"), flags.Args())
+	}
+
+	if flags.NArg() > 0 {
+		fileName := flags.Arg(0)
+
+		if *watch {
+			return watchFile(fileName, flags.Args()[1:], *debounce, *clearTerm)
+		}
 
 		input, err := os.Open(fileName)
 		if err != nil {
 			return fmt.Errorf("cannot run %s: %v", fileName, err)
 		}
 
-		return runFile(fileName, input)
+		if *compileTo != "" {
+			return compileFile(fileName, input, *compileTo)
+		}
+
+		return runFile(fileName, input, flags.Args()[1:])
 	}
 
-	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+	if *compileTo != "" {
+		return fmt.Errorf("--compile requires a script file")
+	}
+
+	if *watch {
+		return fmt.Errorf("--watch requires a script file")
+	}
+
+	if isTerminal(os.Stdin) {
+		if *trace {
+			return fmt.Errorf("--trace is not supported in the REPL")
+		}
+		if *profile {
+			return fmt.Errorf("--profile is not supported in the REPL")
+		}
 		return runREPL()
 	}
 
 	// log.Printf("running stdin")
-	return runFile("stdin", os.Stdin)
+	return runFile("stdin", os.Stdin, nil)
 }
 
-func runREPL() error {
+func runREPL() (err error) {
 
 	fmt.Printf("meh 0.0.x\n")
 
-	ctx := compile.NewTopContext()
+	ctx, err := newContext()
+	if err != nil {
+		return err
+	}
+
+	if *session != "" {
+		if err := loadSession(ctx, *session); err != nil {
+			return err
+		}
+		defer func() {
+			serr := saveSession(ctx, *session)
+			if serr != nil && err == nil {
+				err = serr
+			} else if serr != nil {
+				log.Printf("%v", serr)
+			}
+		}()
+	}
+
+	// the filter must be in place before the line editor reads stdin.
+	paste, err := startPaste()
+	if err != nil {
+		return err
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+	defer paste.stop()
+
+	// Ctrl-C cancels the entry being typed, rather than stopping meh.
+	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(completer(ctx))
 
-	scanner := bufio.NewScanner(os.Stdin)
+	// scripts read their input with the line editor, which owns stdin.
+	ctx.SetInput(&promptReader{line: line, paste: paste})
+
+	history := historyFile()
+	loadHistory(line, history)
+	defer saveHistory(line, history)
 
 	var input string
 	for {
-		if len(input) == 0 {
-			fmt.Printf("meh? ")
-		} else {
-			fmt.Printf("...? ")
+		prompt := "meh? "
+		if len(input) > 0 {
+			prompt = "...? "
 		}
 
-		scanned := scanner.Scan()
-		if !scanned {
+		nextLine, err := line.Prompt(prompt)
+		pasting := err == nil && paste.pasting()
+		if err == liner.ErrPromptAborted {
+			input = ""
+			continue
+		}
+		if err == io.EOF {
+			fmt.Println()
 			return nil
 		}
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(nextLine) != "" && nextLine != "." {
+			line.AppendHistory(nextLine)
+		}
 
-		nextLine := scanner.Text()
 		if nextLine != "." {
 			input += nextLine + "\n"
 		}
 
-		if nextLine == "." || (balanced(input) && isComplete(input)) {
-			err := runProgram(ctx, "repl", strings.NewReader(input), true)
+		// a paste is run once it has all arrived, not a statement at a
+		// time.
+		if nextLine == "." || !pasting && isComplete(input) {
+			// roll back the names assigned by input that fails, so
+			// that it can be corrected and entered again.
+			snap := ctx.Snapshot()
+			err := runProgram(ctx, "repl", strings.NewReader(input), echoREPL)
+			if errors.As(err, &compile.Exit{}) {
+				return err
+			}
 			if err != nil {
 				log.Printf("%v", err)
+				ctx.Restore(snap)
 			}
 			input = ""
 		}
 	}
 }
 
+// completer completes the identifier before the cursor with the names
+// assigned in the REPL, including the builtins, and the keywords.
+func completer(ctx *compile.Context) liner.WordCompleter {
+	return func(line string, pos int) (string, []string, string) {
+
+		runes := []rune(line)
+		start := pos
+		for start > 0 && lex.IsIdentRune(runes[start-1]) {
+			start--
+		}
+
+		head, prefix, tail := string(runes[:start]), string(runes[start:pos]), string(runes[pos:])
+
+		// members, e.g. m.na, are not completed.
+		if prefix == "" || strings.HasSuffix(head, ".") {
+			return head, nil, tail
+		}
+
+		completions := []string{}
+		for _, words := range [][]string{ctx.Names(), lex.Keywords()} {
+			for _, w := range words {
+				if strings.HasPrefix(w, prefix) {
+					completions = append(completions, w)
+				}
+			}
+		}
+		sort.Strings(completions)
+
+		return head, completions, tail
+	}
+}
+
+// historyFile returns the name of the file that keeps the lines entered in
+// the REPL, or "" if there is no home directory.
+func historyFile() string {
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".meh_history")
+}
+
+// loadHistory reads the lines entered in earlier REPL sessions, if any.
+func loadHistory(line *liner.State, name string) {
+
+	if name == "" {
+		return
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if _, err := line.ReadHistory(f); err != nil {
+		log.Printf("cannot read history: %v", err)
+	}
+}
+
+// saveHistory writes the lines entered in the REPL for later sessions.
+func saveHistory(line *liner.State, name string) {
+
+	if name == "" {
+		return
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		log.Printf("cannot save history: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := line.WriteHistory(f); err != nil {
+		log.Printf("cannot save history: %v", err)
+	}
+}
+
+// checkFiles checks that scripts, or stdin if there are none, can be parsed
+// and compiled, without running them. Every problem found is reported, and
+// the exit status is 1 if there were any.
+func checkFiles(names []string) error {
+
+	if len(names) == 0 {
+		return checkResult(checkScript("stdin", os.Stdin))
+	}
+
+	list := diag.List{}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("cannot check %s: %v", name, err)
+		}
+
+		if err := checkScript(name, f); err != nil {
+			list = list.Append(err, diag.Compile)
+		}
+		f.Close()
+	}
+
+	return checkResult(list.Err())
+}
+
+// checkScript parses and compiles a script.
+func checkScript(name string, input io.Reader) error {
+
+	parsed, err := parse(name, input)
+	if err != nil {
+		return err
+	}
+
+	_, err = compileParsed(parsed)
+	return err
+}
+
+// checkResult reports the problems found by checkFiles, and stops with exit
+// status 1 if there were any.
+func checkResult(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	reportDiagnostics(diag.List{}.Append(err, diag.Compile))
+
+	return compile.Exit{Code: 1}
+}
+
+// runInline runs a script given on the command line, and prints its value,
+// as echoPlain does, e.g.
+//
+//	meh -e 'x = 6' -e 'x * 7'
+func runInline(script string, args []string) error {
+
+	return runScript("-e", strings.NewReader(script+"\n"), args, echoPlain)
+}
+
+// runLines runs a script for each line of the files, or of stdin if there
+// are none, printing the results other than nil and false, e.g.
+//
+//	meh -n 'nr > 1 && fields[0]' data.txt
+func runLines(script string, files []string) error {
+
+	readers := []io.Reader{}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", name, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	input := io.Reader(os.Stdin)
+	if len(readers) > 0 {
+		input = io.MultiReader(readers...)
+	}
+
+	parsed, err := parse("-n", strings.NewReader(script))
+	if err != nil {
+		return err
+	}
+
+	program, err := compileParsed(parsed)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := newContext(files...)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	return compile.RunLines(ctx, program, input, func(v compile.Value) error {
+		if v == nil || v == false {
+			return nil
+		}
+		_, err := fmt.Fprintln(out, plain(v))
+		return err
+	})
+}
+
+// loadSession assigns the names saved in a session file, if it exists.
+func loadSession(ctx *compile.Context, name string) error {
+
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ctx.LoadSession(f)
+}
+
+// saveSession saves the names assigned in the REPL to a session file.
+func saveSession(ctx *compile.Context, name string) error {
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	skipped, err := ctx.SaveSession(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if len(skipped) > 0 {
+		log.Printf("not saved in %s: %s", name, strings.Join(skipped, ", "))
+	}
+
+	return f.Close()
+}
+
+// isComplete checks if the input entered in the REPL is complete, so that it
+// can be run, as lex.Lexer.Complete decides.
 func isComplete(input string) bool {
-	_, items := lex.New("repl", strings.NewReader(input))
-	lastItem := <-items
-	for item := range items {
-		lastItem = item
+	return lex.NewLexer("repl", strings.NewReader(input)).Complete()
+}
+
+func runFile(name string, input io.Reader, args []string) error {
+	return runScript(name, input, args, nil)
+}
+
+// runScript runs a script with the arguments, traced or profiled as the
+// flags ask, passing its result to echo if it is not nil.
+func runScript(name string, input io.Reader, args []string, echo func(compile.Value)) error {
+
+	ctx, err := newContext(args...)
+	if err != nil {
+		return err
 	}
 
-	return lastItem.Match(lex.Separator, lex.EOF)
+	if *trace {
+		if *useVM {
+			return fmt.Errorf("--trace is not supported with --vm")
+		}
+
+		src, err := ioutil.ReadAll(input)
+		if err != nil {
+			return fmt.Errorf("cannot run %s: %v", name, err)
+		}
+
+		ctx.SetHook(tracer(src))
+		input = bytes.NewReader(src)
+	}
+
+	if !*profile {
+		return runProgram(ctx, name, input, echo)
+	}
+
+	if *useVM {
+		return fmt.Errorf("--profile is not supported with --vm")
+	}
+
+	p := compile.NewProfile()
+	ctx.SetProfile(p)
+
+	err = runProgram(ctx, name, input, echo)
+	if rerr := p.WriteReport(os.Stderr); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// tracer returns a hook that writes each statement run to stderr, as its
+// position and the line of the script it starts on, unless the script is
+// compiled.
+func tracer(src []byte) compile.Hook {
+
+	lines := strings.Split(string(src), "\n")
+	if parser.IsEncoded(bufio.NewReader(bytes.NewReader(src))) {
+		lines = nil
+	}
+
+	return func(ctx *compile.Context, stmt parser.Node) {
+
+		text := ""
+		if n := stmt.Item.Line; n > 0 && n <= len(lines) {
+			text = " " + strings.TrimSpace(lines[n-1])
+		}
+
+		fmt.Fprintf(os.Stderr, "+ %s:%d:%s\n", stmt.Item.Name(), stmt.Item.Line, text)
+	}
 }
 
-// balanced checks if the string has balanced {} and (). Does not correctly
-// handle quoted strings.
-func balanced(s string) bool {
-	if count(s, '{') != count(s, '}') {
-		return false
+// newContext creates a top context configured by the command line flags,
+// with the builtins of the plugins loaded.
+func newContext(args ...string) (*compile.Context, error) {
+
+	ctx := compile.NewTopContext(args...)
+	ctx.Allow(compile.AllCapabilities)
+
+	if *langLevel != 0 {
+		if err := ctx.SetLang(*langLevel); err != nil {
+			return nil, fmt.Errorf("--lang: %v", err)
+		}
+	}
+
+	if *emptyFalse {
+		ctx.SetTruthiness(compile.EmptyIsFalse)
+	}
+
+	if *strictBool {
+		ctx.SetStrictLogic(true)
+	}
+
+	if *seed != 0 {
+		ctx.Seed(*seed)
+	}
+
+	for _, path := range plugins {
+		if err := ctx.LoadPlugin(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return ctx, nil
+}
+
+// compileFile compiles a script, and writes the result to a file, which can
+// be run in place of the script.
+func compileFile(name string, input io.Reader, outName string) error {
+
+	parsed, err := parse(name, input)
+	if err != nil {
+		return err
+	}
+
+	if _, err := compileParsed(parsed); err != nil {
+		return err
+	}
+
+	out, err := os.Create(outName)
+	if err != nil {
+		return err
+	}
+
+	if err := parser.Encode(out, parsed); err != nil {
+		out.Close()
+		return fmt.Errorf("cannot write %s: %v", outName, err)
+	}
+
+	return out.Close()
+}
+
+// printTree prints the JSON form of the parse tree of a script.
+func printTree(name string, input io.Reader) error {
+
+	parsed, err := parse(name, input)
+	if err != nil {
+		return err
+	}
+
+	data, err := parser.Marshal(parsed)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Printf("%s\n", data)
+	return err
+}
+
+// runAST prints the parse tree of a script, or of stdin:
+//
+//	meh ast [--json|--sexpr] [file]
+func runAST(args []string) error {
+
+	fs := flag.NewFlagSet("meh ast", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the tree as JSON (the default)")
+	asSexpr := fs.Bool("sexpr", false, "print the tree as an s-expression, with the position of each node")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *asJSON && *asSexpr {
+		return fmt.Errorf("ast: --json cannot be used with --sexpr")
+	}
+
+	name, input, err := openInput("ast", fs.Args())
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	if !*asSexpr {
+		return printTree(name, input)
 	}
 
-	if count(s, '(') != count(s, ')') {
-		return false
+	parsed, err := parse(name, input)
+	if err != nil {
+		return err
 	}
 
-	return true
+	_, err = fmt.Println(parsed.Sexpr())
+	return err
 }
 
-func count(s string, r rune) int {
-	c := 0
-	for _, x := range s {
-		if x == r {
-			c++
+// token is an item of the lexer, as printed by runTokens. The end is the
+// line and column of the last rune of the value, and the offset and length
+// are its bytes in the input.
+type token struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Offset    int    `json:"offset"`
+	Length    int    `json:"length"`
+}
+
+// runTokens prints the items the lexer produces for a script, or for stdin,
+// one per line, as tab separated values with quoted values, or as JSON:
+//
+//	meh tokens [--format=tsv|json] [file]
+func runTokens(args []string) error {
+
+	fs := flag.NewFlagSet("meh tokens", flag.ContinueOnError)
+	format := fs.String("format", "tsv", "print the tokens as tsv or json")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *format != "tsv" && *format != "json" {
+		return fmt.Errorf("tokens: unknown format %q, requires tsv or json", *format)
+	}
+
+	name, input, err := openInput("tokens", fs.Args())
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	enc := json.NewEncoder(out)
+	if *format == "tsv" {
+		fmt.Fprintf(out, "type\tvalue\tline\tcolumn\tendLine\tendColumn\toffset\tlength\n")
+	}
+
+	l := lex.NewLexer(name, input)
+	for item := l.Next(); item.Type != lex.EOF; item = l.Next() {
+		endLine, endColumn := item.End()
+		t := token{
+			Type:      item.Type.String(),
+			Value:     item.Value,
+			Line:      item.Line,
+			Column:    item.Column,
+			EndLine:   endLine,
+			EndColumn: endColumn,
+			Offset:    item.Offset,
+			Length:    item.Length,
+		}
+
+		if *format == "json" {
+			err = enc.Encode(t)
+		} else {
+			_, err = fmt.Fprintf(out, "%s\t%q\t%d\t%d\t%d\t%d\t%d\t%d\n",
+				t.Type, t.Value, t.Line, t.Column, t.EndLine, t.EndColumn, t.Offset, t.Length)
+		}
+		if err != nil {
+			return err
 		}
 	}
-	return c
+
+	return nil
 }
 
-func runFile(name string, input io.Reader) error {
+// openInput opens the file named by the arguments of a subcommand, or stdin
+// if there are none.
+func openInput(cmd string, args []string) (string, io.ReadCloser, error) {
 
-	ctx := compile.NewTopContext()
+	switch len(args) {
+	case 0:
+		return "stdin", ioutil.NopCloser(os.Stdin), nil
+	case 1:
+		f, err := os.Open(args[0])
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %v", cmd, err)
+		}
+		return args[0], f, nil
+	}
 
-	return runProgram(ctx, name, input, false)
+	return "", nil, fmt.Errorf("%s: requires at most one file, received %d", cmd, len(args))
 }
 
-func runProgram(ctx *compile.Context, name string, input io.Reader, printResult bool) error {
+// parse parses a script, the meh code blocks of a Markdown file, or reads a
+// compiled script.
+func parse(name string, input io.Reader) (parser.Node, error) {
 
-	p := parser.NewFromReader(name, input)
+	if isMarkdown(name) {
+		script, err := markdownScript(input)
+		if err != nil {
+			return parser.Node{}, fmt.Errorf("cannot read %s: %v", name, err)
+		}
+		input = strings.NewReader(script)
+	}
 
-	parsed := p.Parse()
+	r := bufio.NewReader(input)
+	if parser.IsEncoded(r) {
+		return parser.Decode(r)
+	}
+
+	src := strings.Builder{}
+	parsed, errs := parser.NewFromReader(name, io.TeeReader(r, &src)).Parse()
 	// log.Printf("parsed: %s", parsed)
 
-	program, err := compile.Compile(parsed)
+	rememberSource(name, src.String())
+
+	// refuse to run a program with statements left out.
+	if len(errs) > 0 {
+		return parser.Node{}, diag.ListOf(errs)
+	}
+
+	if *checkTypes {
+		if err := typeErrors(check.Types(parsed)); err != nil {
+			return parser.Node{}, err
+		}
+	}
+
+	return parsed, nil
+}
+
+// compileParsed compiles a parsed script for the selected engine.
+func compileParsed(parsed parser.Node) (compile.Expr, error) {
+
+	if !*useVM {
+		if errs := compile.LabelErrors(parsed); len(errs) > 0 {
+			return nil, errs
+		}
+
+		expr, err := compile.Compile(parsed)
+		if err != nil {
+			return nil, diag.List{}.Append(err, diag.Compile)
+		}
+		return expr, nil
+	}
+
+	chunk, err := vm.Compile(parsed)
+	if err != nil {
+		return nil, diag.List{}.Append(err, diag.Compile)
+	}
+
+	return func(ctx *compile.Context, _ ...compile.Value) (compile.Value, error) {
+		return chunk.Run(ctx)
+	}, nil
+}
+
+// runProgram runs a script in a context, and passes its value to echo,
+// unless echo is nil.
+func runProgram(ctx *compile.Context, name string, input io.Reader, echo func(compile.Value)) error {
+
+	parsed, err := parse(name, input)
+	if err != nil {
+		return err
+	}
+
+	if err := applyPragma(ctx, name); err != nil {
+		return err
+	}
+
+	program, err := compileParsed(parsed)
 	if err != nil {
 		return err
 	}
@@ -136,9 +930,57 @@ func runProgram(ctx *compile.Context, name string, input io.Reader, printResult
 		return err
 	}
 
-	if printResult {
-		fmt.Println(result.(compile.Tuple).Values[1])
+	if echo != nil {
+		echo(result)
 	}
 
 	return nil
 }
+
+// applyPragma selects the language level that a script parsed asks for
+// with a #meh:lang pragma, if any.
+func applyPragma(ctx *compile.Context, name string) error {
+
+	src, _ := sourceText(name)
+	level, err := compile.LangPragma(src)
+	if err != nil || level == 0 {
+		return err
+	}
+
+	if err := ctx.SetLang(level); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	return nil
+}
+
+// echoREPL prints the value of an entry in the REPL, as a script would write
+// it.
+func echoREPL(v compile.Value) {
+	fmt.Println(compile.Render(v))
+}
+
+// echoPlain prints a value for use by other programs: strings as they are,
+// and other values as the REPL does.
+func echoPlain(v compile.Value) {
+	fmt.Println(plain(v))
+}
+
+func plain(v compile.Value) string {
+	if s, ok := compile.Result(v).(string); ok {
+		return s
+	}
+	return compile.Render(v)
+}
+
+// typeErrors returns the type check problems as diagnostics, if there were
+// any.
+func typeErrors(errs []error) error {
+
+	list := diag.List{}
+	for _, err := range errs {
+		list = append(list, diag.From(err, diag.Type))
+	}
+
+	return list.Err()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestTraceInline checks that --trace writes the statements of a script
+// given with -e, as it does for a script file.
+func TestTraceInline(t *testing.T) {
+
+	out, err := ioutil.TempFile("", "trace-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+
+	*trace = true
+	stderr, stdout := os.Stderr, os.Stdout
+	os.Stderr, os.Stdout = out, out
+	err = runInline("x = 1\ny = x + 1", nil)
+	os.Stderr, os.Stdout = stderr, stdout
+	*trace = false
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"+ -e:1: x = 1\n", "+ -e:2: y = x + 1\n"} {
+		if !strings.Contains(string(written), want) {
+			t.Errorf("trace is %q, want it to have %q", written, want)
+		}
+	}
+}
+
+// TestTraceEachLine checks that --trace and --profile are rejected with -n,
+// rather than ignored.
+func TestTraceEachLine(t *testing.T) {
+
+	for _, flag := range []string{"--trace", "--profile"} {
+		err := run([]string{"meh", flag, "-n", "line"})
+		*trace, *profile, *eachLine = false, false, ""
+
+		want := flag + " cannot be used with -n"
+		if err == nil || err.Error() != want {
+			t.Errorf("%s -n: error is %v, want %q", flag, err, want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// runPerf runs the benchmarks of meh itself, rather than of scripts:
+//
+//	meh perf [-run regexp] [-benchtime d] [-o file] [-baseline file] [-threshold pct]
+//
+// They measure lexing and parsing a large script, an arithmetic loop,
+// function calls, and an entry of the REPL, reporting the memory allocated
+// too, and take the flags of meh bench, e.g. to save the results of one
+// build and compare those of another with them:
+//
+//	meh perf -o before.txt
+//	meh perf -baseline before.txt
+//
+// They are the Go benchmarks of this package too, of the same names, so the
+// output of go test can be the baseline, or be compared with one:
+//
+//	go test -run '^$' -bench . -benchmem ./cmd/meh > before.txt
+//	meh perf -baseline before.txt
+func runPerf(args []string) error {
+
+	fs := flag.NewFlagSet("meh perf", flag.ContinueOnError)
+	opts := benchFlags(fs, true)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("perf: takes no arguments, received %d", fs.NArg())
+	}
+
+	if err := opts.init(); err != nil {
+		return fmt.Errorf("perf: %v", err)
+	}
+
+	failed := false
+	for _, p := range perfBenchmarks {
+		if !opts.filter.MatchString(p.name) {
+			continue
+		}
+
+		op, err := p.setup()
+		if err == nil {
+			var r benchResult
+			r, err = runBenchmark(op, opts.benchTime)
+			r.size = p.size
+			if err == nil {
+				opts.report(p.name, r)
+				continue
+			}
+		}
+
+		failed = true
+		fmt.Printf("--- FAIL: %s\n\t%s\n", p.name, indent(err))
+	}
+
+	return opts.finish("perf", failed)
+}
+
+// perfBenchmarks are the benchmarks of meh perf, and of go test -bench. Each
+// is set up once, and its op called repeatedly; its size is the bytes of
+// source an op reads, if its throughput is reported.
+var perfBenchmarks = []struct {
+	name  string
+	size  int64
+	setup func() (func() error, error)
+}{
+	{"BenchmarkLex", int64(len(perfSource)), perfLex},
+	{"BenchmarkParse", int64(len(perfSource)), perfParse},
+	{"BenchmarkArith", 0, perfScript(perfArith)},
+	{"BenchmarkCalls", 0, perfScript(perfCalls)},
+	{"BenchmarkREPL", 0, perfREPL},
+}
+
+// perfSource is a large script, of the statements most scripts are made of,
+// for lexing and parsing.
+var perfSource = func() string {
+
+	src := strings.Builder{}
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&src, `
+# f%d scales the larger of its arguments.
+f%d = fn(a, b) {
+	label = "the larger of " + str(a) + ' and ' + str(b)
+	a > b && return a * 2 || return b / 2.5
+}
+v%d = f%d(%d, 7) + len(`+"`raw`"+`)
+items%d = list(v%d, "x", 1500.25, nil, true)
+`, i, i, i, i, i, i, i)
+	}
+
+	return src.String()
+}()
+
+func perfLex() (func() error, error) {
+	return func() error {
+		l := lex.NewLexer("perf", strings.NewReader(perfSource))
+		for item := l.Next(); item.Type != lex.EOF; item = l.Next() {
+			if item.Type == lex.Error {
+				return item.Error(fmt.Errorf("failed to lex %q", item.Value))
+			}
+		}
+		return nil
+	}, nil
+}
+
+func perfParse() (func() error, error) {
+	return func() error {
+		_, errs := parser.NewFromString("perf", perfSource).Parse()
+		if len(errs) > 0 {
+			return diag.ListOf(errs)
+		}
+		return nil
+	}, nil
+}
+
+// perfArith loops over arithmetic, and comparisons.
+const perfArith = `
+i = 0
+total = 0
+do {
+	total = total + i * 3 % 7 - 1
+	i = i + 1
+} until i >= 1000
+`
+
+// perfCalls calls functions, recursively.
+const perfCalls = `
+fib = fn(n) { n < 2 && return n; return fib(n - 1) + fib(n - 2) }
+fib(15)
+`
+
+// perfScript returns the setup of a benchmark that runs a script, compiled
+// once, in a new context of a top context for each op.
+func perfScript(src string) func() (func() error, error) {
+	return func() (func() error, error) {
+
+		program, err := compile.NewProgram("perf", src)
+		if err != nil {
+			return nil, err
+		}
+
+		return func() error {
+			_, err := program.Run(nil)
+			return err
+		}, nil
+	}
+}
+
+// perfREPL enters a line in a REPL, as runREPL does: it is checked for
+// being complete, the names are saved to roll back to, and it is parsed,
+// compiled, and run, and its value rendered.
+func perfREPL() (func() error, error) {
+
+	ctx, err := newContext()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ctx.Set("count", int64(0)); err != nil {
+		return nil, err
+	}
+
+	const entry = "count = count + 1\n"
+	return func() error {
+
+		if !isComplete(entry) {
+			return fmt.Errorf("entry is not complete: %q", entry)
+		}
+
+		ctx.Snapshot()
+		return runProgram(ctx, "perf", strings.NewReader(entry), func(v compile.Value) {
+			compile.Render(v)
+		})
+	}, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func BenchmarkLex(b *testing.B)   { benchPerf(b) }
+func BenchmarkParse(b *testing.B) { benchPerf(b) }
+func BenchmarkArith(b *testing.B) { benchPerf(b) }
+func BenchmarkCalls(b *testing.B) { benchPerf(b) }
+func BenchmarkREPL(b *testing.B)  { benchPerf(b) }
+
+// benchPerf runs the benchmark of meh perf of the benchmark's name.
+func benchPerf(b *testing.B) {
+
+	for _, p := range perfBenchmarks {
+		if p.name != b.Name() {
+			continue
+		}
+
+		op, err := p.setup()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ReportAllocs()
+		b.SetBytes(p.size)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if err := op(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return
+	}
+
+	b.Fatalf("%s is not a benchmark of meh perf", b.Name())
+}
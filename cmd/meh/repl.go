@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peterh/liner"
+)
+
+// promptReader is the input of scripts run in the REPL. Rather than read
+// stdin, which the line editor reads, each read prompts for a line with it.
+// Ctrl-D ends the input, and Ctrl-C stops the reading script.
+type promptReader struct {
+	line  *liner.State
+	paste *pasteFilter
+	buf   []byte
+}
+
+func (r *promptReader) Read(p []byte) (int, error) {
+
+	if len(r.buf) == 0 {
+		text, err := r.line.Prompt("")
+		if err == liner.ErrPromptAborted {
+			return 0, errors.New("input interrupted")
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.paste.pasting()
+		r.buf = []byte(text + "\n")
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// The sequences that turn on and off the bracketed paste mode of terminals,
+// and that the terminals put around text pasted in that mode.
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+	pasteStart        = "\x1b[200~"
+	pasteEnd          = "\x1b[201~"
+)
+
+// pasteWait is how long to wait for the rest of a paste, which may arrive in
+// more than one read.
+const pasteWait = 100 * time.Millisecond
+
+// pasteFilter passes the input of the terminal on to the line editor, which
+// knows nothing of bracketed paste, without the sequences around pasted
+// text, and records which line ends were pasted, so that the REPL can wait
+// for the end of a paste before running what was pasted.
+type pasteFilter struct {
+	in  io.Reader
+	out io.Writer
+
+	mu      sync.Mutex
+	open    bool  // whether a paste has started, and not ended
+	pastes  int   // the number of pastes started
+	ends    []int // the paste of each line end passed on, and not yet taken, or 0 if typed
+	changed chan struct{}
+}
+
+// startPaste turns on bracketed paste, if stdin and stdout are a terminal,
+// and puts a pasteFilter between the terminal and the line editor that then
+// reads os.Stdin. It returns nil if they are not a terminal.
+func startPaste() (*pasteFilter, error) {
+
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	f := newPasteFilter(os.Stdin, w)
+	os.Stdin = r
+	go f.run()
+
+	fmt.Print(bracketedPasteOn)
+
+	return f, nil
+}
+
+// stop turns off bracketed paste, and gives os.Stdin back to the terminal.
+func (f *pasteFilter) stop() {
+
+	if f == nil {
+		return
+	}
+
+	fmt.Print(bracketedPasteOff)
+	os.Stdin = f.in.(*os.File)
+}
+
+func newPasteFilter(in io.Reader, out io.Writer) *pasteFilter {
+	return &pasteFilter{in: in, out: out, changed: make(chan struct{})}
+}
+
+// run passes the input on until it ends.
+func (f *pasteFilter) run() {
+
+	buf := make([]byte, 4096)
+	var held []byte // what may be the start of pasteStart or pasteEnd
+	var last byte   // the last byte passed on in a paste
+
+	for {
+		n, err := f.in.Read(buf)
+
+		var out []byte
+		for _, b := range buf[:n] {
+			held = append(held, b)
+			if strings.HasPrefix(pasteStart, string(held)) || strings.HasPrefix(pasteEnd, string(held)) {
+				switch string(held) {
+				case pasteStart:
+					f.setOpen(true)
+					held, last = nil, 0
+				case pasteEnd:
+					f.setOpen(false)
+					held = nil
+				}
+				continue
+			}
+
+			// not a paste sequence, though an escape ending it may
+			// start one.
+			keep := 0
+			if b == pasteStart[0] && len(held) > 1 {
+				keep = 1
+			}
+			for _, b := range held[:len(held)-keep] {
+				out = f.pass(out, b, &last)
+			}
+			held = append(held[:0], held[len(held)-keep:]...)
+		}
+
+		// a lone escape is a key, or the start of a sequence that is
+		// never a paste, which the line editor waits for.
+		if len(held) == 1 {
+			out = f.pass(out, held[0], &last)
+			held = held[:0]
+		}
+
+		if len(out) > 0 {
+			if _, werr := f.out.Write(out); werr != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			if c, ok := f.out.(io.Closer); ok {
+				c.Close()
+			}
+			return
+		}
+	}
+}
+
+// pass appends a byte to the output, recording the line ends. In a paste,
+// \r\n is one line end, and is passed on as \r, which is what the Enter key
+// sends.
+func (f *pasteFilter) pass(out []byte, b byte, last *byte) []byte {
+
+	f.mu.Lock()
+	pasting, paste := f.open, f.pastes
+	f.mu.Unlock()
+
+	if !pasting {
+		if b == '\r' || b == '\n' {
+			f.lineEnd(0)
+		}
+		return append(out, b)
+	}
+
+	prev := *last
+	*last = b
+
+	switch {
+	case b == '\n' && prev == '\r':
+		return out
+	case b == '\r' || b == '\n':
+		f.lineEnd(paste)
+	}
+
+	return append(out, b)
+}
+
+func (f *pasteFilter) setOpen(open bool) {
+	f.mu.Lock()
+	if open {
+		f.pastes++
+	}
+	f.open = open
+	f.signal()
+	f.mu.Unlock()
+}
+
+func (f *pasteFilter) lineEnd(paste int) {
+	f.mu.Lock()
+	f.ends = append(f.ends, paste)
+	f.signal()
+	f.mu.Unlock()
+}
+
+// signal wakes what waits for a change. It is called with mu held.
+func (f *pasteFilter) signal() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// pasting takes the line end of a line the line editor returned, and checks
+// if the line was pasted, and more of the paste is to come.
+func (f *pasteFilter) pasting() bool {
+
+	if f == nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.ends) == 0 {
+		return false
+	}
+
+	paste := f.ends[0]
+	f.ends = f.ends[1:]
+	if paste == 0 {
+		return false
+	}
+
+	timeout := time.After(pasteWait)
+	for f.open && f.pastes == paste && len(f.ends) == 0 {
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timeout:
+			f.mu.Lock()
+			return true
+		}
+		f.mu.Lock()
+	}
+
+	return len(f.ends) > 0 && f.ends[0] == paste || f.open && f.pastes == paste
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// repl runs the REPL with input, and returns what it printed.
+func repl(t *testing.T, input string) string {
+
+	in, err := ioutil.TempFile("", "repl-in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(in.Name())
+	if _, err := in.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	in.Seek(0, 0)
+
+	out, err := ioutil.TempFile("", "repl-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = in, out
+	err = runREPL()
+	os.Stdin, os.Stdout = stdin, stdout
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printed, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(printed)
+}
+
+func TestREPLInput(t *testing.T) {
+
+	// keep the history of the tests out of the user's.
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", t.TempDir())
+	defer os.Setenv("HOME", home)
+
+	got := repl(t, "x = read_line()\nhello\ny = read_line()\nworld\nx + \" \" + y\n")
+	if !strings.Contains(got, `"hello world"`) {
+		t.Errorf("REPL printed %q, want the lines read by the script", got)
+	}
+}
+
+func TestPasteFilter(t *testing.T) {
+
+	in := "1 +\r2\r" + pasteStart + "a = {\r\n  1\r\n}\r\nb = 2" + pasteEnd + "\r" +
+		pasteStart + "c\n" + pasteEnd + "\x1b[A\x1b\x1b[200~d\r\x1b[201~"
+
+	var out bytes.Buffer
+	f := newPasteFilter(strings.NewReader(in), &out)
+	f.run()
+
+	if want := "1 +\r2\ra = {\r  1\r}\rb = 2\rc\n\x1b[A\x1bd\r"; out.String() != want {
+		t.Errorf("passed on %q, want %q", out.String(), want)
+	}
+
+	// only the lines of a paste before its last line end wait for more.
+	var got []bool
+	for range []string{"1 +", "2", "a = {", "  1", "}", "b = 2", "c", "d"} {
+		got = append(got, f.pasting())
+	}
+	if want := []bool{false, false, true, true, false, false, false, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pasting %v, want %v", got, want)
+	}
+}
+
+func TestPasteFilterWaits(t *testing.T) {
+
+	in, typed := io.Pipe()
+	editor, out := io.Pipe()
+	f := newPasteFilter(in, out)
+	go f.run()
+
+	// as the line editor does, read a line before asking about it.
+	lines := bufio.NewReader(editor)
+	readLine := func() {
+		if _, err := lines.ReadString('\r'); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go io.WriteString(typed, pasteStart+"a = 1\r")
+	readLine()
+	if !f.pasting() {
+		t.Errorf("a line of an open paste does not wait for more")
+	}
+
+	// the end of the paste arrives while its last line waits.
+	go io.WriteString(typed, "b = 2\r")
+	readLine()
+	go func() {
+		time.Sleep(pasteWait / 4)
+		io.WriteString(typed, pasteEnd)
+	}()
+	if f.pasting() {
+		t.Errorf("the last line of a paste waits for more")
+	}
+
+	typed.Close()
+}
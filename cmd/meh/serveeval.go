@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/values"
+)
+
+// runServeEval serves an HTTP API that evaluates scripts:
+//
+//	meh serve-eval [-timeout d] [-fuel n] [-max-string n] [-max-list n] [-max-values n] [-max-bytes n] [addr]
+//
+// A POST to /eval of a JSON object with the script as source, and the names
+// to assign before it runs as vars, e.g.
+//
+//	{"source": "price * qty", "vars": {"price": 2.5, "qty": 4}}
+//
+// returns the value of the script's last statement as {"result": 10}, or
+// an error as {"error": "...", "diagnostics": [...]}. Each script runs in a
+// sandbox of its own: none of the builtins reaching the host, e.g. reading
+// files, are allowed, and the run is stopped at the timeout, or when it uses
+// up its fuel or exceeds its limits. The address is :8080 by default.
+func runServeEval(args []string) error {
+
+	fs := flag.NewFlagSet("meh serve-eval", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 5*time.Second, "stop each script after this long")
+	fuel := fs.Int64("fuel", 1000000, "stop each script after evaluating this many expressions (0: no limit)")
+	maxString := fs.Int64("max-string", 1<<20, "the largest string, in bytes, a script may produce (0: no limit)")
+	maxList := fs.Int64("max-list", 100000, "the largest list or map a script may produce (0: no limit)")
+	maxValues := fs.Int64("max-values", 1000000, "the total of the strings, elements, and entries a script may produce (0: no limit)")
+	maxBytes := fs.Int64("max-bytes", 64<<20, "the total of the bytes of the strings a script may produce (0: no limit)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 1 {
+		return fmt.Errorf("serve-eval: requires at most one address, received %d", fs.NArg())
+	}
+
+	addr := ":8080"
+	if fs.NArg() == 1 {
+		addr = fs.Arg(0)
+	}
+
+	h := &evalHandler{
+		timeout: *timeout,
+		fuel:    *fuel,
+		limits: compile.Limits{
+			MaxStringLen: *maxString,
+			MaxListLen:   *maxList,
+			MaxValues:    *maxValues,
+			MaxBytes:     *maxBytes,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/eval", h)
+
+	log.Printf("serving evaluation on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// maxEvalRequest is the largest request body evalHandler reads.
+const maxEvalRequest = 1 << 20
+
+// evalHandler evaluates the scripts posted to it, each in a sandbox.
+type evalHandler struct {
+	timeout time.Duration
+	fuel    int64
+	limits  compile.Limits
+}
+
+type evalRequest struct {
+	Source string                 `json:"source"`
+	Vars   map[string]interface{} `json:"vars"`
+}
+
+type evalResponse struct {
+	Result      interface{} `json:"result"`
+	Error       string      `json:"error,omitempty"`
+	Diagnostics diag.List   `json:"diagnostics,omitempty"`
+}
+
+func (h *evalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeEval(w, http.StatusMethodNotAllowed, evalResponse{Error: "requires POST"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEvalRequest))
+	if err != nil {
+		writeEval(w, http.StatusRequestEntityTooLarge, evalResponse{Error: err.Error()})
+		return
+	}
+
+	var req evalRequest
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		writeEval(w, http.StatusBadRequest, evalResponse{Error: fmt.Sprintf("malformed request: %v", err)})
+		return
+	}
+
+	result, err := h.eval(r.Context(), req)
+	if err != nil {
+		writeEval(w, http.StatusUnprocessableEntity, evalResponse{
+			Error:       err.Error(),
+			Diagnostics: diag.List{}.Append(err, diag.Runtime),
+		})
+		return
+	}
+
+	writeEval(w, http.StatusOK, evalResponse{Result: result})
+}
+
+// eval runs a script in a sandbox, and returns its value as plain Go values.
+// A panic of the run, e.g. in a builtin, is returned as its error, so that
+// one script cannot stop the server.
+func (h *evalHandler) eval(c context.Context, req evalRequest) (result interface{}, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("script failed: %v", r)
+		}
+	}()
+
+	program, err := compile.NewProgram("eval", req.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	// no capabilities are allowed, and so no access to the host.
+	top := program.Top()
+	top.SetLogOutput(ioutil.Discard)
+	top.SetLimits(h.limits)
+	if h.fuel > 0 {
+		top.SetFuel(h.fuel)
+	}
+
+	vars := make(map[string]interface{}, len(req.Vars))
+	for name, v := range req.Vars {
+		vars[name] = jsonValue(v)
+	}
+
+	c, cancel := context.WithTimeout(c, h.timeout)
+	defer cancel()
+
+	result, err = program.RunContext(c, vars)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %v", h.timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return values.ToGo(top, result), nil
+}
+
+// jsonValue converts the numbers of a decoded JSON value to ints, if they
+// are whole, or floats.
+func jsonValue(v interface{}) interface{} {
+
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case []interface{}:
+		for i, e := range x {
+			x[i] = jsonValue(e)
+		}
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = jsonValue(e)
+		}
+	}
+
+	return v
+}
+
+// writeEval writes a response, with the result, if it can be written as
+// JSON, e.g. not a fn.
+func writeEval(w http.ResponseWriter, status int, resp evalResponse) {
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		status = http.StatusUnprocessableEntity
+		out, _ = json.Marshal(evalResponse{Error: fmt.Sprintf("result cannot be written as JSON: %v", err)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/parser"
+)
+
+func TestServeEvalErrors(t *testing.T) {
+
+	if _, err := compile.RegisterOperator("<!", parser.Comparison, func(ctx *compile.Context, l, r compile.Value) (compile.Value, error) {
+		panic("operator failed")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// no fuel, so that only the call depth stops runaway recursion.
+	h := &evalHandler{timeout: 5 * time.Second}
+
+	for _, c := range []struct {
+		source string
+		status int
+		error  string
+	}{
+		{`price * qty`, http.StatusOK, ""},
+		{`price / 0`, http.StatusUnprocessableEntity, "integer divide by zero"},
+		{`1 <! 2`, http.StatusUnprocessableEntity, "script failed: operator failed"},
+		{`(fn(f) { f(f) })(fn(f) { f(f) })`, http.StatusUnprocessableEntity, "call depth exceeded"},
+	} {
+		body, _ := json.Marshal(evalRequest{Source: c.source, Vars: map[string]interface{}{"price": 2, "qty": 4}})
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/eval", strings.NewReader(string(body))))
+
+		var resp evalResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", c.source, err)
+		}
+
+		if w.Code != c.status || !strings.Contains(resp.Error, c.error) {
+			t.Errorf("%s: status %d, error %q, want %d, %q", c.source, w.Code, resp.Error, c.status, c.error)
+		}
+	}
+}
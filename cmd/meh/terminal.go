@@ -0,0 +1,16 @@
+//go:build !js
+// +build !js
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// isTerminal checks if a file is a terminal, e.g. to decide whether to run
+// the REPL.
+func isTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+// isTerminal reports false under js, which has no terminal, so that stdin
+// is run as a script.
+func isTerminal(f *os.File) bool {
+	return false
+}
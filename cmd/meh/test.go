@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// runTests runs the tests of the *_test.meh files in directories, searched
+// recursively, or named, by default those under the current directory:
+//
+//	meh test [-run regexp] [-v] [-cover] [-coverhtml file] [dir|file ...]
+//
+// Each file is run, and then each function it assigns to a name starting
+// with test_ is called, in the order assigned. A test fails if it stops with
+// an error, e.g. from assert, which is reported with its position. The exit
+// status is 1 if any test failed.
+//
+// With -cover, the lines of each test file that ran, and those that did not,
+// are reported after the tests, and -coverhtml writes them as an HTML page
+// too.
+func runTests(args []string) error {
+
+	fs := flag.NewFlagSet("meh test", flag.ContinueOnError)
+	run := fs.String("run", "", "run only the tests whose names match this regexp")
+	verbose := fs.Bool("v", false, "report every test, not only those that fail")
+	cover := fs.Bool("cover", false, "report the lines of the scripts that the tests ran")
+	coverHTML := fs.String("coverhtml", "", "write the lines of the scripts that the tests ran as an HTML page to this file")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return fmt.Errorf("test: -run: %v", err)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findFiles("test", paths, "_test.meh")
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("test: no *_test.meh files in %s", strings.Join(paths, " "))
+	}
+
+	var coverage *compile.Coverage
+	if *cover || *coverHTML != "" {
+		coverage = compile.NewCoverage()
+	}
+
+	failed := false
+	for _, name := range files {
+		if !testFile(name, filter, *verbose, coverage) {
+			failed = true
+		}
+	}
+
+	if coverage != nil {
+		if err := reportCoverage(coverage, *coverHTML); err != nil {
+			return err
+		}
+	}
+
+	if failed {
+		fmt.Println("FAIL")
+		return compile.Exit{Code: 1}
+	}
+
+	return nil
+}
+
+// findFiles finds the files in directories whose names end with a suffix,
+// or named, for a subcommand.
+func findFiles(cmd string, paths []string, suffix string) ([]string, error) {
+
+	files := []string{}
+	for _, path := range paths {
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cmd, err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(name, suffix) {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cmd, err)
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// testFile runs the tests of a file, reports the results, and returns true
+// if they all passed. The lines run are recorded in the coverage, if any.
+func testFile(name string, filter *regexp.Regexp, verbose bool, coverage *compile.Coverage) bool {
+
+	start := time.Now()
+
+	ctx, tests, err := loadTests(name, "test_", coverage)
+	if err != nil {
+		fmt.Printf("FAIL\t%s\n\t%s\n", name, indent(err))
+		return false
+	}
+
+	passed, ran := true, 0
+	for _, test := range tests {
+		if !filter.MatchString(test.Item.Value) {
+			continue
+		}
+		ran++
+
+		began := time.Now()
+		err := runTest(ctx, test)
+		took := time.Since(began)
+
+		if err != nil {
+			passed = false
+			fmt.Printf("--- FAIL: %s (%s)\n\t%s\n", test.Item.Value, seconds(took), indent(err))
+		} else if verbose {
+			fmt.Printf("--- PASS: %s (%s)\n", test.Item.Value, seconds(took))
+		}
+	}
+
+	if !passed {
+		fmt.Printf("FAIL\t%s\t%s\n", name, seconds(time.Since(start)))
+		return false
+	}
+
+	fmt.Printf("ok\t%s\t%s\t%d tests\n", name, seconds(time.Since(start)), ran)
+	return true
+}
+
+// loadTests runs a test file, and returns its context, with the names of the
+// functions it assigns whose names start with the prefix, e.g. its tests, in
+// the order they were assigned. The lines run, then and later, are recorded in
+// the coverage, if any.
+func loadTests(name, prefix string, coverage *compile.Coverage) (*compile.Context, []parser.Node, error) {
+
+	input, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer input.Close()
+
+	parsed, err := parse(name, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	program, err := compileParsed(parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, err := newContext()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := applyPragma(ctx, name); err != nil {
+		return nil, nil, err
+	}
+
+	if coverage != nil {
+		coverage.Add(parsed)
+		ctx.SetCoverage(coverage)
+	}
+
+	if _, err := program(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	tests := []parser.Node{}
+	seen := make(map[string]bool)
+	for _, stmt := range parsed.Children {
+		if stmt.Type() != lex.Assign || len(stmt.Children) == 0 {
+			continue
+		}
+
+		ident := stmt.Children[0]
+		if ident.Type() != lex.Ident || !strings.HasPrefix(ident.Item.Value, prefix) || seen[ident.Item.Value] {
+			continue
+		}
+
+		seen[ident.Item.Value] = true
+		tests = append(tests, ident)
+	}
+
+	return ctx, tests, nil
+}
+
+// runTest calls a test function, in a child of the context of its file, so
+// that tests do not see each other's names.
+func runTest(ctx *compile.Context, test parser.Node) error {
+
+	fn := ctx.Get(test.Item.Value)
+	if _, ok := compile.Callable(fn); !ok {
+		return test.Error(fmt.Errorf("%s is %s, not a fn", test.Item.Value, compile.TypeName(fn)))
+	}
+
+	call, err := compile.NewContext(ctx).EnterCall(test.Item.Value, test.Item)
+	if err != nil {
+		return test.Error(err)
+	}
+
+	_, err = call.Call(fn)
+	if err == nil {
+		return nil
+	}
+
+	if errors.As(err, &compile.Exit{}) {
+		return test.Error(fmt.Errorf("test called exit"))
+	}
+
+	return call.Traced(err)
+}
+
+// reportCoverage writes a coverage report to stdout, and as an HTML page to a
+// file, if named.
+func reportCoverage(coverage *compile.Coverage, htmlName string) error {
+
+	fmt.Println()
+	if err := coverage.WriteReport(os.Stdout); err != nil {
+		return err
+	}
+
+	if htmlName == "" {
+		return nil
+	}
+
+	f, err := os.Create(htmlName)
+	if err != nil {
+		return fmt.Errorf("test: %v", err)
+	}
+
+	if err := coverage.WriteHTML(f); err != nil {
+		f.Close()
+		return fmt.Errorf("test: %v", err)
+	}
+
+	return f.Close()
+}
+
+// indent indents the lines after the first of an error's message, to line
+// up under the first.
+func indent(err error) string {
+	return strings.Replace(err.Error(), "\n", "\n\t", -1)
+}
+
+// seconds formats a duration as go test does.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
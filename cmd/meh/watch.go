@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pdk/meh/compile"
+)
+
+// pollInterval is how often watchFile checks the script for changes.
+const pollInterval = 100 * time.Millisecond
+
+// watchFile runs a script, and again each time it changes, until meh is
+// interrupted. A change is acted on once the script has not changed for the
+// debounce time, so that an editor saving a file in steps runs it once.
+// Errors, and exits, are reported, and do not stop the watch.
+func watchFile(name string, args []string, debounce time.Duration, clear bool) error {
+
+	last, err := fileStamp(name)
+	if err != nil {
+		return fmt.Errorf("cannot watch %s: %v", name, err)
+	}
+
+	for {
+		if clear {
+			fmt.Print("\x1b[H\x1b[2J")
+		}
+
+		watchRun(name, args)
+		fmt.Fprintf(os.Stderr, "watching %s for changes\n", name)
+
+		last = waitForChange(name, last, debounce)
+	}
+}
+
+// watchRun runs a script once, reporting how it ended.
+func watchRun(name string, args []string) {
+
+	input, err := os.Open(name)
+	if err != nil {
+		reportError(fmt.Errorf("cannot run %s: %v", name, err))
+		return
+	}
+	defer input.Close()
+
+	err = runFile(name, input, args)
+
+	var exit compile.Exit
+	if errors.As(err, &exit) {
+		fmt.Fprintf(os.Stderr, "exit status %d\n", exit.Code)
+		return
+	}
+
+	if err != nil {
+		reportError(err)
+	}
+}
+
+// waitForChange waits until a file's stamp differs from the last, and then
+// stays the same for the debounce time, and returns the new stamp. A file
+// that cannot be read, e.g. while an editor replaces it, counts as changed.
+func waitForChange(name string, last string, debounce time.Duration) string {
+
+	for {
+		time.Sleep(pollInterval)
+
+		stamp, _ := fileStamp(name)
+		if stamp == last {
+			continue
+		}
+
+		for {
+			time.Sleep(debounce)
+
+			settled, _ := fileStamp(name)
+			if settled == stamp && stamp != "" {
+				return stamp
+			}
+			stamp = settled
+		}
+	}
+}
+
+// fileStamp returns a string that changes when a file is modified.
+func fileStamp(name string) (string, error) {
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d %d", info.ModTime().UnixNano(), info.Size()), nil
+}
@@ -0,0 +1,57 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command mehwasm runs meh in a browser, e.g. to power a playground. Build it
+// with
+//
+//	GOOS=js GOARCH=wasm go build -o meh.wasm ./cmd/mehwasm
+//
+// and load it with the wasm_exec.js that comes with Go. It defines a global
+// function, mehEval(src), that runs a script and returns an object with the
+// result of its last statement, formatted as the REPL prints it, or an error
+// message.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/values"
+)
+
+func main() {
+
+	js.Global().Set("mehEval", js.FuncOf(eval))
+
+	// keep running, so that mehEval can be called.
+	select {}
+}
+
+// eval runs the script given as the first argument.
+func eval(this js.Value, args []js.Value) interface{} {
+
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return map[string]interface{}{
+			"error": "mehEval requires a string",
+		}
+	}
+
+	program, err := compile.NewProgram("eval", args[0].String())
+	if err != nil {
+		return map[string]interface{}{
+			"error": err.Error(),
+		}
+	}
+
+	result, err := program.Run(nil)
+	if err != nil {
+		return map[string]interface{}{
+			"error": err.Error(),
+		}
+	}
+
+	return map[string]interface{}{
+		"result": fmt.Sprint(values.ToGo(program.Top(), result)),
+	}
+}
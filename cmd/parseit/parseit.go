@@ -1,22 +0,0 @@
-package main
-
-import (
-	"log"
-	"os"
-
-	"github.com/pdk/meh/parser"
-)
-
-func main() {
-
-	p := parser.NewFromReader("stdin", os.Stdin)
-
-	// log.Printf("new parser: %v", p)
-
-	program := p.Parse()
-
-	// t, _ := json.MarshalIndent(program, "", "    ")
-	// fmt.Printf("%s", t)
-
-	log.Printf("program: %v", program)
-}
@@ -0,0 +1,39 @@
+package compile
+
+import "fmt"
+
+// aggregateFunc adapts binaryOps of two numbers to a builtin that combines
+// any number of numbers, given either as arguments, e.g. max(a, b, c), or as
+// a single list, e.g. sum(list). Numbers are coerced the same way as for
+// arithmetic operators: the result is an int if every number is an int, and a
+// float otherwise.
+func aggregateFunc(name string, ops binaryOps) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		nums, what := args, "argument"
+		if len(args) == 1 {
+			if list, ok := args[0].([]Value); ok {
+				nums, what = list, "element"
+			}
+		}
+
+		if len(nums) == 0 {
+			return nil, fmt.Errorf("%s: requires at least one number", name)
+		}
+
+		for i, v := range nums {
+			switch v.(type) {
+			case int64, float64:
+			default:
+				return nil, fmt.Errorf("%s: %s %d must be a number, received %s", name, what, i+1, TypeName(v))
+			}
+		}
+
+		result := nums[0]
+		for _, v := range nums[1:] {
+			result, _ = ops.apply(result, v)
+		}
+
+		return result, nil
+	}
+}
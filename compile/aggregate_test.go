@@ -0,0 +1,53 @@
+package compile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAggregates(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		want Value
+		err  string
+	}{
+		{`min(3, 1, 2)`, int64(1), ""},
+		{`max(3, 1, 2)`, int64(3), ""},
+		{`sum(3, 1, 2)`, int64(6), ""},
+		{`min(3, 1.5, 2)`, 1.5, ""},
+		{`max(3, 1.5)`, 3.0, ""},
+		{`sum(1, 0.5)`, 1.5, ""},
+		{`min(list(4, 2, 8))`, int64(2), ""},
+		{`max(list(4, 2.5))`, 4.0, ""},
+		{`sum(list(1, 2, 3))`, int64(6), ""},
+		{`sum(7)`, int64(7), ""},
+		{`max(list(7))`, int64(7), ""},
+		{`sum(list())`, nil, "sum: requires at least one number"},
+		{`min()`, nil, "min: requires at least one number"},
+		{`max(1, "2")`, nil, "max: argument 2 must be a number, received string"},
+		{`sum(list(1, 2, nil))`, nil, "sum: element 3 must be a number, received nil"},
+		{`min(list(1), 2)`, nil, "min: argument 1 must be a number, received list"},
+		{`abs(0 - 3)`, int64(3), ""},
+		{`abs(3)`, int64(3), ""},
+		{`abs(0 - 2.5)`, 2.5, ""},
+		{`abs("x")`, nil, "abs: argument 1 must be a number, received string"},
+		{`abs(1, 2)`, nil, "abs"},
+	} {
+		got, err := Eval(c.src, nil)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: got %v, want an error %q", c.src, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+}
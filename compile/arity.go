@@ -0,0 +1,127 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// The function of some calls is known as the program is compiled: a fn
+// literal called where it is written, or a name that a block assigns a fn
+// literal, and nothing else, called by the statements after the assignment.
+// Their arguments are counted then, so that passing the wrong number is a
+// compile error rather than a failure when, and if, the call runs.
+//
+// Names are dynamically scoped, so a call in the body of a function is not
+// counted against the name of the block defining it: the function may be
+// called where the name is something else.
+
+// ArityErrors returns an error for each call in the statements of a block
+// that passes the wrong number of arguments to a function known as the
+// program is compiled. The calls in the blocks nested in the statements,
+// e.g. of loops, are counted against the names the block assigns, but their
+// own fn literals are left to the errors of the nested block.
+func ArityErrors(stmts []parser.Node) diag.List {
+
+	var errs diag.List
+	for _, stmt := range stmts {
+		inspectBlock(stmt, false, func(n parser.Node) {
+			if n.Type().Match(lex.FuncApply) && len(n.Children) == 2 && n.Children[0].Type().Match(lex.Function) {
+				if err := arityError(n, n.Children[0]); err != nil {
+					errs = errs.Append(err, diag.Compile)
+				}
+			}
+		})
+	}
+
+	knownCalls(stmts, func(call, fn parser.Node) parser.Node {
+		if err := arityError(call, fn); err != nil {
+			errs = errs.Append(err, diag.Compile)
+		}
+		return call
+	})
+
+	return errs
+}
+
+// knownCalls calls f with each call in the statements of a block to a name
+// that the block assigns a fn literal, and nothing else, by an earlier
+// statement, and with the literal. It returns the statements with the calls
+// replaced by what f returns.
+func knownCalls(stmts []parser.Node, f func(call, fn parser.Node) parser.Node) []parser.Node {
+
+	assigned := make(map[string]int)
+	for _, stmt := range stmts {
+		inspectBlock(stmt, true, func(n parser.Node) {
+			if name, ok := assignedName(n); ok {
+				assigned[name]++
+			}
+		})
+	}
+
+	known := make(map[string]parser.Node)
+	replaced := make([]parser.Node, len(stmts))
+	for i, stmt := range stmts {
+		if len(known) > 0 {
+			stmt = parser.Walk(stmt, parser.Visitor{
+				Pre: func(n parser.Node) (parser.Node, bool) {
+					if n.Type().Match(lex.Function) {
+						return n, false
+					}
+					if n.Type().Match(lex.FuncApply) && len(n.Children) == 2 && n.Children[0].Type().Match(lex.Ident) {
+						if fn, ok := known[n.Children[0].Item.Value]; ok {
+							n = f(n, fn)
+						}
+					}
+					return n, true
+				},
+			})
+		}
+		replaced[i] = stmt
+
+		if name, ok := assignedName(stmt); ok && assigned[name] == 1 && stmt.Children[1].Type().Match(lex.Function) {
+			known[name] = stmt.Children[1]
+		}
+	}
+
+	return replaced
+}
+
+// inspectBlock calls f for each node of a statement that runs in the
+// context of its block: it stops at fn literals, and, unless nested is set,
+// at nested blocks.
+func inspectBlock(stmt parser.Node, nested bool, f func(parser.Node)) {
+	parser.Inspect(stmt, func(n parser.Node) bool {
+		if n.Type().Match(lex.Function) || (!nested && n.Type().Match(lex.LeftBrace)) {
+			return false
+		}
+		f(n)
+		return true
+	})
+}
+
+// assignedName returns the name a node assigns, if it is an assignment.
+func assignedName(n parser.Node) (string, bool) {
+	if !n.Type().Match(lex.Assign) || len(n.Children) != 2 || !n.Children[0].Type().Match(lex.Ident) {
+		return "", false
+	}
+	return n.Children[0].Item.Value, true
+}
+
+// arityError returns an error if a call passes the wrong number of arguments
+// to a fn literal. A malformed literal is left to its own error.
+func arityError(call, fn parser.Node) error {
+
+	if len(fn.Children) < 2 {
+		return nil
+	}
+
+	params, got := len(fn.Children[0].Children), len(call.Children[1].Children)
+	if got == params {
+		return nil
+	}
+
+	return call.Error(fmt.Errorf("failed to apply function: received %d arguments for %d parameters", got, params))
+}
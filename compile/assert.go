@@ -0,0 +1,47 @@
+package compile
+
+import "fmt"
+
+// The assert builtins stop the script with an error, reported at the
+// position of the call, when a check fails. A script of asserts serves as a
+// test: it passes when it runs to the end.
+
+// builtinAssert fails unless a condition is true: assert(cond) or
+// assert(cond, msg).
+func builtinAssert(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("assert", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	if ctx.IsTruthy(args[0]) {
+		return true, nil
+	}
+
+	if len(args) == 1 {
+		return nil, fmt.Errorf("assertion failed")
+	}
+
+	msg, err := stringArg("assert", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("assertion failed: %s", msg)
+}
+
+// builtinAssertEq fails unless two values are equal: assert_eq(got, want).
+// Lists, tuples, and maps are compared element by element.
+func builtinAssertEq(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("assert_eq", args, 2); err != nil {
+		return nil, err
+	}
+
+	if !Equal(args[0], args[1]) {
+		return nil, fmt.Errorf("assertion failed: %s %v != %s %v",
+			TypeName(args[0]), args[0], TypeName(args[1]), args[1])
+	}
+
+	return true, nil
+}
@@ -0,0 +1,209 @@
+package compile
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// builtins are the values available in every top context.
+var builtins = map[string]Value{
+	"type":    builtinType,
+	"format":  builtinFormat,
+	"match":   regexMatcher("match"),
+	"replace": regexReplacer("replace"),
+	"len":     builtinLen,
+	"list":    builtinList,
+	"dict":    builtinDict,
+	"int":     builtinInt,
+	"float":   builtinFloat,
+	"str":     builtinStr,
+	"bool":    builtinBool,
+	"strings": stringsModule,
+	"math":    mathModule,
+	"rand":    builtinRand,
+	"randint": builtinRandInt,
+	"shuffle": builtinShuffle,
+	"choice":  builtinChoice,
+
+	"now":         builtinNow,
+	"clock":       builtinClock,
+	"sleep":       builtinSleep,
+	"format_time": builtinFormatTime,
+	"parse_time":  builtinParseTime,
+
+	"re_match":   regexMatcher("re_match"),
+	"re_find":    builtinReFind,
+	"re_findall": builtinReFindAll,
+	"re_groups":  builtinReGroups,
+	"re_replace": regexReplacer("re_replace"),
+
+	"list_dir":  builtinListDir,
+	"exists":    builtinExists,
+	"is_dir":    builtinIsDir,
+	"mkdir":     builtinMkdir,
+	"remove":    builtinRemove,
+	"path_join": builtinPathJoin,
+	"path_base": builtinPathBase,
+	"path_dir":  builtinPathDir,
+
+	"read_line": builtinReadLine,
+	"read_all":  builtinReadAll,
+
+	"serve": builtinServe,
+	"exit":  builtinExit,
+	"error": builtinError,
+
+	"base64_encode": encoder("base64_encode", base64.StdEncoding.EncodeToString),
+	"base64_decode": decoder("base64_decode", base64.StdEncoding.DecodeString),
+	"hex_encode":    encoder("hex_encode", hex.EncodeToString),
+	"hex_decode":    decoder("hex_decode", hex.DecodeString),
+	"url_encode":    encoder("url_encode", urlEncode),
+	"url_decode":    decoder("url_decode", urlDecode),
+
+	"sort":    builtinSort,
+	"sort_by": builtinSortBy,
+	"map":     builtinMap,
+	"filter":  builtinFilter,
+	"reduce":  builtinReduce,
+
+	"zip":       builtinZip,
+	"enumerate": builtinEnumerate,
+	"range":     builtinRange,
+
+	"min": aggregateFunc("min", minOps),
+	"max": aggregateFunc("max", maxOps),
+	"sum": aggregateFunc("sum", sumOps),
+	"abs": mathAbs,
+
+	"assert":    builtinAssert,
+	"assert_eq": builtinAssertEq,
+
+	"log_debug": logger("log_debug", LogDebug),
+	"log_info":  logger("log_info", LogInfo),
+	"log_warn":  logger("log_warn", LogWarn),
+	"log_error": logger("log_error", LogError),
+}
+
+// expectArgs checks that a builtin received the number of arguments it
+// requires.
+func expectArgs(name string, args []Value, count int) error {
+	if len(args) != count {
+		return fmt.Errorf("%s: received %d arguments, requires %d", name, len(args), count)
+	}
+	return nil
+}
+
+// stringArg returns the i'th argument of a builtin as a string.
+func stringArg(name string, args []Value, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: argument %d must be a string, received %s", name, i+1, TypeName(args[i]))
+	}
+	return s, nil
+}
+
+// intArg returns the i'th argument of a builtin as an int.
+func intArg(name string, args []Value, i int) (int64, error) {
+	n, ok := args[i].(int64)
+	if !ok {
+		return 0, fmt.Errorf("%s: argument %d must be an int, received %s", name, i+1, TypeName(args[i]))
+	}
+	return n, nil
+}
+
+// listArg returns the i'th argument of a builtin as a list.
+func listArg(name string, args []Value, i int) ([]Value, error) {
+	list, ok := args[i].([]Value)
+	if !ok {
+		return nil, fmt.Errorf("%s: argument %d must be a list, received %s", name, i+1, TypeName(args[i]))
+	}
+	return list, nil
+}
+
+// fnArg returns the i'th argument of a builtin as a function.
+func fnArg(name string, args []Value, i int) (func(*Context, ...Value) (Value, error), error) {
+	fn, ok := Callable(args[i])
+	if !ok {
+		return nil, fmt.Errorf("%s: argument %d must be a fn, received %s", name, i+1, TypeName(args[i]))
+	}
+	return fn, nil
+}
+
+// callback calls a script function on behalf of a builtin, and returns the
+// value it produced.
+func (ctx *Context) callback(fn func(*Context, ...Value) (Value, error), args ...Value) (Value, error) {
+
+	res, err := apply(ctx, fn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return Result(res), nil
+}
+
+// expectArgRange checks that a builtin received between min and max
+// arguments.
+func expectArgRange(name string, args []Value, min, max int) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("%s: received %d arguments, requires %d to %d", name, len(args), min, max)
+	}
+	return nil
+}
+
+// builtinType returns the name of the type of its argument.
+func builtinType(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("type", args, 1); err != nil {
+		return nil, err
+	}
+
+	return TypeName(args[0]), nil
+}
+
+// builtinLen returns the length of a string (in runes), list, map, or tuple.
+func builtinLen(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("len", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch x := args[0].(type) {
+	case string:
+		return int64(utf8.RuneCountInString(x)), nil
+	case []Value:
+		return int64(len(x)), nil
+	case map[string]Value:
+		return int64(len(x)), nil
+	case Tuple:
+		return int64(len(x.Values)), nil
+	}
+
+	return nil, fmt.Errorf("len: cannot take the length of %s", TypeName(args[0]))
+}
+
+// builtinList returns a list of its arguments.
+func builtinList(ctx *Context, args ...Value) (Value, error) {
+	return append([]Value{}, args...), nil
+}
+
+// builtinDict returns a map of alternating keys and values, e.g.
+// dict("a", 1, "b", 2).
+func builtinDict(ctx *Context, args ...Value) (Value, error) {
+
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("dict: requires pairs of keys and values, received %d arguments", len(args))
+	}
+
+	m := make(map[string]Value, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: keys must be strings, received %s", TypeName(args[i]))
+		}
+		m[key] = args[i+1]
+	}
+
+	return m, nil
+}
@@ -0,0 +1,90 @@
+package compile
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMaxDepth(t *testing.T) {
+
+	for _, src := range []string{
+		`f = fn(n) { return f(n + 1) }; f(0)`,
+		`(fn(f) { f(f) })(fn(f) { f(f) })`,
+	} {
+		program, err := NewProgram("depth", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program.Top().SetMaxDepth(100)
+
+		if _, err := program.Run(nil); !errors.Is(err, ErrCallDepth) {
+			t.Errorf("%s: got %v, want ErrCallDepth", src, err)
+		}
+	}
+
+	program, err := NewProgram("depth", `f = fn(n) { n == 0 && return 0; return 1 + f(n - 1) }; f(100)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program.Top().SetMaxDepth(101)
+
+	if v, err := program.Run(nil); err != nil || v != int64(100) {
+		t.Errorf("got %v, %v, want 100", v, err)
+	}
+}
+
+// BenchmarkFuncApply calls a function of a script, whose arguments are
+// evaluated into a buffer of the calling frame. Its body has two statements,
+// so that the call is made, rather than inlined.
+func BenchmarkFuncApply(b *testing.B) {
+	benchScript(b, `
+add = fn(a, b, c) { s = a + b; return s + c }
+i = 0
+do {
+	add(i, 2, 3)
+	i = i + 1
+} until i >= 100
+`)
+}
+
+// BenchmarkBuiltinApply calls builtins, nested, so that the argument buffers
+// of the calls overlap.
+func BenchmarkBuiltinApply(b *testing.B) {
+	benchScript(b, `
+i = 0
+do {
+	max(abs(i), min(i, 3), 2)
+	i = i + 1
+} until i >= 100
+`)
+}
+
+// BenchmarkBlock loops over a block, whose tuple is made once, for the
+// last iteration.
+func BenchmarkBlock(b *testing.B) {
+	benchScript(b, `
+i = 0
+do {
+	j = i * 2
+	i = i + 1
+} until i >= 100
+`)
+}
+
+// benchScript compiles a script once, and runs it for each op.
+func benchScript(b *testing.B, src string) {
+
+	program, err := NewProgram("bench", src)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := program.Run(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package compile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Capability is a kind of access to the host that builtins may need. Values
+// may be combined, e.g. FS|Net.
+type Capability uint
+
+// The capabilities checked by builtins.
+const (
+	// FS allows reading and changing the filesystem.
+	FS Capability = 1 << iota
+	// Net allows network access, e.g. serving HTTP.
+	Net
+	// Exec allows running other programs.
+	Exec
+	// Env allows reading the environment variables.
+	Env
+	// Stdin allows reading the standard input of the process. Input given
+	// with SetInput may be read without it.
+	Stdin
+
+	// AllCapabilities allows everything, as the meh command does.
+	AllCapabilities = FS | Net | Exec | Env | Stdin
+)
+
+var capabilityNames = []string{"fs", "net", "exec", "env", "stdin"}
+
+func (c Capability) String() string {
+
+	names := []string{}
+	for i, name := range capabilityNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "|")
+}
+
+// ErrNotAllowed is the error, wrapped with the builtin and capability, that
+// stops a run when a builtin needs a capability that was not allowed.
+var ErrNotAllowed = errors.New("not allowed")
+
+// Allow grants capabilities to the builtins. A new context tree has none, so
+// that scripts from untrusted sources cannot reach the host. The setting
+// applies to the whole context tree.
+func (ctx *Context) Allow(caps ...Capability) {
+	for _, c := range caps {
+		ctx.env.allowed |= c
+	}
+}
+
+// Allowed checks if a capability has been granted.
+func (ctx *Context) Allowed(c Capability) bool {
+	return ctx.env.allowed&c == c
+}
+
+// require checks that a builtin has been granted a capability.
+func (ctx *Context) require(name string, c Capability) error {
+	if !ctx.Allowed(c) {
+		return fmt.Errorf("%s: %w: requires %s", name, ErrNotAllowed, c)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package compile
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCapabilitiesDenied(t *testing.T) {
+
+	for _, src := range []string{
+		`list_dir(".")`,
+		`exists("capability.go")`,
+		`is_dir(".")`,
+		`mkdir("never")`,
+		`remove("never")`,
+		`serve(":0", fn(req) { "" })`,
+		`read_line()`,
+		`read_all()`,
+	} {
+		program, err := NewProgram("caps", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// asking for the input, as a host may, does not give it to scripts.
+		program.Top().Input()
+
+		if _, err := program.Run(nil); !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("%s: got %v, want ErrNotAllowed", src, err)
+		}
+	}
+}
+
+func TestCapabilitiesAllowed(t *testing.T) {
+
+	program, err := NewProgram("caps", `list(exists("capability.go"), read_line(), read_all())`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program.Top().Allow(FS)
+	program.Top().SetInput(strings.NewReader("one\ntwo\n"))
+
+	v, err := program.Run(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Value{true, "one", "two\n"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("got %v, want %v", v, want)
+	}
+
+	if got, want := (FS | Stdin).String(), "fs|stdin"; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package compile
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Compare orders two values, returning -1, 0, or 1. Numbers compare with
+// numbers (ints are promoted to floats when mixed), strings with strings,
+// bools with bools (false before true), and a Comparer with what it accepts.
+// Other combinations cannot be compared.
+func Compare(a, b Value) (int, error) {
+
+	if i, j, ok := gotInts(a, b); ok {
+		return compareOrdered(i < j, i > j), nil
+	}
+
+	if i, j, ok := gotFloats(a, b); ok {
+		return compareOrdered(i < j, i > j), nil
+	}
+
+	if i, j, ok := gotStrings(a, b); ok {
+		return compareOrdered(i < j, i > j), nil
+	}
+
+	if i, ok := a.(bool); ok {
+		if j, ok := b.(bool); ok {
+			return compareOrdered(!i && j, i && !j), nil
+		}
+	}
+
+	if c, ok, err := compareValues(a, b); ok {
+		return c, err
+	}
+
+	return 0, fmt.Errorf("cannot compare %s and %s", TypeName(a), TypeName(b))
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// Equal checks if two values are equal. Numbers are equal by value (ints are
+// promoted to floats when mixed), lists, tuples, and maps are equal when
+// their elements are, times are equal when they are the same instant, and a
+// Comparer is equal to what it compares equal to.
+func Equal(a, b Value) bool {
+
+	if i, j, ok := gotInts(a, b); ok {
+		return i == j
+	}
+
+	if i, j, ok := gotFloats(a, b); ok {
+		return i == j
+	}
+
+	if c, ok, err := compareValues(a, b); ok {
+		return err == nil && c == 0
+	}
+
+	switch x := a.(type) {
+	case []Value:
+		y, ok := b.([]Value)
+		return ok && equalValues(x, y)
+	case Tuple:
+		y, ok := b.(Tuple)
+		if !ok || len(x.Values) != len(y.Values) {
+			return false
+		}
+		for i := range x.Values {
+			if !Equal(x.Values[i], y.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]Value:
+		y, ok := b.(map[string]Value)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	case Record:
+		y, ok := b.(Record)
+		return ok && reflect.DeepEqual(x.Interface(), y.Interface())
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func equalValues(a, b []Value) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
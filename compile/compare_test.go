@@ -0,0 +1,29 @@
+package compile
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEqualIntsPastFloats(t *testing.T) {
+
+	for _, c := range []struct {
+		a, b Value
+		want bool
+	}{
+		{int64(9007199254740993), int64(9007199254740992), false},
+		{int64(math.MaxInt64), int64(math.MaxInt64 - 1), false},
+		{int64(math.MaxInt64), int64(math.MaxInt64), true},
+		{int64(2), 2.0, true},
+		{2.5, int64(2), false},
+		{[]Value{int64(9007199254740993)}, []Value{int64(9007199254740992)}, false},
+	} {
+		if got := Equal(c.a, c.b); got != c.want {
+			t.Errorf("Equal(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+
+	if _, err := builtinAssertEq(NewTopContext(), int64(9007199254740993), int64(9007199254740992)); err == nil {
+		t.Errorf("assert_eq(9007199254740993, 9007199254740992) passed")
+	}
+}
@@ -1,16 +1,21 @@
 package compile
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
+	"github.com/pdk/meh/diag"
 	"github.com/pdk/meh/lex"
 	"github.com/pdk/meh/parser"
 )
 
 // Convert a parse tree to an executable function
 
-// Expr is a thing that can be evaluated.
+// Expr is a thing that can be evaluated. An Expr called as a function, e.g.
+// a builtin, must not keep its arguments, the slice, or its context after it
+// returns, as the caller may reuse them; it copies the arguments to keep
+// them, as list does.
 type Expr func(*Context, ...Value) (Value, error)
 
 // Noop is a no-operation Expr.
@@ -32,6 +37,60 @@ type binaryOps struct {
 	stringOp func(string, string) Value
 }
 
+// operators are the binaryOps of the arithmetic and comparison operators.
+var operators = map[lex.Type]binaryOps{
+	lex.Plus: {
+		intOp:    func(i, j int64) Value { return i + j },
+		floatOp:  func(i, j float64) Value { return i + j },
+		stringOp: func(i, j string) Value { return i + j },
+	},
+	lex.Minus: {
+		intOp:   func(i, j int64) Value { return i - j },
+		floatOp: func(i, j float64) Value { return i - j },
+	},
+	lex.Mult: {
+		intOp:   func(i, j int64) Value { return i * j },
+		floatOp: func(i, j float64) Value { return i * j },
+	},
+	lex.Div: {
+		intOp:   func(i, j int64) Value { return i / j },
+		floatOp: func(i, j float64) Value { return i / j },
+	},
+	lex.Modulo: {
+		intOp: func(i, j int64) Value { return i % j },
+	},
+	lex.Equal: {
+		intOp:    func(i, j int64) Value { return i == j },
+		floatOp:  func(i, j float64) Value { return i == j },
+		stringOp: func(i, j string) Value { return i == j },
+	},
+	lex.NotEqual: {
+		intOp:    func(i, j int64) Value { return i != j },
+		floatOp:  func(i, j float64) Value { return i != j },
+		stringOp: func(i, j string) Value { return i != j },
+	},
+	lex.Greater: {
+		intOp:    func(i, j int64) Value { return i > j },
+		floatOp:  func(i, j float64) Value { return i > j },
+		stringOp: func(i, j string) Value { return i > j },
+	},
+	lex.GreaterOrEqual: {
+		intOp:    func(i, j int64) Value { return i >= j },
+		floatOp:  func(i, j float64) Value { return i >= j },
+		stringOp: func(i, j string) Value { return i >= j },
+	},
+	lex.Less: {
+		intOp:    func(i, j int64) Value { return i < j },
+		floatOp:  func(i, j float64) Value { return i < j },
+		stringOp: func(i, j string) Value { return i < j },
+	},
+	lex.LessOrEqual: {
+		intOp:    func(i, j int64) Value { return i <= j },
+		floatOp:  func(i, j float64) Value { return i <= j },
+		stringOp: func(i, j string) Value { return i <= j },
+	},
+}
+
 func init() {
 	compilerForType = [lex.TypeCount]CompilerFunc{
 		lex.LeftBrace:         compileBlock,
@@ -39,8 +98,8 @@ func init() {
 		lex.Nil:               fixedValue(nil),
 		lex.True:              fixedValue(true),
 		lex.False:             fixedValue(false),
-		lex.Continue:          fixedValue(NewContinue()),
-		lex.Break:             fixedValue(NewBreak()),
+		lex.Continue:          compileContinue,
+		lex.Break:             compileBreak,
 		lex.Return:            compileReturn,
 		lex.Function:          compileFunction,
 		lex.FuncApply:         compileFuncApply,
@@ -49,92 +108,47 @@ func init() {
 		lex.BacktickString:    compileString,
 		lex.DoubleQuoteString: compileString,
 		lex.SingleQuoteString: compileString,
+		lex.Regex:             compileRegex,
 		lex.And:               compileAnd,
 		lex.Or:                compileOr,
-		lex.Plus: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:    func(i, j int64) Value { return i + j },
-				floatOp:  func(i, j float64) Value { return i + j },
-				stringOp: func(i, j string) Value { return i + j },
-			})
-		},
-		lex.Minus: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:   func(i, j int64) Value { return i - j },
-				floatOp: func(i, j float64) Value { return i - j },
-			})
-		},
-		lex.Mult: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:   func(i, j int64) Value { return i * j },
-				floatOp: func(i, j float64) Value { return i * j },
-			})
-		},
-		lex.Div: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:   func(i, j int64) Value { return i / j },
-				floatOp: func(i, j float64) Value { return i / j },
-			})
-		},
-		lex.Modulo: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp: func(i, j int64) Value { return i % j },
-			})
-		},
-		lex.Equal: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:    func(i, j int64) Value { return i == j },
-				floatOp:  func(i, j float64) Value { return i == j },
-				stringOp: func(i, j string) Value { return i == j },
-			})
-		},
-		lex.NotEqual: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:    func(i, j int64) Value { return i != j },
-				floatOp:  func(i, j float64) Value { return i != j },
-				stringOp: func(i, j string) Value { return i != j },
-			})
-		},
-		lex.Greater: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:    func(i, j int64) Value { return i > j },
-				floatOp:  func(i, j float64) Value { return i > j },
-				stringOp: func(i, j string) Value { return i > j },
-			})
-		},
-		lex.GreaterOrEqual: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:    func(i, j int64) Value { return i >= j },
-				floatOp:  func(i, j float64) Value { return i >= j },
-				stringOp: func(i, j string) Value { return i >= j },
-			})
-		},
-		lex.Less: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:    func(i, j int64) Value { return i < j },
-				floatOp:  func(i, j float64) Value { return i < j },
-				stringOp: func(i, j string) Value { return i < j },
-			})
-		},
-		lex.LessOrEqual: func(node parser.Node) (Expr, error) {
-			return compileBinaryOp(node, binaryOps{
-				intOp:    func(i, j int64) Value { return i <= j },
-				floatOp:  func(i, j float64) Value { return i <= j },
-				stringOp: func(i, j string) Value { return i <= j },
-			})
-		},
+		lex.Is:                compileIs,
+		lex.Until:             compileDoUntil,
+		lex.Dot:               compileDot,
+		lex.Plus:              compileOperator,
+		lex.Minus:             compileOperator,
+		lex.Mult:              compileOperator,
+		lex.Div:               compileOperator,
+		lex.Modulo:            compileOperator,
+		lex.Equal:             compileOperator,
+		lex.NotEqual:          compileOperator,
+		lex.Greater:           compileOperator,
+		lex.GreaterOrEqual:    compileOperator,
+		lex.Less:              compileOperator,
+		lex.LessOrEqual:       compileOperator,
 	}
 }
 
 // Compile converts a parsed Node into an Expr.
 func Compile(node parser.Node) (Expr, error) {
 
-	c := compilerForType[node.Type()]
+	var c CompilerFunc
+	if t := node.Type(); t < lex.TypeCount {
+		c = compilerForType[t]
+	} else if handler, ok := CustomOperator(t); ok {
+		c = func(node parser.Node) (Expr, error) {
+			return compileCustomOperator(node, handler)
+		}
+	}
 	if c == nil {
-		return nil, fmt.Errorf("cannot compile %s", node)
+		return nil, node.Error(fmt.Errorf("cannot compile %s", node))
 	}
 
-	return c(node)
+	e, err := c(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return metered(node, e), nil
 }
 
 func compileReturn(node parser.Node) (Expr, error) {
@@ -159,8 +173,34 @@ func compileReturn(node parser.Node) (Expr, error) {
 	}, nil
 }
 
+func compileBreak(node parser.Node) (Expr, error) {
+
+	if len(node.Children) == 0 {
+		return valFunc(NewBreak()), nil
+	}
+
+	return valFunc(NewLabeledBreak(node.Children[0].Item.Value)), nil
+}
+
+func compileContinue(node parser.Node) (Expr, error) {
+
+	if len(node.Children) == 0 {
+		return valFunc(NewContinue()), nil
+	}
+
+	return valFunc(NewLabeledContinue(node.Children[0].Item.Value)), nil
+}
+
 func compileFuncApply(node parser.Node) (Expr, error) {
 
+	// a third child is the fn literal of a tiny function known by name, from
+	// inlineCalls.
+	callee := node.Children[0]
+	if len(node.Children) == 3 {
+		callee = node.Children[2]
+		node.Children = node.Children[:2]
+	}
+
 	fn, err := Compile(node.Children[0])
 	if err != nil {
 		return nil, err
@@ -176,48 +216,122 @@ func compileFuncApply(node parser.Node) (Expr, error) {
 		args = append(args, next)
 	}
 
-	return func(ctx *Context, vals ...Value) (Value, error) {
+	name := CallName(node)
+
+	invoke := func(ctx *Context, vals ...Value) (Value, error) {
 
 		fnVal, err := fn(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		expr, ok := fnVal.(func(*Context, ...Value) (Value, error))
+		expr, ok := Callable(fnVal)
 		if !ok {
-			return nil, fmt.Errorf("cannot invoke non-function: %T %v", fnVal, fnVal)
+			return nil, node.Error(notCallable(fnVal))
 		}
 
-		argValues := []Value{}
-		for _, a := range args {
+		argValues, mark := ctx.pushArgs(len(args))
+		for i, a := range args {
 			nextVal, err := a(ctx)
 			if err != nil {
+				ctx.popArgs(mark)
 				return nil, err
 			}
 
-			argValues = append(argValues, nextVal)
+			argValues[i] = nextVal
 		}
 
-		res, err := expr(ctx, argValues...)
+		call, err := ctx.EnterCall(name, node.Item)
+		if err != nil {
+			ctx.popArgs(mark)
+			return nil, node.Error(err)
+		}
+		res, err := apply(call, expr, argValues)
+		ctx.popArgs(mark)
+		if err == nil {
+			err = ctx.Account(res)
+		}
 		if err != nil {
+			err = call.Traced(positioned(node, err))
+			call.ExitCall()
 			return nil, err
 		}
+		call.ExitCall()
 
-		if retVal, ok := res.(FlowChange); ok {
-			if retVal.Type == Return {
-				return retVal.Value, nil
-			}
+		return res, nil
+	}
 
-			return nil, fmt.Errorf("FuncApply received non-return flow control change: %v", res)
+	if body, returns, ok := inlineBody(node, callee); ok {
+		return compileInline(node, body, returns, invoke)
+	}
+
+	return invoke, nil
+}
+
+// Call applies a function value to arguments, as a script's `f(x)` would.
+// This is how builtins call back into script functions.
+func (ctx *Context) Call(fn Value, args ...Value) (Value, error) {
+
+	expr, ok := Callable(fn)
+	if !ok {
+		return nil, notCallable(fn)
+	}
+
+	return apply(ctx, expr, args)
+}
+
+// apply invokes a function, and unwraps the value of a return.
+func apply(ctx *Context, fn func(*Context, ...Value) (Value, error), args []Value) (Value, error) {
+
+	res, err := fn(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if retVal, ok := res.(FlowChange); ok {
+		if retVal.Type == Return {
+			return retVal.Value, nil
 		}
 
-		return res, err
-	}, nil
+		return nil, fmt.Errorf("FuncApply received non-return flow control change: %v", res)
+	}
+
+	return res, nil
+}
+
+// Result returns the value a function or program produced. A block produces
+// a tuple of (true, value of the last statement), which is unwrapped.
+func Result(v Value) Value {
+
+	if t, ok := v.(Tuple); ok && len(t.Values) == 2 && t.Values[0] == true {
+		return t.Values[1]
+	}
+
+	return v
+}
+
+// positioned gives an error the position of node, unless the error already
+// carries a position.
+func positioned(node parser.Node, err error) error {
+
+	var ierr lex.ItemError
+	if errors.As(err, &ierr) {
+		return err
+	}
+
+	var exit Exit
+	if errors.As(err, &exit) {
+		return err
+	}
+
+	return node.Error(err)
 }
 
 func compileFunction(node parser.Node) (Expr, error) {
 
-	if len(node.Children) != 2 {
+	// a third child is the return type annotation, which is not enforced at
+	// runtime.
+	if len(node.Children) != 2 && len(node.Children) != 3 {
 		return nil, node.Error(fmt.Errorf("malformed function: requires param list & body"))
 	}
 
@@ -231,11 +345,22 @@ func compileFunction(node parser.Node) (Expr, error) {
 		return nil, node.Error(fmt.Errorf("malformed function: requires block"))
 	}
 
+	if errs := LabelErrors(body); len(errs) > 0 {
+		return nil, errs
+	}
+
+	frame, body := resolveLocals(params, body)
+
 	block, err := Compile(body)
 	if err != nil {
 		return nil, err
 	}
 
+	paramSlots := make([]int, len(params))
+	for i, p := range params {
+		paramSlots[i] = frame.slots[p]
+	}
+
 	return func(ctx *Context, vals ...Value) (Value, error) {
 		return func(ctx *Context, vals ...Value) (Value, error) {
 
@@ -243,15 +368,15 @@ func compileFunction(node parser.Node) (Expr, error) {
 				return nil, fmt.Errorf("failed to apply function: received %d arguments for %d parameters", len(vals), len(params))
 			}
 
-			funcCtx := NewContext(ctx)
-			for i, p := range params {
-				_, err := funcCtx.Set(p, vals[i])
-				if err != nil {
-					return nil, err
-				}
+			funcCtx := newFrame(ctx, frame)
+			for i, slot := range paramSlots {
+				funcCtx.slots[slot] = vals[i]
 			}
 
-			return block(funcCtx)
+			res, err := block(funcCtx)
+			funcCtx.releaseFrame()
+
+			return res, err
 		}, nil
 	}, nil
 }
@@ -264,6 +389,11 @@ func parameterNames(node parser.Node) ([]string, error) {
 
 	names := []string{}
 	for _, next := range node.Children {
+		// drop type annotations, e.g. `a: int`
+		if next.Type().Match(lex.Colon) && len(next.Children) == 2 {
+			next = next.Children[0]
+		}
+
 		if !next.Type().Match(lex.Ident) {
 			return nil, node.Error(fmt.Errorf("malformed function, parameters must be identifiers, found %v", next))
 		}
@@ -298,11 +428,58 @@ func compileAssign(node parser.Node) (Expr, error) {
 			return nil, err
 		}
 
+		if lhs.Slot > 0 {
+			return ctx.setSlot(lhs.Slot-1, left, val)
+		}
+
 		return ctx.Set(left, val)
 
 	}, nil
 }
 
+// compileDot compiles member access, e.g. `m.name`.
+func compileDot(node parser.Node) (Expr, error) {
+
+	left, err := Compile(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+
+	name := node.Children[1].Item.Value
+
+	return func(ctx *Context, vals ...Value) (Value, error) {
+		lVal, err := left(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := Member(lVal, name)
+		if err != nil {
+			return nil, node.Error(err)
+		}
+
+		return v, nil
+	}, nil
+}
+
+// Member returns a member of a map or record, as a script's `v.name` would.
+func Member(v Value, name string) (Value, error) {
+
+	switch x := v.(type) {
+	case map[string]Value:
+		return x[name], nil
+	case Record:
+		if m, ok := x.Field(name); ok {
+			return m, nil
+		}
+		return nil, fmt.Errorf("record has no field or method %s", name)
+	case Indexer:
+		return x.Index(name)
+	}
+
+	return nil, fmt.Errorf("cannot access .%s of %s", name, TypeName(v))
+}
+
 func compileAnd(node parser.Node) (Expr, error) {
 
 	left, err := Compile(node.Children[0])
@@ -320,8 +497,8 @@ func compileAnd(node parser.Node) (Expr, error) {
 			return nil, err
 		}
 
-		if !isTruthy(lVal) {
-			return lVal, nil
+		if !ctx.IsTruthy(lVal) {
+			return ctx.LogicResult(lVal), nil
 		}
 
 		rVal, err := right(ctx)
@@ -329,7 +506,7 @@ func compileAnd(node parser.Node) (Expr, error) {
 			return nil, err
 		}
 
-		return rVal, nil
+		return ctx.LogicResult(rVal), nil
 	}, nil
 }
 
@@ -349,8 +526,8 @@ func compileOr(node parser.Node) (Expr, error) {
 			return nil, err
 		}
 
-		if isTruthy(lVal) {
-			return lVal, nil
+		if ctx.IsTruthy(lVal) {
+			return ctx.LogicResult(lVal), nil
 		}
 
 		rVal, err := right(ctx)
@@ -358,26 +535,33 @@ func compileOr(node parser.Node) (Expr, error) {
 			return nil, err
 		}
 
-		return rVal, nil
+		return ctx.LogicResult(rVal), nil
 	}, nil
 }
 
-// isTruthy returns the boolean value of a boolean input. For a tuple, return
-// isTruthy of the first element in the tuple. Everything else is true.
-func isTruthy(v Value) bool {
+func compileIs(node parser.Node) (Expr, error) {
 
-	if b, ok := v.(bool); ok {
-		return b
+	left, err := Compile(node.Children[0])
+	if err != nil {
+		return nil, err
 	}
 
-	if t, ok := v.(Tuple); ok {
-		return isTruthy(t.Values[0])
+	name := node.Children[1].Item.Value
+	if !IsTypeName(name) {
+		return nil, node.Error(fmt.Errorf("unknown type name %q", name))
 	}
 
-	return true
+	return func(ctx *Context, vals ...Value) (Value, error) {
+		lVal, err := left(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return TypeName(lVal) == name, nil
+	}, nil
 }
 
-func compileBinaryOp(node parser.Node, ops binaryOps) (Expr, error) {
+func compileOperator(node parser.Node) (Expr, error) {
 
 	left, err := Compile(node.Children[0])
 	if err != nil {
@@ -388,6 +572,8 @@ func compileBinaryOp(node parser.Node, ops binaryOps) (Expr, error) {
 		return nil, err
 	}
 
+	op := node.Type()
+
 	return func(ctx *Context, vals ...Value) (Value, error) {
 		lVal, err := left(ctx)
 		if err != nil {
@@ -398,26 +584,68 @@ func compileBinaryOp(node parser.Node, ops binaryOps) (Expr, error) {
 			return nil, err
 		}
 
-		if ops.intOp != nil {
-			if v1, v2, ok := gotInts(lVal, rVal); ok {
-				return ops.intOp(v1, v2), nil
-			}
+		result, err := Operate(op, lVal, rVal)
+		if err == nil {
+			err = ctx.Account(result)
+		}
+		if err != nil {
+			return nil, positioned(node, err)
 		}
 
-		if ops.floatOp != nil {
-			if v1, v2, ok := gotFloats(lVal, rVal); ok {
-				return ops.floatOp(v1, v2), nil
-			}
+		return result, nil
+	}, nil
+}
+
+// ErrDivideByZero is the error of dividing an int by zero, with / or %.
+var ErrDivideByZero = errors.New("integer divide by zero")
+
+// Operate applies an arithmetic or comparison operator, e.g. lex.Plus, to
+// two values, as a script's `a + b` would, including values implementing
+// Adder, Comparer, and so on.
+func Operate(op lex.Type, lVal, rVal Value) (Value, error) {
+
+	if op == lex.Div || op == lex.Modulo {
+		if _, j, ok := gotInts(lVal, rVal); ok && j == 0 {
+			return nil, ErrDivideByZero
 		}
+	}
 
-		if ops.stringOp != nil {
-			if v1, v2, ok := gotStrings(lVal, rVal); ok {
-				return ops.stringOp(v1, v2), nil
-			}
+	if ops, ok := operators[op]; ok {
+		if result, ok := ops.apply(lVal, rVal); ok {
+			return result, nil
 		}
+	}
 
-		return nil, node.Error(fmt.Errorf("cannot apply operator to argument types %T, %T", lVal, rVal))
-	}, nil
+	if result, ok, err := operateValues(op, lVal, rVal); ok {
+		return result, err
+	}
+
+	return nil, fmt.Errorf("cannot apply operator to argument types %T, %T", lVal, rVal)
+}
+
+// apply applies the first of the operations that suits the types of the
+// arguments: ints, then floats (ints are promoted), then strings.
+func (ops binaryOps) apply(lVal, rVal Value) (Value, bool) {
+
+	if ops.intOp != nil {
+		if v1, v2, ok := gotInts(lVal, rVal); ok {
+			return ops.intOp(v1, v2), true
+		}
+	}
+
+	if ops.floatOp != nil {
+		if v1, v2, ok := gotFloats(lVal, rVal); ok {
+			return ops.floatOp(v1, v2), true
+		}
+	}
+
+	if ops.stringOp != nil {
+		if v1, v2, ok := gotStrings(lVal, rVal); ok {
+			return ops.stringOp(v1, v2), true
+		}
+	}
+
+	return nil, false
 }
 
 func gotInts(i, j interface{}) (int64, int64, bool) {
@@ -471,25 +699,80 @@ func gotStrings(i, j Value) (string, string, bool) {
 	return "", "", false
 }
 
+// compileBlock compiles a block, whose value is the tuple (true, value of
+// the last statement), or the change of flow that ended it.
 func compileBlock(node parser.Node) (Expr, error) {
 
+	statements, err := compileStatements(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx *Context, vals ...Value) (Value, error) {
+
+		lastVal, err := statements(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if flowChange(lastVal) != None {
+			return lastVal, nil
+		}
+
+		return NewTuple(true, lastVal), nil
+	}, nil
+}
+
+// compileStatements compiles the statements of a block, less those Prune
+// drops, to an Expr producing the value of the last statement, without the
+// tuple of a block, e.g. for a loop, which makes the tuple for its last
+// iteration only. It compiles every statement, even after one fails, so that
+// all the errors in a script are reported together, as a diag.List, with
+// those of the calls ArityErrors finds. The calls of tiny functions are
+// inlined. Unreachable statements are compiled for their errors only.
+func compileStatements(node parser.Node) (Expr, error) {
+
 	stmts := []Expr{}
+	var errs diag.List
 
-	for _, n := range node.Children {
+	kept, pruned := Prune(node.Children)
+	kept = inlineCalls(kept)
+
+	for _, n := range kept {
 		e, err := Compile(n)
 		if err != nil {
-			return nil, err
+			errs = errs.Append(err, diag.Compile)
+			continue
 		}
 
 		stmts = append(stmts, e)
 	}
 
+	for _, n := range pruned.Unreachable {
+		if _, err := Compile(n); err != nil {
+			errs = errs.Append(err, diag.Compile)
+		}
+	}
+
+	errs = append(errs, ArityErrors(node.Children)...)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	return func(ctx *Context, vals ...Value) (Value, error) {
 
 		var lastVal interface{}
 		var err error
 
-		for _, e := range stmts {
+		for i, e := range stmts {
+			if err := ctx.Interrupted(); err != nil {
+				return nil, kept[i].Error(err)
+			}
+
+			if ctx.hook != nil {
+				ctx.hook(ctx, kept[i])
+			}
+
 			lastVal, err = e(ctx)
 			if err != nil {
 				return nil, err
@@ -499,7 +782,7 @@ func compileBlock(node parser.Node) (Expr, error) {
 			}
 		}
 
-		return NewTuple(true, lastVal), nil
+		return lastVal, nil
 	}, nil
 }
 
@@ -516,11 +799,21 @@ func fixedValue(val Value) func(node parser.Node) (Expr, error) {
 }
 
 func compileIdent(node parser.Node) (Expr, error) {
+
+	if node.Slot > 0 {
+		slot, name := node.Slot-1, node.Item.Value
+		return func(ctx *Context, args ...Value) (Value, error) {
+			return ctx.getSlot(slot, name), nil
+		}, nil
+	}
+
 	return func(ctx *Context, args ...Value) (Value, error) {
 		return ctx.Get(node.Item.Value), nil
 	}, nil
 }
 
+// compileNumber compiles a number literal: an int, unless it has a point,
+// e.g. 1.5, .5, or 5., which makes it a float.
 func compileNumber(node parser.Node) (Expr, error) {
 
 	i, err := strconv.ParseInt(node.Item.Value, 10, 64)
@@ -1,44 +1,304 @@
 package compile
 
-// Context is the current name->value map.
+import (
+	"bufio"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Context is the current name->value map. The context of a function call
+// holds the function's own names in slots, as resolved when it was compiled.
+//
+// A Context is safe for concurrent use, so a compiled program may be run by
+// several goroutines at once, e.g. one per HTTP request. Each run should have
+// its own child context, NewContext(top), since assignments are made in the
+// context a program runs in: runs in separate children do not see each
+// other's names, while all of them see the names of the top context. The
+// settings (SetTruthiness, Seed, SetInput, and so on) should be made before
+// any run starts.
 type Context struct {
-	values map[string]Value
-	parent *Context
+	mu       sync.RWMutex
+	values   map[string]Value
+	parent   *Context
+	env      *environment
+	goCtx    context.Context
+	fuel     *int64
+	limits   *limiter
+	profile  *Profile
+	coverage *Coverage
+	hook     Hook
+	frame    *Frame
+
+	// the frame of a function call, its names resolved to slots, and the
+	// arguments of the calls it is making.
+	layout   *layout
+	slots    []Value
+	argStack []Value
+
+	// what holds the context, if it is reused once its call returns.
+	recycle interface{}
+
+	resolver func(name string) (Value, bool)
+}
+
+// environment holds the settings shared by a top context and every context
+// descended from it.
+type environment struct {
+	truthiness  Truthiness
+	strictLogic bool
+	lang        int
+	started     time.Time
+	logLevel    LogLevel
+	allowed     Capability
+	maxDepth    int
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	inputMu    sync.Mutex
+	input      *bufio.Reader
+	inputGiven bool // whether input was given with SetInput, not stdin
+
+	logMu     sync.Mutex
+	logOutput io.Writer
 }
 
-// NewTopContext returns a new top context.
-func NewTopContext() *Context {
+// NewTopContext returns a new top context. The script arguments, if any, are
+// available to the script as the list `args`.
+func NewTopContext(args ...string) *Context {
 	ctx := NewContext(nil)
-	// todo: add global things
+	ctx.values = make(map[string]Value, len(builtins)+1)
+
+	for name, val := range builtins {
+		ctx.values[name] = val
+	}
+
+	argList := make([]Value, len(args))
+	for i, a := range args {
+		argList[i] = a
+	}
+	ctx.values["args"] = argList
+
 	return ctx
 }
 
-// NewContext returns a new context.
+// NewContext returns a new context. Its map of names is made when a name is
+// first assigned, as most contexts, e.g. of function calls, have none.
 func NewContext(parent *Context) *Context {
-	return &Context{
-		values: make(map[string]Value),
-		parent: parent,
+	ctx := &Context{}
+	ctx.init(parent)
+	return ctx
+}
+
+// init sets up a new context, allocated by the caller, e.g. with a frame.
+func (ctx *Context) init(parent *Context) {
+
+	ctx.parent = parent
+
+	if parent == nil {
+		ctx.env = &environment{started: time.Now()}
+		return
+	}
+
+	ctx.env = parent.env
+	ctx.goCtx = parent.goCtx
+	ctx.fuel = parent.fuel
+	ctx.limits = parent.limits
+	ctx.profile = parent.profile
+	ctx.coverage = parent.coverage
+	ctx.hook = parent.hook
+	ctx.frame = parent.frame
+}
+
+// SetGoContext makes a run stop when a Go context is canceled or its deadline
+// passes, e.g.
+//
+//	run := compile.NewContext(top)
+//	run.SetGoContext(ctx)
+//	_, err := program(run)
+//
+// The run stops before its next statement with an error wrapping the
+// context's error, so errors.Is(err, context.DeadlineExceeded) reports a
+// timeout. The setting applies to the context and the contexts later
+// created from it, but not to its parent.
+func (ctx *Context) SetGoContext(c context.Context) {
+	ctx.goCtx = c
+}
+
+// Interrupted returns the error of the Go context of a run, if it is done.
+// Evaluators check it before each statement.
+func (ctx *Context) Interrupted() error {
+	if ctx.goCtx == nil {
+		return nil
 	}
+	return ctx.goCtx.Err()
+}
+
+// SetTruthiness selects the rules used to decide if a value is true. The
+// setting applies to the whole context tree.
+func (ctx *Context) SetTruthiness(t Truthiness) {
+	ctx.env.truthiness = t
+}
+
+// SetStrictLogic selects whether && and || produce true/false, rather than
+// the value of the operand that decided the result. The setting applies to
+// the whole context tree.
+func (ctx *Context) SetStrictLogic(strict bool) {
+	ctx.env.strictLogic = strict
+}
+
+// Seed makes the random number builtins produce a repeatable sequence. The
+// setting applies to the whole context tree.
+func (ctx *Context) Seed(seed int64) {
+	ctx.env.randMu.Lock()
+	defer ctx.env.randMu.Unlock()
+
+	ctx.env.rand = newRand(seed)
+}
+
+// random returns the random number generator of the context tree, seeding it
+// from the clock if Seed was not called.
+func (ctx *Context) random() *rand.Rand {
+	ctx.env.randMu.Lock()
+	defer ctx.env.randMu.Unlock()
+
+	if ctx.env.rand == nil {
+		ctx.env.rand = newRand(time.Now().UnixNano())
+	}
+	return ctx.env.rand
+}
+
+// newRand returns a random number generator that is safe for concurrent use.
+func newRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed)})
+}
+
+// lockedSource serializes access to a rand.Source.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// SetInput sets the input read by the read_line and read_all builtins. The
+// default is stdin. The setting applies to the whole context tree.
+func (ctx *Context) SetInput(r io.Reader) {
+	ctx.env.inputMu.Lock()
+	defer ctx.env.inputMu.Unlock()
+
+	ctx.env.input = bufio.NewReader(r)
+	ctx.env.inputGiven = true
+}
+
+// Input returns the buffered input read by the read_line and read_all
+// builtins. Anything else reading the same input, e.g. a REPL reading stdin,
+// should read through this, so that no input is lost to a second buffer.
+func (ctx *Context) Input() *bufio.Reader {
+	ctx.env.inputMu.Lock()
+	defer ctx.env.inputMu.Unlock()
+
+	if ctx.env.input == nil {
+		ctx.env.input = bufio.NewReader(os.Stdin)
+	}
+	return ctx.env.input
 }
 
 // Set sets a variable to a new value. Might return error, e.g. illegal type
 // change.
 func (ctx *Context) Set(name string, value Value) (Value, error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if i, ok := ctx.slot(name); ok {
+		ctx.slots[i] = value
+		return value, nil
+	}
+
+	if ctx.values == nil {
+		ctx.values = make(map[string]Value)
+	}
 	ctx.values[name] = value
 	return value, nil
 }
 
-// Get returns the current value for the variable named, or nil if not assigned.
+// Get returns the current value for the variable named. If it is not
+// assigned, the resolvers set with SetResolver are consulted, and if none
+// supplies it, Get returns nil.
 func (ctx *Context) Get(name string) Value {
 
-	if ctx == nil {
-		return nil
+	for c := ctx; c != nil; c = c.parent {
+		c.mu.RLock()
+		val, ok := c.values[name]
+		if i, slotted := c.slot(name); slotted {
+			val = c.slots[i]
+			ok = !isUnassigned(val)
+		}
+		c.mu.RUnlock()
+
+		if ok {
+			return val
+		}
+	}
+
+	for c := ctx; c != nil; c = c.parent {
+		if c.resolver == nil {
+			continue
+		}
+		if val, ok := c.resolver(name); ok {
+			return val
+		}
+	}
+
+	return nil
+}
+
+// Names returns the sorted names assigned in the context or its parents,
+// e.g. for completion in a REPL. Names only a resolver supplies are not
+// included.
+func (ctx *Context) Names() []string {
+
+	seen := make(map[string]bool)
+	for c := ctx; c != nil; c = c.parent {
+		c.mu.RLock()
+		for name := range c.locals() {
+			seen[name] = true
+		}
+		c.mu.RUnlock()
 	}
 
-	val, ok := ctx.values[name]
-	if !ok {
-		return ctx.parent.Get(name)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+
+	return names
+}
 
-	return val
+// SetResolver sets a function that supplies the values of names that are not
+// assigned, e.g. to expose the rows of a database, or a large configuration,
+// without assigning every name beforehand. It returns false for names it does
+// not know. Values it returns should be converted with FromGo. The resolver is
+// consulted for lookups in the context and the contexts later created from
+// it, after any resolver set on a context between them, and is called on
+// every lookup, so it should cache values that are costly to find. It should
+// be set before any run starts.
+func (ctx *Context) SetResolver(resolver func(name string) (Value, bool)) {
+	ctx.resolver = resolver
 }
@@ -0,0 +1,122 @@
+package compile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The conversion builtins return the converted value on success. When a value
+// cannot be converted, they return an error tuple, (false, message), which is
+// false, allowing e.g. `n = int(s) || 0`.
+
+// failure returns an error tuple.
+func failure(format string, args ...interface{}) Value {
+	return NewTuple(false, fmt.Sprintf(format, args...))
+}
+
+// builtinInt converts a value to an int. Floats are truncated toward zero,
+// strings are parsed as base 10 or prefixed (0x, 0o, 0b) integers, and bools
+// are 1 or 0.
+func builtinInt(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("int", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch x := args[0].(type) {
+	case int64:
+		return x, nil
+	case float64:
+		if math.IsNaN(x) || x >= math.MaxInt64 || x < math.MinInt64 {
+			return failure("int: %v is out of range", x), nil
+		}
+		return int64(x), nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(x), 0, 64)
+		if err != nil {
+			return failure("int: cannot parse %q", x), nil
+		}
+		return i, nil
+	case bool:
+		if x {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+
+	return failure("int: cannot convert %s", TypeName(args[0])), nil
+}
+
+// builtinFloat converts a value to a float. Strings are parsed, and bools are
+// 1.0 or 0.0.
+func builtinFloat(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("float", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch x := args[0].(type) {
+	case float64:
+		return x, nil
+	case int64:
+		return float64(x), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return failure("float: cannot parse %q", x), nil
+		}
+		return f, nil
+	case bool:
+		if x {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	}
+
+	return failure("float: cannot convert %s", TypeName(args[0])), nil
+}
+
+// builtinStr converts a value to a string.
+func builtinStr(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("str", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch x := args[0].(type) {
+	case string:
+		return x, nil
+	case nil:
+		return "nil", nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	}
+
+	return fmt.Sprintf("%v", args[0]), nil
+}
+
+// builtinBool converts a value to a bool. Strings are parsed ("true", "false",
+// "1", "0", etc.), and everything else is converted according to the
+// context's truthiness rules.
+func builtinBool(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("bool", args, 1); err != nil {
+		return nil, err
+	}
+
+	if s, ok := args[0].(string); ok {
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return failure("bool: cannot parse %q", s), nil
+		}
+		return b, nil
+	}
+
+	return ctx.IsTruthy(args[0]), nil
+}
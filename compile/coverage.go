@@ -0,0 +1,256 @@
+package compile
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// Coverage records which lines of scripts run, e.g. to find the code that
+// tests miss. A line is covered if a node starting on it was evaluated. It is
+// safe for concurrent use.
+type Coverage struct {
+	mu    sync.Mutex
+	files map[string]map[int]int64 // the hits of each line of each file
+}
+
+// FileCoverage is the record of a file in a Coverage: the hits of each line
+// that has code, which are 0 for those that did not run.
+type FileCoverage struct {
+	File  string
+	Lines map[int]int64
+}
+
+// NewCoverage returns an empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{files: make(map[string]map[int]int64)}
+}
+
+// SetCoverage records the lines evaluated in a coverage. It applies to the
+// context and the contexts later created from it, but not to its parent.
+func (ctx *Context) SetCoverage(c *Coverage) {
+	ctx.coverage = c
+}
+
+// Add records the lines of a parsed script that have code, so that those
+// that do not run are reported.
+func (c *Coverage) Add(node parser.Node) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(node)
+}
+
+func (c *Coverage) add(node parser.Node) {
+
+	if node.Item.Line > 0 && node.Item.Lexer != nil {
+		c.lines(node.Item.Name())[node.Item.Line] += 0
+	}
+
+	children := node.Children
+	if node.Type() == lex.Function && len(children) > 1 {
+		// the parameters, and the return type, are not evaluated.
+		children = children[1:2]
+	}
+
+	for _, child := range children {
+		c.add(child)
+	}
+}
+
+// lines returns the record of a file, creating it if needed.
+func (c *Coverage) lines(file string) map[int]int64 {
+
+	lines := c.files[file]
+	if lines == nil {
+		lines = make(map[int]int64)
+		c.files[file] = lines
+	}
+
+	return lines
+}
+
+// hit records an evaluation of a node.
+func (c *Coverage) hit(node parser.Node) {
+
+	if node.Item.Line == 0 || node.Item.Lexer == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.lines(node.Item.Name())[node.Item.Line]++
+	c.mu.Unlock()
+}
+
+// Files returns the records of the coverage, sorted by file name.
+func (c *Coverage) Files() []FileCoverage {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files := make([]FileCoverage, 0, len(c.files))
+	for name, lines := range c.files {
+		copied := make(map[int]int64, len(lines))
+		for line, hits := range lines {
+			copied[line] = hits
+		}
+		files = append(files, FileCoverage{File: name, Lines: copied})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].File < files[j].File
+	})
+
+	return files
+}
+
+// Covered returns the number of lines of the file that ran, and that have
+// code.
+func (f FileCoverage) Covered() (covered, total int) {
+
+	for _, hits := range f.Lines {
+		if hits > 0 {
+			covered++
+		}
+	}
+
+	return covered, len(f.Lines)
+}
+
+// Percent returns the percentage of the lines of the file with code that
+// ran, or 100 if none have code.
+func (f FileCoverage) Percent() float64 {
+
+	covered, total := f.Covered()
+	if total == 0 {
+		return 100
+	}
+
+	return 100 * float64(covered) / float64(total)
+}
+
+// Missed returns the lines of the file with code that did not run, as sorted
+// ranges, e.g. 3-5,9.
+func (f FileCoverage) Missed() string {
+
+	missed := []int{}
+	for line, hits := range f.Lines {
+		if hits == 0 {
+			missed = append(missed, line)
+		}
+	}
+	sort.Ints(missed)
+
+	ranges := []string{}
+	for i := 0; i < len(missed); {
+		j := i
+		for j+1 < len(missed) && missed[j+1] == missed[j]+1 {
+			j++
+		}
+
+		if i == j {
+			ranges = append(ranges, fmt.Sprint(missed[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", missed[i], missed[j]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
+
+// WriteReport writes a table of the coverage, with one line per file: file,
+// lines covered, percentage, and the lines missed.
+func (c *Coverage) WriteReport(w io.Writer) error {
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "file\tlines\tcoverage\tmissed\n")
+
+	for _, f := range c.Files() {
+		covered, total := f.Covered()
+		fmt.Fprintf(tw, "%s\t%d/%d\t%.1f%%\t%s\n", f.File, covered, total, f.Percent(), f.Missed())
+	}
+
+	return tw.Flush()
+}
+
+// WriteHTML writes the coverage as an HTML page showing the source of each
+// file, read from disk, with the lines that ran in green, and those that did
+// not in red.
+func (c *Coverage) WriteHTML(w io.Writer) error {
+
+	type line struct {
+		Number int
+		Text   string
+		Class  string
+		Hits   int64
+	}
+
+	type file struct {
+		Name    string
+		Percent float64
+		Lines   []line
+	}
+
+	files := []file{}
+	for _, f := range c.Files() {
+
+		src, err := ioutil.ReadFile(f.File)
+		if err != nil {
+			return fmt.Errorf("coverage: %v", err)
+		}
+
+		page := file{Name: f.File, Percent: f.Percent()}
+		for i, text := range strings.Split(strings.TrimSuffix(string(src), "\n"), "\n") {
+			l := line{Number: i + 1, Text: text}
+			if hits, ok := f.Lines[i+1]; ok {
+				l.Hits = hits
+				l.Class = "missed"
+				if hits > 0 {
+					l.Class = "covered"
+				}
+			}
+			page.Lines = append(page.Lines, l)
+		}
+
+		files = append(files, page)
+	}
+
+	return coverageTemplate.Execute(w, files)
+}
+
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>meh coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; }
+.number { color: #888; display: inline-block; text-align: right; width: 4em; margin-right: 1em; }
+.covered { background: #dfd; }
+.missed { background: #fdd; }
+</style>
+</head>
+<body>
+{{- range . }}
+<h2>{{ .Name }} ({{ printf "%.1f" .Percent }}%)</h2>
+<pre>
+{{- range .Lines }}
+<span class="{{ .Class }}"{{ if .Class }} title="{{ .Hits }} hits"{{ end }}><span class="number">{{ .Number }}</span>{{ .Text }}</span>
+{{- end }}
+</pre>
+{{- end }}
+</body>
+</html>
+`))
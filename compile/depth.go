@@ -0,0 +1,41 @@
+package compile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCallDepth is the error, wrapped with the depth reached, that stops a run
+// whose calls nest deeper than its maximum call depth, e.g. a function that
+// calls itself without end.
+var ErrCallDepth = errors.New("call depth exceeded")
+
+// DefaultMaxDepth is the maximum call depth of a new context tree. It is well
+// within the stack of a goroutine, and as names are found by walking the
+// calls in progress, keeps runaway recursion from running for long before it
+// stops.
+const DefaultMaxDepth = 1000
+
+// SetMaxDepth limits the number of calls a run may have in progress at once,
+// so that runaway recursion stops with an error for which
+// errors.Is(err, ErrCallDepth) is true, rather than exhausting the stack of
+// the host process. A limit of 0 or less restores DefaultMaxDepth. The
+// setting applies to the whole context tree.
+func (ctx *Context) SetMaxDepth(n int) {
+	ctx.env.maxDepth = n
+}
+
+// checkDepth checks that a call at a depth is within the maximum call depth.
+func (ctx *Context) checkDepth(depth int) error {
+
+	max := ctx.env.maxDepth
+	if max <= 0 {
+		max = DefaultMaxDepth
+	}
+
+	if depth > max {
+		return fmt.Errorf("%w: more than %d calls in progress", ErrCallDepth, max)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package compile
+
+import (
+	"net/url"
+)
+
+// encoder adapts an encoding func to a builtin of one string.
+func encoder(name string, encode func([]byte) string) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		s, err := stringArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return encode([]byte(s)), nil
+	}
+}
+
+// decoder adapts a decoding func to a builtin of one string. When the string
+// cannot be decoded, the builtin returns an error tuple.
+func decoder(name string, decode func(string) ([]byte, error)) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		s, err := stringArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err := decode(s)
+		if err != nil {
+			return failure("%s: %v", name, err), nil
+		}
+
+		return string(decoded), nil
+	}
+}
+
+func urlEncode(b []byte) string {
+	return url.QueryEscape(string(b))
+}
+
+func urlDecode(s string) ([]byte, error) {
+	decoded, err := url.QueryUnescape(s)
+	return []byte(decoded), err
+}
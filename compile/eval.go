@@ -0,0 +1,22 @@
+package compile
+
+// Eval parses, compiles, and runs a script in a new top context, and returns
+// the value of its last statement, or of a top level return. The vars are
+// assigned before the script runs, e.g.
+//
+//	v, err := compile.Eval("price * qty", map[string]interface{}{
+//		"price": 2.5,
+//		"qty":   4,
+//	})
+//
+// The vars are converted as for Bind. To run a script more than once, use a
+// Program.
+func Eval(src string, vars map[string]interface{}) (interface{}, error) {
+
+	p, err := NewProgram("eval", src)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Run(vars)
+}
@@ -0,0 +1,59 @@
+package compile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+
+	when := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		src  string
+		vars map[string]interface{}
+		want interface{}
+	}{
+		{"price * qty", map[string]interface{}{"price": 2.5, "qty": 4}, 10.0},
+		{"n + 1", map[string]interface{}{"n": int32(41)}, int64(42)},
+		{"len(names)", map[string]interface{}{"names": []string{"a", "b"}}, int64(2)},
+		{"m.a + m.b", map[string]interface{}{"m": map[string]int{"a": 1, "b": 2}}, int64(3)},
+		{"ok && name", map[string]interface{}{"ok": true, "name": "x"}, "x"},
+		{"t", map[string]interface{}{"t": when}, when},
+		{"double(4)", map[string]interface{}{"double": func(n int) int { return 2 * n }}, int64(8)},
+		{"x", map[string]interface{}{"x": nil}, nil},
+		{"return 1\n2", nil, int64(1)},
+		{"x = 1\nx + 1", nil, int64(2)},
+		{"list(1, \"a\")", nil, []Value{int64(1), "a"}},
+		{"", nil, nil},
+	} {
+		got, err := Eval(c.src, c.vars)
+		if err != nil {
+			t.Errorf("%q: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+
+	for _, c := range []struct {
+		src string
+		err string
+	}{
+		{"1 +", "eval:1:3: error:"},
+		{"x = (1", "eval:1:"},
+		{"1 / 0", "eval:1:3"},
+		{"missing(1)", "cannot invoke non-function"},
+		{"error(\"failed\")", "failed"},
+	} {
+		if _, err := Eval(c.src, nil); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got %v, want an error with %q", c.src, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package compile
+
+import "fmt"
+
+// Exit is the error produced by the exit builtin. It stops the script like
+// any other error, and carries the exit status the script asked for, which
+// the embedding program can find with errors.As.
+type Exit struct {
+	Code int
+}
+
+func (e Exit) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// builtinExit stops the script with an exit status: exit() for status 0, or
+// exit(code), where code is 0 to 255, as larger statuses are truncated by
+// the operating system, so that exit(256) would report success.
+func builtinExit(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("exit", args, 0, 1); err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 {
+		return nil, Exit{}
+	}
+
+	code, err := intArg("exit", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if code < 0 || code > 255 {
+		return nil, fmt.Errorf("exit: status %d is not in 0 to 255", code)
+	}
+
+	return nil, Exit{Code: int(code)}
+}
@@ -0,0 +1,39 @@
+package compile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExit(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		code int
+		err  string
+	}{
+		{`exit()`, 0, ""},
+		{`exit(0)`, 0, ""},
+		{`exit(3)`, 3, ""},
+		{`exit(255)`, 255, ""},
+		{`x = 1; exit(x + 1); exit(5)`, 2, ""},
+		{`exit(256)`, 0, "exit: status 256 is not in 0 to 255"},
+		{`exit(0 - 1)`, 0, "exit: status -1 is not in 0 to 255"},
+		{`exit("1")`, 0, "exit"},
+	} {
+		_, err := Eval(c.src, nil)
+
+		var exit Exit
+		if c.err == "" {
+			if !errors.As(err, &exit) || exit.Code != c.code {
+				t.Errorf("%s: got %v, want exit status %d", c.src, err, c.code)
+			}
+			continue
+		}
+
+		if err == nil || errors.As(err, &exit) || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got %v, want an error %q", c.src, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// A filter is a restricted script for evaluating user supplied expressions,
+// e.g. `age >= 21 && country == "NZ"`: a single expression that assigns no
+// names, has no loops, returns, or functions, and calls only builtins, none
+// that does I/O. Its runs are given no capabilities, unless they are allowed
+// on the program's top context, and are bounded by filterFuel and
+// filterLimits, unless others are set there.
+
+// filterFuel is the fuel of a filter's runs: ample for an expression, while
+// stopping one that a builtin makes run for long.
+const filterFuel = 100000
+
+// filterLimits are the limits of a filter's runs.
+var filterLimits = Limits{
+	MaxStringLen: 1 << 20,
+	MaxListLen:   100000,
+	MaxValues:    1000000,
+	MaxBytes:     64 << 20,
+}
+
+// forbidden are the node types a filter may not use, with the reason.
+var forbidden = map[lex.Type]string{
+	lex.Assign:       "assignment",
+	lex.PlusAssign:   "assignment",
+	lex.MinusAssign:  "assignment",
+	lex.MultAssign:   "assignment",
+	lex.DivAssign:    "assignment",
+	lex.ModuloAssign: "assignment",
+	lex.Increment:    "assignment",
+	lex.Decrement:    "assignment",
+	lex.Until:        "loop",
+	lex.Return:       "return",
+	lex.Break:        "break",
+	lex.Continue:     "continue",
+	lex.Function:     "function",
+}
+
+// impure are the builtins a filter may not refer to, since they do I/O, wait,
+// or stop the process.
+var impure = map[string]bool{
+	"read_line": true,
+	"read_all":  true,
+	"list_dir":  true,
+	"exists":    true,
+	"is_dir":    true,
+	"mkdir":     true,
+	"remove":    true,
+	"serve":     true,
+	"exit":      true,
+	"sleep":     true,
+	"log_debug": true,
+	"log_info":  true,
+	"log_warn":  true,
+	"log_error": true,
+}
+
+// Validate checks that a script is a filter, without compiling it. If it is
+// not, or cannot be parsed, the error is a diag.List, with a diag.Policy
+// diagnostic for each construct a filter may not use.
+func Validate(src string) error {
+	_, err := parseFilter("filter", src)
+	return err
+}
+
+// NewFilter validates and compiles a filter. The name is used in the
+// positions of errors. Run the program with the names the filter may refer
+// to as its vars, e.g.
+//
+//	f, err := compile.NewFilter("rule", `age >= 21 && country == "NZ"`)
+//	...
+//	ok, err := f.Run(map[string]interface{}{"age": 30, "country": "NZ"})
+//
+// Its top context has the fuel and limits of a filter set, which SetFuel and
+// SetLimits on it replace.
+func NewFilter(name, src string) (*Program, error) {
+
+	node, err := parseFilter(name, src)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := compileProgram(node)
+	if err != nil {
+		return nil, err
+	}
+
+	p.top.SetFuel(filterFuel)
+	p.top.SetLimits(filterLimits)
+
+	return p, nil
+}
+
+// parseFilter parses a script, and checks that it is a filter.
+func parseFilter(name, src string) (parser.Node, error) {
+
+	node, errs := parser.NewFromString(name, src).Parse()
+	if len(errs) > 0 {
+		return node, diag.ListOf(errs)
+	}
+
+	list := diag.List{}
+	problem := func(n parser.Node, format string, args ...interface{}) {
+		list = append(list, n.Item.Diagnose(diag.Policy, fmt.Errorf(format, args...)))
+	}
+
+	switch len(node.Children) {
+	case 0:
+		problem(node, "filter requires an expression")
+	case 1:
+	default:
+		problem(node.Children[1], "filter must be a single expression")
+	}
+
+	parser.Inspect(node, func(n parser.Node) bool {
+		if what, ok := forbidden[n.Type()]; ok {
+			problem(n, "%s not allowed in a filter", what)
+		}
+		if n.Type() == lex.Ident && impure[n.Item.Value] {
+			problem(n, "%s not allowed in a filter", n.Item.Value)
+		}
+		if n.Type() == lex.FuncApply && len(n.Children) > 0 && !isBuiltin(n.Children[0]) {
+			problem(n, "call of %s not allowed in a filter, only of builtins", CallName(n))
+		}
+		return true
+	})
+
+	return node, list.Err()
+}
+
+// isBuiltin checks if an expression names a builtin, e.g. len, or
+// strings.upper.
+func isBuiltin(n parser.Node) bool {
+
+	switch n.Type() {
+	case lex.Ident:
+		_, ok := builtins[n.Item.Value]
+		return ok
+	case lex.Dot:
+		return len(n.Children) == 2 && isBuiltin(n.Children[0]) && n.Children[1].Type() == lex.Ident
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+package compile
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+
+	for _, c := range []struct {
+		src string
+		ok  bool
+	}{
+		{`age >= 21 && country == "NZ"`, true},
+		{`len(strings.upper(name)) > 3`, true},
+		{`map(range(3), len)`, true},
+		{`x = 1`, false},
+		{`fn(a) { a }`, false},
+		{`(fn(f) { f(f) })(fn(f) { f(f) })`, false},
+		{`map(range(100000000), fn(i) { i })`, false},
+		{`check(age)`, false},
+		{`rules.check(age)`, false},
+		{`read_line()`, false},
+		{`1; 2`, false},
+	} {
+		err := Validate(c.src)
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.src, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: accepted", c.src)
+		}
+	}
+}
+
+func TestFilterRun(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		want error
+	}{
+		{`age / 0 == 1`, ErrDivideByZero},
+		{`age % 0 == 1`, ErrDivideByZero},
+		{`len(range(100000000)) > 0`, ErrLimitExceeded},
+		{`len(strings.repeat("x", 10000000)) > 0`, ErrLimitExceeded},
+	} {
+		f, err := NewFilter("rule", c.src)
+		if err != nil {
+			t.Fatalf("%s: %v", c.src, err)
+		}
+
+		if _, err := f.Run(map[string]interface{}{"age": 30}); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.src, err, c.want)
+		}
+	}
+
+	f, err := NewFilter("rule", `age >= 21`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := f.Run(map[string]interface{}{"age": 30}); err != nil || v != true {
+		t.Errorf("got %v, %v, want true", v, err)
+	}
+}
@@ -12,11 +12,19 @@ const (
 )
 
 // FlowChange is what is returned by an Expr when there is a change of flow.
+// A Break or Continue may carry the Label of the loop it targets.
 type FlowChange struct {
-	Type FlowChangeType
+	Type  FlowChangeType
+	Label string
 	Value
 }
 
+// Targets checks if a Break or Continue applies to the loop with the given
+// label. An unlabeled Break or Continue applies to the innermost loop.
+func (f FlowChange) Targets(label string) bool {
+	return f.Label == "" || f.Label == label
+}
+
 // flowChange checks if the value is a FlowChange.
 func flowChange(v Value) FlowChangeType {
 	change, ok := v.(FlowChange)
@@ -57,3 +65,15 @@ func NewBreak() Value {
 func NewContinue() Value {
 	return FlowChange{Type: Continue}
 }
+
+// NewLabeledBreak produces a Break FlowChange for the loop with the given
+// label.
+func NewLabeledBreak(label string) Value {
+	return FlowChange{Type: Break, Label: label}
+}
+
+// NewLabeledContinue produces a Continue FlowChange for the loop with the
+// given label.
+func NewLabeledContinue(label string) Value {
+	return FlowChange{Type: Continue, Label: label}
+}
@@ -0,0 +1,200 @@
+package compile
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// builtinFormat formats its arguments according to a fmt.Sprintf style format
+// string. Verbs are checked against the types of the arguments, rather than
+// producing %!d(string=...) noise.
+func builtinFormat(ctx *Context, args ...Value) (Value, error) {
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("format: requires a format string")
+	}
+
+	format, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("format: format must be a string, received %s", TypeName(args[0]))
+	}
+
+	verbs, err := formatVerbs(format)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := args[1:]
+	used := make([]bool, len(vals))
+	converted := make([]interface{}, len(vals))
+	for _, verb := range verbs {
+		if verb.arg >= len(vals) {
+			return nil, fmt.Errorf("format: %%%c formats argument %d, received %d arguments", verb.verb, verb.arg+1, len(vals))
+		}
+
+		v, err := formatArg(verb.verb, vals[verb.arg])
+		if err != nil {
+			return nil, fmt.Errorf("format: argument %d: %v", verb.arg+1, err)
+		}
+		if used[verb.arg] && reflect.TypeOf(v) != reflect.TypeOf(converted[verb.arg]) {
+			return nil, fmt.Errorf("format: argument %d: formatted as both %T and %T", verb.arg+1, converted[verb.arg], v)
+		}
+		used[verb.arg], converted[verb.arg] = true, v
+	}
+
+	for i := range used {
+		if !used[i] {
+			return nil, fmt.Errorf("format: argument %d is not formatted", i+1)
+		}
+	}
+
+	return fmt.Sprintf(format, converted...), nil
+}
+
+// maxWidth is the largest width or precision fmt accepts.
+const maxWidth = 1000000
+
+// formatVerb is a verb of a format string, or a * width or precision, and
+// the index of the argument it formats.
+type formatVerb struct {
+	verb rune
+	arg  int
+}
+
+// formatVerbs returns the verbs of a format string, e.g. 'd' for "%-5d", with
+// the arguments they format, following explicit argument indexes, e.g.
+// "%[2]d", as fmt does. A * width or precision is a verb '*'.
+func formatVerbs(format string) ([]formatVerb, error) {
+
+	verbs := []formatVerb{}
+	rs := []rune(format)
+	arg := 0
+
+	// index reads an explicit argument index at i, if there is one.
+	index := func(i int) (int, error) {
+		if i >= len(rs) || rs[i] != '[' {
+			return i, nil
+		}
+		end := i + 1
+		for end < len(rs) && rs[end] != ']' {
+			end++
+		}
+		if end == len(rs) {
+			return 0, fmt.Errorf("format: unclosed argument index %s", string(rs[i:]))
+		}
+		n, err := strconv.Atoi(string(rs[i+1 : end]))
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("format: bad argument index %s", string(rs[i:end+1]))
+		}
+		arg = n - 1
+		return end + 1, nil
+	}
+
+	// number reads a width, or a precision after the '.', at i, either
+	// digits, or * for an argument.
+	number := func(i int, what string) (int, error) {
+		i, err := index(i)
+		if err != nil {
+			return 0, err
+		}
+		if i < len(rs) && rs[i] == '*' {
+			verbs = append(verbs, formatVerb{'*', arg})
+			arg++
+			return i + 1, nil
+		}
+		start := i
+		for i < len(rs) && rs[i] >= '0' && rs[i] <= '9' {
+			i++
+		}
+		if n, _ := strconv.Atoi(string(rs[start:i])); n > maxWidth || i-start > 7 {
+			return 0, fmt.Errorf("format: %s %s is larger than %d", what, string(rs[start:i]), maxWidth)
+		}
+		return i, nil
+	}
+
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '%' {
+			continue
+		}
+
+		i++
+		for i < len(rs) && strings.ContainsRune("+-# 0", rs[i]) {
+			i++
+		}
+
+		var err error
+		if i, err = number(i, "width"); err != nil {
+			return nil, err
+		}
+		if i < len(rs) && rs[i] == '.' {
+			if i, err = number(i+1, "precision"); err != nil {
+				return nil, err
+			}
+		}
+		if i, err = index(i); err != nil {
+			return nil, err
+		}
+
+		if i == len(rs) {
+			return nil, fmt.Errorf("format: incomplete verb at end of format")
+		}
+
+		if rs[i] == '%' {
+			continue
+		}
+
+		if !strings.ContainsRune("vtdboxXcqeEfFgGs", rs[i]) {
+			return nil, fmt.Errorf("format: unknown verb %%%c", rs[i])
+		}
+
+		verbs = append(verbs, formatVerb{rs[i], arg})
+		arg++
+	}
+
+	return verbs, nil
+}
+
+// formatArg checks that a value suits a verb, and converts it if needed.
+func formatArg(verb rune, v Value) (interface{}, error) {
+
+	switch verb {
+	case '*':
+		if n, ok := v.(int64); ok {
+			if n < -maxWidth || n > maxWidth {
+				return nil, fmt.Errorf("* width or precision %d is larger than %d", n, maxWidth)
+			}
+			return int(n), nil
+		}
+		return nil, fmt.Errorf("* width or precision must be an int, received %s", TypeName(v))
+	case 'v':
+		return v, nil
+	case 't':
+		if _, ok := v.(bool); ok {
+			return v, nil
+		}
+	case 'd', 'b', 'o', 'c':
+		if _, ok := v.(int64); ok {
+			return v, nil
+		}
+	case 'x', 'X':
+		switch v.(type) {
+		case int64, string:
+			return v, nil
+		}
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case int64:
+			return float64(x), nil
+		}
+	case 's', 'q':
+		if _, ok := v.(string); ok {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("verb %%%c cannot format %s", verb, TypeName(v))
+}
@@ -0,0 +1,52 @@
+package compile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		want string
+		err  string
+	}{
+		{`format("%d items at %.2f", 3, 1.5)`, "3 items at 1.50", ""},
+		{`format("%-5d|%05.1f|%x", 42, 3, "hi")`, "42   |003.0|6869", ""},
+		{`format("100%% of %s", "it")`, "100% of it", ""},
+		{`format("%[2]s %[1]s", "world", "hello")`, "hello world", ""},
+		{`format("%[1]d %[1]x", 255)`, "255 ff", ""},
+		{`format("%*d|%-*d|", 4, 1, 3, 2)`, "   1|2  |", ""},
+		{`format("%.*f", 2, 3.14159)`, "3.14", ""},
+		{`format("%6.2f", 1000000)`, "1000000.00", ""},
+		{`format("%999999999999d", 1)`, "", "format: width 999999999999 is larger than 1000000"},
+		{`format("%.1000001f", 1.0)`, "", "format: precision 1000001 is larger than 1000000"},
+		{`format("%*d", 2000000, 1)`, "", "format: argument 1: * width or precision 2000000 is larger than 1000000"},
+		{`format("%*d", "4", 1)`, "", "format: argument 1: * width or precision must be an int, received string"},
+		{`format("%[3]d", 1)`, "", "format: %d formats argument 3, received 1 arguments"},
+		{`format("%[0]d", 1)`, "", "format: bad argument index [0]"},
+		{`format("%[1d", 1)`, "", "format: unclosed argument index [1d"},
+		{`format("%[2]d", 1, 2)`, "", "format: argument 1 is not formatted"},
+		{`format("%d %d", 1)`, "", "format: %d formats argument 2, received 1 arguments"},
+		{`format("%d", 1, 2)`, "", "format: argument 2 is not formatted"},
+		{`format("%[1]d %[1]f", 1)`, "", "format: argument 1: formatted as both int64 and float64"},
+		{`format("%d", "x")`, "", "format: argument 1: verb %d cannot format string"},
+		{`format("%y", 1)`, "", "format: unknown verb %y"},
+		{`format("%5", 1)`, "", "format: incomplete verb at end of format"},
+	} {
+		got, err := Eval(c.src, nil)
+		if c.err == "" {
+			if err != nil || got != c.want {
+				t.Errorf("%s = %q, %v, want %q", c.src, got, err, c.want)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got %v, want an error %q", c.src, err, c.err)
+		} else if !strings.HasPrefix(err.Error(), "eval:1:1 ") {
+			t.Errorf("%s: error %q has no position", c.src, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package compile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The filesystem builtins return an error tuple, (false, message), when the
+// operation fails. Those that access the filesystem require the FS
+// capability.
+
+// builtinListDir returns the sorted names of the entries of a directory:
+// list_dir(path).
+func builtinListDir(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("list_dir", args, 1); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.require("list_dir", FS); err != nil {
+		return nil, err
+	}
+
+	path, err := stringArg("list_dir", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return failure("list_dir: %v", err), nil
+	}
+
+	names := []Value{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+
+	return names, nil
+}
+
+// builtinExists checks if a path exists: exists(path).
+func builtinExists(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("exists", args, 1); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.require("exists", FS); err != nil {
+		return nil, err
+	}
+
+	path, err := stringArg("exists", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(path)
+	return err == nil, nil
+}
+
+// builtinIsDir checks if a path is a directory: is_dir(path).
+func builtinIsDir(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("is_dir", args, 1); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.require("is_dir", FS); err != nil {
+		return nil, err
+	}
+
+	path, err := stringArg("is_dir", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir(), nil
+}
+
+// builtinMkdir creates a directory, along with any missing parents:
+// mkdir(path).
+func builtinMkdir(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("mkdir", args, 1); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.require("mkdir", FS); err != nil {
+		return nil, err
+	}
+
+	path, err := stringArg("mkdir", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(path, 0777); err != nil {
+		return failure("mkdir: %v", err), nil
+	}
+
+	return true, nil
+}
+
+// builtinRemove removes a file or an empty directory: remove(path).
+func builtinRemove(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("remove", args, 1); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.require("remove", FS); err != nil {
+		return nil, err
+	}
+
+	path, err := stringArg("remove", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return failure("remove: %v", err), nil
+	}
+
+	return true, nil
+}
+
+// builtinPathJoin joins path elements: path_join(a, b, ...).
+func builtinPathJoin(ctx *Context, args ...Value) (Value, error) {
+
+	elems := []string{}
+	for i := range args {
+		s, err := stringArg("path_join", args, i)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, s)
+	}
+
+	return filepath.Join(elems...), nil
+}
+
+// builtinPathBase returns the last element of a path: path_base(path).
+func builtinPathBase(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("path_base", args, 1); err != nil {
+		return nil, err
+	}
+
+	path, err := stringArg("path_base", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return filepath.Base(path), nil
+}
+
+// builtinPathDir returns all but the last element of a path: path_dir(path).
+func builtinPathDir(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("path_dir", args, 1); err != nil {
+		return nil, err
+	}
+
+	path, err := stringArg("path_dir", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return filepath.Dir(path), nil
+}
@@ -0,0 +1,68 @@
+package compile
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/pdk/meh/parser"
+)
+
+// ErrOutOfFuel is the error, wrapped with the position reached, that stops a
+// run that used up the fuel given by SetFuel.
+var ErrOutOfFuel = errors.New("out of fuel")
+
+// SetFuel limits a run to evaluating n expressions, e.g. to stop untrusted
+// scripts that would otherwise run forever. The run then stops with an error
+// for which errors.Is(err, ErrOutOfFuel) is true. The limit applies to the
+// context and the contexts later created from it, which share the fuel, but
+// not to its parent.
+func (ctx *Context) SetFuel(n int64) {
+	ctx.fuel = &n
+}
+
+// Fuel returns the fuel left to a run, and false if there is no limit.
+func (ctx *Context) Fuel() (int64, bool) {
+	if ctx.fuel == nil {
+		return 0, false
+	}
+
+	left := atomic.LoadInt64(ctx.fuel)
+	if left < 0 {
+		left = 0
+	}
+
+	return left, true
+}
+
+// UseFuel uses a unit of the fuel of a run, and returns ErrOutOfFuel if there
+// was none left. Evaluators use a unit for each step, e.g. each Expr.
+func (ctx *Context) UseFuel() error {
+	if ctx.fuel != nil && atomic.AddInt64(ctx.fuel, -1) < 0 {
+		return ErrOutOfFuel
+	}
+	return nil
+}
+
+// metered wraps a compiled Expr, so that evaluating it uses a unit of fuel,
+// and is recorded in the profile and the coverage of the run, if any.
+func metered(node parser.Node, e Expr) Expr {
+	return func(ctx *Context, vals ...Value) (Value, error) {
+		if err := ctx.UseFuel(); err != nil {
+			return nil, node.Error(err)
+		}
+
+		if ctx.coverage != nil {
+			ctx.coverage.hit(node)
+		}
+
+		if ctx.profile == nil {
+			return e(ctx, vals...)
+		}
+
+		entry := ctx.profile.enter(node)
+		v, err := e(ctx, vals...)
+		ctx.profile.exit(entry)
+
+		return v, err
+	}
+}
@@ -0,0 +1,92 @@
+package compile
+
+// builtinMap returns a list of the results of calling a function on each
+// element of a list: map(list, fn(x) { ... }).
+func builtinMap(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("map", args, 2); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("map", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := fnArg("map", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make([]Value, len(list))
+	for i, v := range list {
+		mapped[i], err = ctx.callback(fn, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mapped, nil
+}
+
+// builtinFilter returns a list of the elements of a list for which a
+// function returns true: filter(list, fn(x) { ... }).
+func builtinFilter(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("filter", args, 2); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("filter", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := fnArg("filter", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []Value{}
+	for _, v := range list {
+		keep, err := ctx.callback(fn, v)
+		if err != nil {
+			return nil, err
+		}
+
+		if ctx.IsTruthy(keep) {
+			filtered = append(filtered, v)
+		}
+	}
+
+	return filtered, nil
+}
+
+// builtinReduce combines the elements of a list, starting from an initial
+// value: reduce(list, fn(acc, x) { ... }, init).
+func builtinReduce(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("reduce", args, 3); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("reduce", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := fnArg("reduce", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := args[2]
+	for _, v := range list {
+		acc, err = ctx.callback(fn, acc, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
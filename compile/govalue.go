@@ -0,0 +1,177 @@
+package compile
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// FromGo converts a Go value to the Value used for it in scripts, as
+// described for Bind. Values implementing the interfaces of custom values,
+// e.g. Adder, are used as they are. Pointers and interfaces are followed, and
+// other values are used as they are.
+func FromGo(v interface{}) Value {
+
+	switch v.(type) {
+	case nil, int64, float64, string, bool, Tuple, []Value, map[string]Value,
+		func(*Context, ...Value) (Value, error), *regexp.Regexp, time.Time, Record:
+		return v
+	}
+
+	return fromReflect(reflect.ValueOf(v))
+}
+
+func fromReflect(rv reflect.Value) Value {
+
+	if rv.IsValid() && rv.CanInterface() && isCustomValue(rv.Interface()) {
+		return rv.Interface()
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > 1<<63-1 {
+			return float64(rv.Uint())
+		}
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Struct:
+		return Record{v: rv}
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct {
+			return Record{v: rv}
+		}
+		return FromGo(rv.Elem().Interface())
+	case reflect.Func:
+		if rv.IsNil() {
+			return nil
+		}
+		f, err := goFunc("fn", rv.Interface())
+		if err == nil {
+			return f
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		list := make([]Value, rv.Len())
+		for i := range list {
+			list[i] = FromGo(rv.Index(i).Interface())
+		}
+		return list
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := make(map[string]Value, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = FromGo(iter.Value().Interface())
+		}
+		return m
+	}
+
+	return rv.Interface()
+}
+
+// toGo converts a Value to a Go value of type t. Ints convert to any int or
+// float type they fit in, floats to any float type, lists to slices, and maps
+// to maps with string keys, converting each element in turn.
+func toGo(v Value, t reflect.Type) (reflect.Value, error) {
+
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("requires %s, received nil", t)
+	}
+
+	rv := reflect.ValueOf(v)
+	if r, ok := v.(Record); ok {
+		rv = r.v
+		if rv.Kind() == reflect.Ptr && !rv.Type().AssignableTo(t) {
+			rv = rv.Elem()
+		}
+	}
+
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := v.(int64); ok {
+			out := reflect.New(t).Elem()
+			if !out.OverflowInt(i) {
+				out.SetInt(i)
+				return out, nil
+			}
+			return reflect.Value{}, fmt.Errorf("%d does not fit in %s", i, t)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := v.(int64); ok {
+			out := reflect.New(t).Elem()
+			if i >= 0 && !out.OverflowUint(uint64(i)) {
+				out.SetUint(uint64(i))
+				return out, nil
+			}
+			return reflect.Value{}, fmt.Errorf("%d does not fit in %s", i, t)
+		}
+	case reflect.Float32, reflect.Float64:
+		switch x := v.(type) {
+		case int64:
+			return reflect.ValueOf(float64(x)).Convert(t), nil
+		case float64:
+			return reflect.ValueOf(x).Convert(t), nil
+		}
+	case reflect.String:
+		if s, ok := v.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Bool:
+		if b, ok := v.(bool); ok {
+			return reflect.ValueOf(b).Convert(t), nil
+		}
+	case reflect.Slice:
+		if list, ok := v.([]Value); ok {
+			out := reflect.MakeSlice(t, len(list), len(list))
+			for i, e := range list {
+				ev, err := toGo(e, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("element %d: %v", i, err)
+				}
+				out.Index(i).Set(ev)
+			}
+			return out, nil
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]Value); ok && t.Key().Kind() == reflect.String {
+			out := reflect.MakeMapWithSize(t, len(m))
+			for k, e := range m {
+				ev, err := toGo(e, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %q: %v", k, err)
+				}
+				out.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), ev)
+			}
+			return out, nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("requires %s, received %s", t, TypeName(v))
+}
@@ -0,0 +1,31 @@
+package compile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromGo(t *testing.T) {
+
+	for _, c := range []struct {
+		v    interface{}
+		want Value
+	}{
+		{uint8(200), int64(200)},
+		{uint64(1<<63 - 1), int64(1<<63 - 1)},
+		{uint64(1 << 63), float64(1 << 63)},
+		{[]uint64{1, 1 << 63}, []Value{int64(1), float64(1 << 63)}},
+		{int32(-5), int64(-5)},
+		{float32(0.5), 0.5},
+		{map[string]int{"a": 1}, map[string]Value{"a": int64(1)}},
+	} {
+		if got := FromGo(c.v); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("FromGo(%#v) = %#v, want %#v", c.v, got, c.want)
+		}
+	}
+
+	got, err := Eval("x > 0", map[string]interface{}{"x": uint64(1 << 63)})
+	if err != nil || got != true {
+		t.Errorf("x > 0 for uint64(1<<63) = %v, %v, want true", got, err)
+	}
+}
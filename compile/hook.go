@@ -0,0 +1,14 @@
+package compile
+
+import "github.com/pdk/meh/parser"
+
+// Hook is called before each statement of a block is evaluated, with the
+// context it is evaluated in, e.g. to trace a run. The context of a call is
+// reused once the call returns, so the hook must not keep it.
+type Hook func(ctx *Context, stmt parser.Node)
+
+// SetHook calls a hook before each statement evaluated. It applies to the
+// context and the contexts later created from it, but not to its parent.
+func (ctx *Context) SetHook(h Hook) {
+	ctx.hook = h
+}
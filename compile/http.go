@@ -0,0 +1,174 @@
+package compile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// builtinServe serves HTTP on an address, calling a script function for each
+// request: serve(":8080", fn(req) { ... }). The function receives a request
+// map with method, path, query, headers, body, and remote, and returns
+// either a string body, or a response map with status, headers, and body.
+// A request body longer than the MaxStringLen of the limits of the run is
+// refused with 413 Request Entity Too Large. It only returns if the server
+// fails, with an error tuple. It requires the Net capability.
+func builtinServe(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("serve", args, 2); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.require("serve", Net); err != nil {
+		return nil, err
+	}
+
+	addr, err := stringArg("serve", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	handler, err := fnArg("serve", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &scriptHandler{ctx: ctx, fn: handler}
+	err = http.ListenAndServe(addr, h)
+
+	return failure("serve: %v", err), nil
+}
+
+// scriptHandler handles HTTP requests with a script function. Each request
+// is handled concurrently in its own child context, so that names assigned
+// while handling one request are not seen by another, and stops if the client
+// goes away.
+type scriptHandler struct {
+	ctx *Context
+	fn  func(*Context, ...Value) (Value, error)
+}
+
+func (h *scriptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	req, err := requestMap(h.ctx, w, r)
+	if errors.Is(err, ErrLimitExceeded) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	run := NewContext(h.ctx)
+	run.SetGoContext(r.Context())
+
+	res, err := run.callback(h.fn, req)
+
+	if err != nil {
+		log.Printf("serve: %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := writeResponse(w, res); err != nil {
+		log.Printf("serve: %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// requestMap converts an HTTP request to a map for a script. Only the first
+// value of repeated query parameters and headers is included.
+func requestMap(ctx *Context, w http.ResponseWriter, r *http.Request) (map[string]Value, error) {
+
+	body, err := readBody(ctx, w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	query := make(map[string]Value)
+	for k := range r.URL.Query() {
+		query[k] = r.URL.Query().Get(k)
+	}
+
+	headers := make(map[string]Value)
+	for k := range r.Header {
+		headers[k] = r.Header.Get(k)
+	}
+
+	return map[string]Value{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"query":   query,
+		"headers": headers,
+		"body":    string(body),
+		"remote":  r.RemoteAddr,
+	}, nil
+}
+
+// readBody reads the body of a request, which the script receives as a
+// string, and so may be no longer than the limits of the context allow.
+func readBody(ctx *Context, w http.ResponseWriter, r *http.Request) ([]byte, error) {
+
+	if ctx.limits == nil || ctx.limits.MaxStringLen <= 0 {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	max := ctx.limits.MaxStringLen
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil && int64(len(body)) >= max {
+		return nil, fmt.Errorf("%w: request body exceeds %d bytes", ErrLimitExceeded, max)
+	}
+
+	return body, err
+}
+
+// writeResponse writes the value returned by a script's handler.
+func writeResponse(w http.ResponseWriter, res Value) error {
+
+	switch x := res.(type) {
+	case nil:
+		return nil
+	case string:
+		_, err := w.Write([]byte(x))
+		return err
+	case map[string]Value:
+		return writeResponseMap(w, x)
+	}
+
+	return fmt.Errorf("handler returned %s, requires a string or a map", TypeName(res))
+}
+
+// writeResponseMap writes a response map. Its status, if any, must be a
+// code net/http can write, from 100 to 999.
+func writeResponseMap(w http.ResponseWriter, res map[string]Value) error {
+
+	status := http.StatusOK
+	if s, ok := res["status"].(int64); ok {
+		if s < 100 || s > 999 {
+			return fmt.Errorf("handler returned status %d, requires 100 to 999", s)
+		}
+		status = int(s)
+	}
+
+	if headers, ok := res["headers"].(map[string]Value); ok {
+		for k, v := range headers {
+			w.Header().Set(k, fmt.Sprintf("%v", v))
+		}
+	}
+
+	w.WriteHeader(status)
+
+	switch body := res["body"].(type) {
+	case nil:
+		return nil
+	case string:
+		_, err := w.Write([]byte(body))
+		return err
+	default:
+		_, err := fmt.Fprintf(w, "%v", body)
+		return err
+	}
+}
@@ -0,0 +1,65 @@
+package compile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeLimitsBody(t *testing.T) {
+
+	ctx := NewTopContext()
+	ctx.SetLimits(Limits{MaxStringLen: 10})
+
+	echo := func(ctx *Context, args ...Value) (Value, error) {
+		return args[0].(map[string]Value)["body"], nil
+	}
+	h := &scriptHandler{ctx: ctx, fn: echo}
+
+	for _, c := range []struct {
+		body   string
+		status int
+	}{
+		{"small", http.StatusOK},
+		{"just right", http.StatusOK},
+		{"much too large", http.StatusRequestEntityTooLarge},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(c.body)))
+
+		if w.Code != c.status {
+			t.Errorf("POST %q: status %d, want %d", c.body, w.Code, c.status)
+		}
+		if c.status == http.StatusOK && w.Body.String() != c.body {
+			t.Errorf("POST %q: body %q", c.body, w.Body.String())
+		}
+	}
+}
+
+func TestServeChecksStatus(t *testing.T) {
+
+	for _, c := range []struct {
+		status int64
+		want   int
+	}{
+		{201, http.StatusCreated},
+		{999, 999},
+		{0, http.StatusInternalServerError},
+		{99, http.StatusInternalServerError},
+		{1000, http.StatusInternalServerError},
+		{-1, http.StatusInternalServerError},
+	} {
+		respond := func(ctx *Context, args ...Value) (Value, error) {
+			return map[string]Value{"status": c.status, "body": "ok"}, nil
+		}
+		h := &scriptHandler{ctx: NewTopContext(), fn: respond}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Code != c.want {
+			t.Errorf("status %d: wrote %d, want %d", c.status, w.Code, c.want)
+		}
+	}
+}
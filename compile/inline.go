@@ -0,0 +1,163 @@
+package compile
+
+import (
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// The calls of tiny functions, e.g. price = fn(r) { r.price }, are compiled
+// to their body, evaluated in the caller's context, rather than to a call,
+// which makes a context for the function, and evaluates its arguments into
+// it. A function is tiny if its body is a single expression, of at most
+// maxInline nodes, that reads names, its parameters and its callers', and
+// applies operators, and nothing else: as it calls nothing, and assigns
+// nothing, no other code can tell whether its parameters are in a context
+// of their own. Its arguments must be names or literals, so that reading
+// them where the body reads its parameters is as reading them once before.
+//
+// A call is inlined if its function is known as the program is compiled, as
+// for ArityErrors. While a run is traced, profiled, or measured for coverage,
+// the call is made as written, so that the function's body is seen to run.
+
+// maxInline is the number of nodes of the largest body inlined.
+const maxInline = 16
+
+// inlineCalls returns the statements of a block with each call of a tiny
+// function known by name given the fn literal as a third child, for
+// compileFuncApply to inline.
+func inlineCalls(stmts []parser.Node) []parser.Node {
+	return knownCalls(stmts, func(call, fn parser.Node) parser.Node {
+		if _, _, ok := inlineBody(call, fn); ok {
+			call.Children = append(call.Children[:2:2], fn)
+		}
+		return call
+	})
+}
+
+// inlineBody returns the expression a call of a tiny function is inlined
+// as, its body with the arguments in place of the parameters, and whether
+// the body returns it, rather than ending with it.
+func inlineBody(call, fn parser.Node) (body parser.Node, returns, ok bool) {
+
+	if !fn.Type().Match(lex.Function) || len(fn.Children) < 2 || len(fn.Children[1].Children) != 1 {
+		return body, false, false
+	}
+
+	params, err := parameterNames(fn.Children[0])
+	if err != nil {
+		return body, false, false
+	}
+
+	args := call.Children[1].Children
+	if len(args) != len(params) {
+		return body, false, false
+	}
+
+	byParam := make(map[string]parser.Node, len(params))
+	for i, a := range args {
+		if !a.Type().Match(lex.Ident, lex.Number, lex.Nil, lex.True, lex.False,
+			lex.DoubleQuoteString, lex.SingleQuoteString, lex.BacktickString) {
+			return body, false, false
+		}
+		byParam[params[i]] = a
+	}
+
+	body = fn.Children[1].Children[0]
+	if body.Type().Match(lex.Return) {
+		if len(body.Children) != 1 {
+			return body, false, false
+		}
+		body, returns = body.Children[0], true
+	}
+
+	if !isTiny(body) {
+		return body, false, false
+	}
+
+	return substitute(body, byParam), returns, true
+}
+
+// isTiny checks if an expression is small enough to inline, and only reads
+// names, and applies operators.
+func isTiny(expr parser.Node) bool {
+
+	nodes, tiny := 0, true
+	parser.Inspect(expr, func(n parser.Node) bool {
+		nodes++
+		if nodes > maxInline || !n.Type().Match(
+			lex.Ident, lex.Number, lex.Nil, lex.True, lex.False,
+			lex.DoubleQuoteString, lex.SingleQuoteString, lex.BacktickString, lex.Regex,
+			lex.Dot, lex.And, lex.Or, lex.Is,
+			lex.Plus, lex.Minus, lex.Mult, lex.Div, lex.Modulo,
+			lex.Equal, lex.NotEqual, lex.Greater, lex.GreaterOrEqual, lex.Less, lex.LessOrEqual) {
+			tiny = false
+		}
+		return tiny
+	})
+
+	return tiny
+}
+
+// substitute returns an expression with the names of parameters replaced by
+// their arguments. The member a dot reads, and the type is checks, are not
+// names.
+func substitute(expr parser.Node, args map[string]parser.Node) parser.Node {
+
+	if expr.Type().Match(lex.Ident) {
+		if a, ok := args[expr.Item.Value]; ok {
+			return a
+		}
+		return expr
+	}
+
+	children := make([]parser.Node, len(expr.Children))
+	for i, c := range expr.Children {
+		if i > 0 && expr.Type().Match(lex.Dot, lex.Is) {
+			children[i] = c
+			continue
+		}
+		children[i] = substitute(c, args)
+	}
+	expr.Children = children
+
+	return expr
+}
+
+// compileInline compiles a call of a tiny function to its body, which falls
+// back to the call while a run is traced, profiled, or measured for
+// coverage. An error is reported as the call's would be, from the function.
+func compileInline(node, body parser.Node, returns bool, call Expr) (Expr, error) {
+
+	expr, err := Compile(body)
+	if err != nil {
+		return nil, err
+	}
+
+	name := CallName(node)
+
+	return func(ctx *Context, vals ...Value) (Value, error) {
+
+		if ctx.hook != nil || ctx.profile != nil || ctx.coverage != nil {
+			return call(ctx)
+		}
+
+		res, err := expr(ctx)
+		if err == nil && !returns {
+			res = NewTuple(true, res)
+		}
+		if err == nil {
+			err = ctx.Account(res)
+		}
+		if err != nil {
+			c, derr := ctx.EnterCall(name, node.Item)
+			if derr != nil {
+				return nil, positioned(node, err)
+			}
+			err = c.Traced(positioned(node, err))
+			c.ExitCall()
+			return nil, err
+		}
+
+		return res, nil
+	}, nil
+}
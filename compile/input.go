@@ -0,0 +1,75 @@
+package compile
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// scriptInput returns the input for a builtin to read, which requires the
+// Stdin capability unless it was given with SetInput.
+func (ctx *Context) scriptInput(name string) (*bufio.Reader, error) {
+
+	ctx.env.inputMu.Lock()
+	given := ctx.env.inputGiven
+	ctx.env.inputMu.Unlock()
+
+	if !given {
+		if err := ctx.require(name, Stdin); err != nil {
+			return nil, err
+		}
+	}
+
+	return ctx.Input(), nil
+}
+
+// builtinReadLine reads the next line of input, without the line ending. At
+// the end of input it returns nil.
+func builtinReadLine(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("read_line", args, 0); err != nil {
+		return nil, err
+	}
+
+	input, err := ctx.scriptInput("read_line")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.env.inputMu.Lock()
+	line, err := input.ReadString('\n')
+	ctx.env.inputMu.Unlock()
+
+	if err == io.EOF && line == "" {
+		return nil, nil
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// builtinReadAll reads the remaining input.
+func builtinReadAll(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("read_all", args, 0); err != nil {
+		return nil, err
+	}
+
+	input, err := ctx.scriptInput("read_all")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.env.inputMu.Lock()
+	all, err := ioutil.ReadAll(input)
+	ctx.env.inputMu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return string(all), nil
+}
@@ -0,0 +1,160 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/pdk/meh/lex"
+)
+
+// Embedders may give scripts values of their own Go types, e.g. money or
+// vectors, that take part in the operators, member access, and calls of
+// scripts by implementing the interfaces below. The built-in types are
+// handled first, so e.g. `1 + 2` is not offered to an Adder.
+
+// Adder is implemented by values that define `a + b`, with the value as a.
+type Adder interface {
+	Add(b Value) (Value, error)
+}
+
+// Subtracter is implemented by values that define `a - b`, with the value as
+// a.
+type Subtracter interface {
+	Sub(b Value) (Value, error)
+}
+
+// Multiplier is implemented by values that define `a * b`, with the value as
+// a.
+type Multiplier interface {
+	Mul(b Value) (Value, error)
+}
+
+// Divider is implemented by values that define `a / b`, with the value as a.
+type Divider interface {
+	Div(b Value) (Value, error)
+}
+
+// Comparer is implemented by values that can be compared with other values,
+// by the comparison operators, Equal, and sort. Compare returns -1, 0, or 1
+// as the value is less than, equal to, or greater than b.
+type Comparer interface {
+	Compare(b Value) (int, error)
+}
+
+// Indexer is implemented by values with members, for `v.name`.
+type Indexer interface {
+	Index(name string) (Value, error)
+}
+
+// Caller is implemented by values that can be called, for `v(args)`, and by
+// builtins that take a function, e.g. map.
+type Caller interface {
+	Call(ctx *Context, args ...Value) (Value, error)
+}
+
+// TypeNamer is implemented by values that name their type, for the type
+// builtin and `is`. The name should be registered with RegisterTypeName.
+type TypeNamer interface {
+	TypeName() string
+}
+
+// isCustomValue checks if a Go value implements any of the interfaces of
+// custom values.
+func isCustomValue(v interface{}) bool {
+	switch v.(type) {
+	case Adder, Subtracter, Multiplier, Divider, Comparer, Indexer, Caller, TypeNamer:
+		return true
+	}
+	return false
+}
+
+// operateValues applies an operator using the interfaces implemented by the
+// values, and returns false if they implement none that applies.
+func operateValues(op lex.Type, a, b Value) (Value, bool, error) {
+
+	switch op {
+	case lex.Plus:
+		if x, ok := a.(Adder); ok {
+			v, err := x.Add(b)
+			return v, true, err
+		}
+	case lex.Minus:
+		if x, ok := a.(Subtracter); ok {
+			v, err := x.Sub(b)
+			return v, true, err
+		}
+	case lex.Mult:
+		if x, ok := a.(Multiplier); ok {
+			v, err := x.Mul(b)
+			return v, true, err
+		}
+	case lex.Div:
+		if x, ok := a.(Divider); ok {
+			v, err := x.Div(b)
+			return v, true, err
+		}
+	case lex.Equal, lex.NotEqual, lex.Less, lex.LessOrEqual, lex.Greater, lex.GreaterOrEqual:
+		c, ok, err := compareValues(a, b)
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		return compared(op, c), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// compareValues compares values with the Comparer of either, and returns
+// false if neither implements it.
+func compareValues(a, b Value) (int, bool, error) {
+
+	if x, ok := a.(Comparer); ok {
+		c, err := x.Compare(b)
+		return c, true, err
+	}
+
+	if y, ok := b.(Comparer); ok {
+		c, err := y.Compare(a)
+		return -c, true, err
+	}
+
+	return 0, false, nil
+}
+
+// compared returns the result of a comparison operator, given the order of
+// its operands.
+func compared(op lex.Type, c int) bool {
+	switch op {
+	case lex.Equal:
+		return c == 0
+	case lex.NotEqual:
+		return c != 0
+	case lex.Less:
+		return c < 0
+	case lex.LessOrEqual:
+		return c <= 0
+	case lex.Greater:
+		return c > 0
+	}
+	return c >= 0
+}
+
+// Callable returns a value as a function, if it is one or implements Caller.
+// The (true, value) tuple a function produces without a return is unwrapped,
+// so that the function a function made can be called directly, e.g.
+// `adder(1)(2)`.
+func Callable(v Value) (func(*Context, ...Value) (Value, error), bool) {
+
+	switch x := Result(v).(type) {
+	case func(*Context, ...Value) (Value, error):
+		return x, true
+	case Caller:
+		return x.Call, true
+	}
+
+	return nil, false
+}
+
+// notCallable is the error for calling a value that is not a function.
+func notCallable(v Value) error {
+	return fmt.Errorf("cannot invoke non-function: %T %v", v, v)
+}
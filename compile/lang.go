@@ -0,0 +1,81 @@
+package compile
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A language level selects the behavior of scripts, so that a later change
+// that would break existing scripts, e.g. to truthiness or scoping, can be
+// made at a new level, leaving the scripts that ask for an earlier level
+// unchanged. The compilers and builtins consult ctx.Lang() where the levels
+// differ.
+
+// The language levels.
+const (
+	Lang1 = 1 // the language as first released
+
+	LatestLang = Lang1
+)
+
+// SetLang selects the language level of scripts run in the context, by
+// default LatestLang. The setting applies to the whole context tree.
+func (ctx *Context) SetLang(level int) error {
+
+	if level < 1 || level > LatestLang {
+		return fmt.Errorf("language level %d is not supported, only 1 to %d", level, LatestLang)
+	}
+
+	ctx.env.lang = level
+	return nil
+}
+
+// Lang returns the language level of scripts run in the context.
+func (ctx *Context) Lang() int {
+	if ctx.env.lang == 0 {
+		return LatestLang
+	}
+	return ctx.env.lang
+}
+
+// langPragma starts the line of a script that selects its language level.
+const langPragma = "#meh:lang"
+
+// LangPragma returns the language level a script asks for with a line among
+// the comments it starts with, e.g.
+//
+//	#!/usr/bin/env meh
+//	#meh:lang 1
+//
+// or 0 if it asks for none. Compiled scripts keep no comments, and so have no
+// pragma.
+func LangPragma(src string) (int, error) {
+
+	s := bufio.NewScanner(strings.NewReader(src))
+	for s.Scan() {
+
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") {
+			return 0, nil
+		}
+
+		if !strings.HasPrefix(line, langPragma) {
+			continue
+		}
+
+		level, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, langPragma)))
+		if err != nil {
+			return 0, fmt.Errorf("malformed %s pragma: %q", langPragma, line)
+		}
+
+		return level, nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,153 @@
+package compile
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+// ErrLimitExceeded is the error, wrapped with details, that stops a run that
+// exceeded one of the Limits given by SetLimits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits bound the memory used by a run, e.g. to stop untrusted scripts from
+// exhausting the memory of the host process. A zero field means no limit.
+type Limits struct {
+	// MaxStringLen is the largest string, in bytes, a run may produce.
+	MaxStringLen int64
+	// MaxListLen is the largest list or map, in elements, a run may produce.
+	MaxListLen int64
+	// MaxValues is the total of the strings, list elements, and map entries
+	// produced by the calls and operators of a run.
+	MaxValues int64
+	// MaxBytes is the total of the bytes of the strings produced by the calls
+	// and operators of a run.
+	MaxBytes int64
+}
+
+// limiter tracks the values produced by a run against its Limits.
+type limiter struct {
+	Limits
+	values int64
+	bytes  int64
+}
+
+// SetLimits limits the memory used by a run. A run that exceeds a limit stops
+// with an error for which errors.Is(err, ErrLimitExceeded) is true. The
+// limits apply to the context and the contexts later created from it, which
+// share the MaxValues and MaxBytes totals, but not to its parent.
+func (ctx *Context) SetLimits(l Limits) {
+	ctx.limits = &limiter{Limits: l}
+}
+
+// maxAlloc is the most bytes a single string or list may take, whatever the
+// limits of a run, as Go panics rather than fail when asked for more than it
+// can allocate. On 32 bit platforms, it is the largest int.
+const maxAlloc = 1<<40*(strconv.IntSize/64) + math.MaxInt32*(1-strconv.IntSize/64)
+
+// valueSize is the size of an element of a list: an interface, of two words.
+const valueSize = 2 * strconv.IntSize / 8
+
+// checkLen checks, before it is built, that a string or collection of n
+// bytes or elements can be allocated, and is within the limits of a run,
+// including what is left of its totals.
+func (ctx *Context) checkLen(name string, n int64, isString bool) error {
+
+	if ctx.limits != nil {
+		if err := ctx.limits.checkLen(n, isString); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	max, what := int64(maxAlloc/valueSize), "list"
+	if isString {
+		max, what = maxAlloc, "string"
+	}
+	if n > max {
+		return fmt.Errorf("%s: %s of %d is too large to allocate", name, what, n)
+	}
+
+	return nil
+}
+
+// maxCount returns the most parts a builtin splitting a string, or finding
+// its matches, needs to find to know that its list would exceed the limits
+// of a run, or -1 if there is no limit, as strings.SplitN takes.
+func (ctx *Context) maxCount() int {
+
+	if ctx.limits == nil || ctx.limits.MaxListLen <= 0 || ctx.limits.MaxListLen >= math.MaxInt32 {
+		return -1
+	}
+
+	return int(ctx.limits.MaxListLen) + 1
+}
+
+func (l *limiter) checkLen(n int64, isString bool) error {
+
+	max, what := l.MaxListLen, "list"
+	if isString {
+		max, what = l.MaxStringLen, "string"
+	}
+
+	if max > 0 && n > max {
+		return fmt.Errorf("%w: %s of %d exceeds %d", ErrLimitExceeded, what, n, max)
+	}
+
+	// the totals are only added to by Account, once the value is built, but
+	// a value that cannot fit in what is left of them need not be built.
+	values, size := n, int64(0)
+	if isString {
+		values, size = 1, n
+	}
+
+	if max := l.MaxValues; max > 0 && values > max-atomic.LoadInt64(&l.values) {
+		return fmt.Errorf("%w: more than %d values", ErrLimitExceeded, max)
+	}
+
+	if max := l.MaxBytes; max > 0 && size > max-atomic.LoadInt64(&l.bytes) {
+		return fmt.Errorf("%w: more than %d bytes of strings", ErrLimitExceeded, max)
+	}
+
+	return nil
+}
+
+// Account checks that a value produced by a run is within its limits, and
+// adds it to the run's total of values. Evaluators account for the results
+// of calls and operators.
+func (ctx *Context) Account(v Value) error {
+
+	if ctx.limits == nil {
+		return nil
+	}
+
+	var n, size int64
+	var err error
+
+	switch x := v.(type) {
+	case string:
+		n, size, err = 1, int64(len(x)), ctx.limits.checkLen(int64(len(x)), true)
+	case []Value:
+		n, err = int64(len(x)), ctx.limits.checkLen(int64(len(x)), false)
+	case map[string]Value:
+		n, err = int64(len(x)), ctx.limits.checkLen(int64(len(x)), false)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	max := ctx.limits.MaxValues
+	if total := atomic.AddInt64(&ctx.limits.values, n); max > 0 && total > max {
+		return fmt.Errorf("%w: more than %d values", ErrLimitExceeded, max)
+	}
+
+	max = ctx.limits.MaxBytes
+	if total := atomic.AddInt64(&ctx.limits.bytes, size); max > 0 && total > max {
+		return fmt.Errorf("%w: more than %d bytes of strings", ErrLimitExceeded, max)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package compile
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+
+	limits := Limits{MaxStringLen: 1000, MaxListLen: 100, MaxValues: 10000, MaxBytes: 5000}
+
+	for _, c := range []struct {
+		src string
+		ok  bool
+	}{
+		{`strings.repeat("x", 1000)`, true},
+		{`map(range(4), fn(i) { return strings.repeat("x", 1000) })`, true},
+		{`map(range(6), fn(i) { return strings.repeat("x", 1000) })`, false},
+		{`strings.replace(strings.repeat("x", 100), "x", "yy")`, true},
+		{`strings.replace(strings.repeat("x", 100), "x", strings.repeat("y", 11))`, false},
+		{`strings.replace(strings.repeat("x", 100), "x", strings.repeat("y", 11), 5)`, true},
+		{`replace(/x/, strings.repeat("x", 100), strings.repeat("y", 11))`, false},
+		{`re_replace(/(x)/, strings.repeat("x", 100), "$1$1")`, true},
+		{`strings.split(strings.repeat("x,", 99), ",")`, true},
+		{`strings.split(strings.repeat("x,", 100), ",")`, false},
+		{`re_findall(/x/, strings.repeat("x", 101))`, false},
+		{`strings.join(list("a", "b"), strings.repeat("y", 999))`, false},
+	} {
+		program, err := NewProgram("limits", c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program.Top().SetLimits(limits)
+
+		_, err = program.Run(nil)
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.src, err)
+		}
+		if !c.ok && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: got %v, want ErrLimitExceeded", c.src, err)
+		}
+	}
+}
+
+// TestLimitsBeforeAllocating checks that the totals alone stop values too big
+// to build, before they are built.
+func TestLimitsBeforeAllocating(t *testing.T) {
+
+	for _, src := range []string{
+		`range(4611686018427387904)`,
+		`strings.repeat("ab", 4611686018427387904)`,
+		`strings.repeat("ab", 100000000)`,
+		`strings.pad("a", 100000000)`,
+		`x = strings.repeat("a", 600)
+		strings.repeat("b", 600)`,
+	} {
+		program, err := NewProgram("limits", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program.Top().SetLimits(Limits{MaxValues: 1000, MaxBytes: 1000})
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err = program.Run(nil)
+		runtime.ReadMemStats(&after)
+
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: got %v, want ErrLimitExceeded", src, err)
+		}
+		if grew := after.TotalAlloc - before.TotalAlloc; grew > 1<<20 {
+			t.Errorf("%s: allocated %d bytes", src, grew)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package compile
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+)
+
+// RunLines runs a compiled script once for each line read from r, in the
+// manner of awk. Each run is in ctx, with these names assigned:
+//
+//	line    the line, without its line ending
+//	fields  the list of the whitespace separated fields of the line
+//	nr      the number of the line, from 1
+//
+// Other names the script assigns are kept from one line to the next, e.g. to
+// total a column. The result of each run is passed to each, which stops the
+// runs if it returns an error.
+func RunLines(ctx *Context, expr Expr, r io.Reader, each func(Value) error) error {
+
+	in := bufio.NewReader(r)
+
+	for nr := int64(1); ; nr++ {
+
+		line, err := in.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		fields := []Value{}
+		for _, f := range strings.Fields(line) {
+			fields = append(fields, f)
+		}
+
+		ctx.Set("line", line)
+		ctx.Set("fields", fields)
+		ctx.Set("nr", nr)
+
+		res, err := apply(ctx, expr, nil)
+		if err != nil {
+			return err
+		}
+
+		if err := each(Result(res)); err != nil {
+			return err
+		}
+	}
+}
+
+// RunLines runs the program for each line read from r, as for the RunLines
+// function, in one new child of its top context, stopping if the Go context
+// is done.
+func (p *Program) RunLines(c context.Context, r io.Reader, each func(interface{}) error) error {
+
+	run := NewContext(p.top)
+	run.SetGoContext(c)
+
+	return RunLines(run, p.expr, r, func(v Value) error {
+		return each(v)
+	})
+}
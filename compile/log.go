@@ -0,0 +1,127 @@
+package compile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogLevel is the severity of a line written by the logging builtins.
+type LogLevel int
+
+const (
+	// LogDebug is for detail that is only of interest while debugging.
+	LogDebug LogLevel = iota
+	// LogInfo is for routine events.
+	LogInfo
+	// LogWarn is for unexpected events that the script can handle.
+	LogWarn
+	// LogError is for failures.
+	LogError
+)
+
+var logLevelNames = [...]string{"debug", "info", "warn", "error"}
+
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// SetLogOutput sets the writer the logging builtins write to. The default is
+// stderr. The setting applies to the whole context tree.
+func (ctx *Context) SetLogOutput(w io.Writer) {
+	ctx.env.logMu.Lock()
+	defer ctx.env.logMu.Unlock()
+
+	ctx.env.logOutput = w
+}
+
+// SetLogLevel sets the lowest level written by the logging builtins. The
+// default is LogDebug, i.e. everything is written. The setting applies to the
+// whole context tree.
+func (ctx *Context) SetLogLevel(l LogLevel) {
+	ctx.env.logLevel = l
+}
+
+// logger returns a builtin that writes a line at a level: log_info(msg) or
+// log_info(msg, fields), where fields is a map. Each line is written as
+// key=value pairs, e.g.
+//
+//	time=2020-01-02T15:04:05Z level=info msg="server started" port=8080
+func logger(name string, level LogLevel) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		if err := expectArgRange(name, args, 1, 2); err != nil {
+			return nil, err
+		}
+
+		msg, err := stringArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var fields map[string]Value
+		if len(args) == 2 {
+			var ok bool
+			fields, ok = args[1].(map[string]Value)
+			if !ok {
+				return nil, fmt.Errorf("%s: argument 2 must be a map, received %s", name, TypeName(args[1]))
+			}
+		}
+
+		if level < ctx.env.logLevel {
+			return nil, nil
+		}
+
+		line := logLine(time.Now(), level, msg, fields)
+
+		ctx.env.logMu.Lock()
+		defer ctx.env.logMu.Unlock()
+
+		w := ctx.env.logOutput
+		if w == nil {
+			w = os.Stderr
+		}
+
+		_, err = io.WriteString(w, line)
+		return nil, err
+	}
+}
+
+// logLine formats a log line, with the fields in key order. Keys are quoted
+// as values are, so that a key with a space or = does not break the line
+// into the wrong pairs.
+func logLine(t time.Time, level LogLevel, msg string, fields map[string]Value) string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "time=%s level=%s msg=%s", t.Format(time.RFC3339), level, logValue(msg))
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%s", logValue(k), logValue(fmt.Sprintf("%v", fields[k])))
+	}
+
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// logValue quotes a value if it would otherwise be ambiguous.
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package compile
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogLine(t *testing.T) {
+
+	at := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, c := range []struct {
+		msg    string
+		fields map[string]Value
+		want   string
+	}{
+		{"started", nil, `time=2020-01-02T15:04:05Z level=info msg=started`},
+		{"server started", map[string]Value{"port": int64(8080), "host": "a b"},
+			`time=2020-01-02T15:04:05Z level=info msg="server started" host="a b" port=8080`},
+		{"hi", map[string]Value{"a b": int64(1), "c=d": int64(2), `"e"`: int64(3), "": int64(4)},
+			`time=2020-01-02T15:04:05Z level=info msg=hi ""=4 "\"e\""=3 "a b"=1 "c=d"=2`},
+		{"", map[string]Value{"list": []Value{int64(1), "x"}}, `time=2020-01-02T15:04:05Z level=info msg="" list="[1 x]"`},
+	} {
+		got := logLine(at, LogInfo, c.msg, c.fields)
+		if got != c.want+"\n" {
+			t.Errorf("logLine(%q, %v) =\n\t%s\nwant\n\t%s", c.msg, c.fields, got, c.want)
+		}
+	}
+}
+
+func TestLogBuiltins(t *testing.T) {
+
+	program, err := NewProgram("log", `
+		log_debug("hidden")
+		log_info("hi", dict("a b", 1))
+		log_warn("careful")
+		log_error("failed", dict("code", 2))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	program.Top().SetLogOutput(&out)
+	program.Top().SetLogLevel(LogInfo)
+
+	if _, err := program.Run(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got := regexp.MustCompile(`time=\S+ `).ReplaceAllString(out.String(), "")
+	want := strings.Join([]string{
+		`level=info msg=hi "a b"=1`,
+		`level=warn msg=careful`,
+		`level=error msg=failed code=2`,
+		``,
+	}, "\n")
+	if got != want {
+		t.Errorf("logged\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := Eval(`log_info("x", 1)`, nil); err == nil || !strings.Contains(err.Error(), "log_info: argument 2 must be a map, received int") {
+		t.Errorf("log_info with an int: %v", err)
+	}
+}
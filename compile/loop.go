@@ -0,0 +1,144 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// compileDoUntil compiles `do { body } until cond`. The body always runs at
+// least once, and the loop stops after the iteration where cond is true.
+func compileDoUntil(node parser.Node) (Expr, error) {
+
+	do := node.Children[0]
+	if !do.Type().Match(lex.Do) || len(do.Children) == 0 {
+		return nil, node.Error(fmt.Errorf("until requires a preceding do block"))
+	}
+
+	label := ""
+	if len(do.Children) > 1 {
+		label = do.Children[1].Item.Value
+	}
+
+	// the body is a block, whose tuple is made for the last iteration only.
+	block := do.Children[0]
+	statements, err := compileStatements(block)
+	if err != nil {
+		return nil, err
+	}
+	body := metered(block, statements)
+
+	cond, err := Compile(node.Children[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx *Context, vals ...Value) (Value, error) {
+
+		var last Value
+		ended := false
+
+		// the value of the loop is the block's of the last iteration that
+		// ran to its end.
+		value := func() Value {
+			if !ended {
+				return nil
+			}
+			return NewTuple(true, last)
+		}
+
+		for {
+			val, err := body(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			stop, result := loopFlow(label, val)
+			if stop {
+				if result == nil {
+					return value(), nil
+				}
+				return result, nil
+			}
+			if flowChange(val) == None {
+				last, ended = val, true
+			}
+
+			c, err := cond(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if ctx.IsTruthy(c) {
+				return value(), nil
+			}
+		}
+	}, nil
+}
+
+// loopFlow decides what a loop with the given label does after its body
+// produced val. The loop stops on a Break targeting it, or on any change of
+// flow that it cannot handle, which is returned to be passed on.
+func loopFlow(label string, val Value) (stop bool, result Value) {
+
+	change, ok := val.(FlowChange)
+	if !ok {
+		return false, nil
+	}
+
+	switch {
+	case change.Type == Return || !change.Targets(label):
+		return true, change
+	case change.Type == Break:
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// LabelErrors returns an error for each labeled break or continue in a
+// program, or the body of a function, that targets a label no loop enclosing
+// it has, e.g. a misspelled one, which would otherwise end the program, or
+// fail the call, as it runs. The bodies of the functions it defines are
+// checked as they are compiled, as a break cannot leave a function.
+func LabelErrors(node parser.Node) diag.List {
+
+	var errs diag.List
+	checkLabels(node, nil, &errs)
+
+	return errs
+}
+
+// checkLabels checks the labeled breaks and continues of a node against the
+// labels of the loops enclosing it.
+func checkLabels(node parser.Node, labels []string, errs *diag.List) {
+
+	switch node.Type() {
+	case lex.Function:
+		return
+	case lex.Break, lex.Continue:
+		if len(node.Children) > 0 && !hasLabel(labels, node.Children[0].Item.Value) {
+			*errs = errs.Append(node.Error(fmt.Errorf("%s to unknown label %q", node.Item.Value, node.Children[0].Item.Value)), diag.Compile)
+		}
+		return
+	case lex.Until:
+		if do := node.Children[0]; do.Type().Match(lex.Do) && len(do.Children) > 1 {
+			labels = append(labels[:len(labels):len(labels)], do.Children[1].Item.Value)
+		}
+	}
+
+	for _, c := range node.Children {
+		checkLabels(c, labels, errs)
+	}
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package compile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pdk/meh/diag"
+)
+
+func TestLabelErrors(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		errs int
+	}{
+		{`do { break } until true`, 0},
+		{`outer: do { do { break outer } until false } until true`, 0},
+		{`outer: do { do { continue outer } until true } until true`, 0},
+		{`x = 0; do { do { break otuer } until false; x = 1 } until true`, 1},
+		{`outer: do { f = fn() { break outer } } until true`, 1},
+		{`break nowhere; continue nowhere`, 2},
+		{`inner: do { 1 } until true; do { break inner } until true`, 1},
+	} {
+		got := 0
+		if _, err := NewProgram("labels", c.src); err != nil {
+			var list diag.List
+			if !errors.As(err, &list) {
+				t.Fatalf("%s: %v", c.src, err)
+			}
+			got = len(list)
+		}
+
+		if got != c.errs {
+			t.Errorf("%s: %d errors, want %d", c.src, got, c.errs)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package compile
+
+import (
+	"fmt"
+	"math"
+)
+
+// mathModule is available to scripts as `math`, e.g. `math.sqrt(2)`.
+// Arguments are coerced the same way as for arithmetic operators: ints are
+// promoted to floats where needed.
+var mathModule = map[string]Value{
+	"pi": math.Pi,
+	"e":  math.E,
+
+	"sqrt":  floatFunc("sqrt", math.Sqrt),
+	"exp":   floatFunc("exp", math.Exp),
+	"log":   floatFunc("log", math.Log),
+	"log2":  floatFunc("log2", math.Log2),
+	"log10": floatFunc("log10", math.Log10),
+	"sin":   floatFunc("sin", math.Sin),
+	"cos":   floatFunc("cos", math.Cos),
+	"tan":   floatFunc("tan", math.Tan),
+	"asin":  floatFunc("asin", math.Asin),
+	"acos":  floatFunc("acos", math.Acos),
+	"atan":  floatFunc("atan", math.Atan),
+
+	"floor": roundingFunc("floor", math.Floor),
+	"ceil":  roundingFunc("ceil", math.Ceil),
+	"round": roundingFunc("round", math.Round),
+
+	"abs": mathAbs,
+
+	"pow": numericFunc("pow", binaryOps{
+		intOp: func(i, j int64) Value {
+			if j < 0 {
+				return math.Pow(float64(i), float64(j))
+			}
+			return intPow(i, j)
+		},
+		floatOp: func(i, j float64) Value { return math.Pow(i, j) },
+	}),
+	"atan2": numericFunc("atan2", binaryOps{
+		floatOp: func(i, j float64) Value { return math.Atan2(i, j) },
+	}),
+	"min": numericFunc("min", minOps),
+	"max": numericFunc("max", maxOps),
+}
+
+var (
+	minOps = binaryOps{
+		intOp: func(i, j int64) Value {
+			if j < i {
+				return j
+			}
+			return i
+		},
+		floatOp: func(i, j float64) Value { return math.Min(i, j) },
+	}
+	maxOps = binaryOps{
+		intOp: func(i, j int64) Value {
+			if j > i {
+				return j
+			}
+			return i
+		},
+		floatOp: func(i, j float64) Value { return math.Max(i, j) },
+	}
+	sumOps = binaryOps{
+		intOp:   func(i, j int64) Value { return i + j },
+		floatOp: func(i, j float64) Value { return i + j },
+	}
+)
+
+// floatArg returns the i'th argument of a builtin as a float, promoting an
+// int.
+func floatArg(name string, args []Value, i int) (float64, error) {
+
+	switch x := args[i].(type) {
+	case float64:
+		return x, nil
+	case int64:
+		return float64(x), nil
+	}
+
+	return 0, fmt.Errorf("%s: argument %d must be a number, received %s", name, i+1, TypeName(args[i]))
+}
+
+// floatFunc adapts a func of one float to a builtin.
+func floatFunc(name string, f func(float64) float64) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		x, err := floatArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return f(x), nil
+	}
+}
+
+// roundingFunc adapts a rounding func to a builtin. Ints are already round,
+// and are returned unchanged.
+func roundingFunc(name string, f func(float64) float64) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		if err := expectArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		if i, ok := args[0].(int64); ok {
+			return i, nil
+		}
+
+		x, err := floatArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		return f(x), nil
+	}
+}
+
+// intPow returns i to the power of j, which is not negative, by squaring, so
+// that a huge exponent takes as long as a small one. It wraps around as
+// multiplying i by itself j times does.
+func intPow(i, j int64) int64 {
+
+	result := int64(1)
+	for ; j > 0; j >>= 1 {
+		if j&1 == 1 {
+			result *= i
+		}
+		i *= i
+	}
+
+	return result
+}
+
+// numericFunc adapts binaryOps of two numbers to a builtin.
+func numericFunc(name string, ops binaryOps) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		if err := expectArgs(name, args, 2); err != nil {
+			return nil, err
+		}
+
+		result, ok := ops.apply(args[0], args[1])
+		if !ok {
+			return nil, fmt.Errorf("%s: cannot apply to argument types %s, %s",
+				name, TypeName(args[0]), TypeName(args[1]))
+		}
+
+		return result, nil
+	}
+}
+
+// mathAbs returns the absolute value of an int or float.
+func mathAbs(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("abs", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch x := args[0].(type) {
+	case int64:
+		if x < 0 {
+			return -x, nil
+		}
+		return x, nil
+	case float64:
+		return math.Abs(x), nil
+	}
+
+	return nil, fmt.Errorf("abs: argument 1 must be a number, received %s", TypeName(args[0]))
+}
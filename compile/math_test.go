@@ -0,0 +1,42 @@
+package compile
+
+import (
+	"testing"
+)
+
+func TestPowHugeExponent(t *testing.T) {
+
+	pow := mathModule["pow"].(func(*Context, ...Value) (Value, error))
+
+	for _, c := range []struct {
+		i, j, want int64
+	}{
+		{1, 9000000000000000000, 1},
+		{-1, 9000000000000000001, -1},
+		{0, 9000000000000000000, 0},
+		{2, 10, 1024},
+		{3, 0, 1},
+		{-3, 5, -243},
+	} {
+		got, err := pow(NewTopContext(), c.i, c.j)
+		if err != nil {
+			t.Fatalf("pow(%d, %d): %v", c.i, c.j, err)
+		}
+		if got != c.want {
+			t.Errorf("pow(%d, %d) = %v, want %d", c.i, c.j, got, c.want)
+		}
+	}
+}
+
+func TestPowWrapsAsMultiplying(t *testing.T) {
+
+	for _, i := range []int64{3, -7, 1 << 20} {
+		want := int64(1)
+		for j := int64(0); j <= 100; j++ {
+			if got := intPow(i, j); got != want {
+				t.Fatalf("intPow(%d, %d) = %d, want %d", i, j, got, want)
+			}
+			want *= i
+		}
+	}
+}
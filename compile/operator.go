@@ -0,0 +1,108 @@
+package compile
+
+import (
+	"fmt"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// OperatorFunc applies a registered operator to its operands.
+type OperatorFunc func(ctx *Context, left, right Value) (Value, error)
+
+// customOperators holds the handlers of the registered operators.
+var customOperators = struct {
+	sync.RWMutex
+	handlers map[lex.Type]OperatorFunc
+}{
+	handlers: make(map[lex.Type]OperatorFunc),
+}
+
+// RegisterOperator adds a binary operator to the language, e.g. for a DSL:
+// the lexer reads the symbol, of one or two runes, or a word, which becomes
+// a keyword, the parser gathers it at the precedence, and scripts apply the
+// handler to its operands. For example
+//
+//	compile.RegisterOperator("~=", parser.Comparison, func(ctx *compile.Context, l, r compile.Value) (compile.Value, error) {
+//		...
+//	})
+//
+// lets scripts write `name ~= /^a/`, and registering "when" lets them write
+// `discount when total > 100`. Operators should be registered before any
+// script is parsed, e.g. in an init function.
+func RegisterOperator(symbol string, p parser.Precedence, handler OperatorFunc) (lex.Type, error) {
+
+	if handler == nil {
+		return lex.Error, fmt.Errorf("operator %q requires a handler", symbol)
+	}
+
+	register := lex.RegisterOperator
+	if r, _ := utf8.DecodeRuneInString(symbol); lex.IsIdentRune(r) {
+		register = func(word string) (lex.Type, error) {
+			return lex.RegisterKeyword(word, lex.Nada)
+		}
+	}
+
+	op, err := register(symbol)
+	if err != nil {
+		return lex.Error, err
+	}
+
+	customOperators.Lock()
+	customOperators.handlers[op] = handler
+	customOperators.Unlock()
+
+	parser.RegisterOperator(op, p)
+
+	return op, nil
+}
+
+// CustomOperator returns the handler of a registered operator.
+func CustomOperator(op lex.Type) (OperatorFunc, bool) {
+
+	customOperators.RLock()
+	defer customOperators.RUnlock()
+
+	handler, ok := customOperators.handlers[op]
+	return handler, ok
+}
+
+// compileCustomOperator compiles the application of a registered operator.
+func compileCustomOperator(node parser.Node, handler OperatorFunc) (Expr, error) {
+
+	if len(node.Children) != 2 {
+		return nil, node.Error(fmt.Errorf("operator %s requires 2 operands", node.Item.Value))
+	}
+
+	left, err := Compile(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	right, err := Compile(node.Children[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx *Context, vals ...Value) (Value, error) {
+		lVal, err := left(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rVal, err := right(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := handler(ctx, lVal, rVal)
+		if err == nil {
+			err = ctx.Account(result)
+		}
+		if err != nil {
+			return nil, positioned(node, err)
+		}
+
+		return result, nil
+	}, nil
+}
@@ -0,0 +1,56 @@
+package compile
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// PluginEntry is the name of the function a plugin exports to register its
+// builtins.
+const PluginEntry = "Register"
+
+// LoadPlugin loads a Go plugin, and calls its Register function with the
+// context, so that it can add builtins with Set, RegisterFunc, and so on.
+// Register may return nothing, or an error. For example, a plugin built
+// with `go build -buildmode=plugin` from
+//
+//	package main
+//
+//	import "github.com/pdk/meh/compile"
+//
+//	func Register(ctx *compile.Context) error {
+//		return ctx.RegisterFunc("greet", func(name string) string {
+//			return "hello, " + name
+//		})
+//	}
+//
+// gives scripts greet(name). The plugin must be built with the same version
+// of Go and of this module as the program loading it, and plugins are only
+// supported on some platforms, e.g. Linux and macOS with cgo.
+func (ctx *Context) LoadPlugin(path string) error {
+
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot load plugin %s: %v", path, err)
+	}
+
+	sym, err := p.Lookup(PluginEntry)
+	if err != nil {
+		return fmt.Errorf("cannot load plugin %s: %v", path, err)
+	}
+
+	switch register := sym.(type) {
+	case func(*Context) error:
+		err = register(ctx)
+	case func(*Context):
+		register(ctx)
+	default:
+		return fmt.Errorf("cannot load plugin %s: %s is %T, requires func(*compile.Context) error", path, PluginEntry, sym)
+	}
+
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+
+	return nil
+}
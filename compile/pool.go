@@ -0,0 +1,68 @@
+package compile
+
+import "sync"
+
+// The contexts of calls, and the frames of functions, are reused once their
+// call returns, rather than left to the garbage collector, as a script makes
+// many calls, most of them short. So a context must not be kept after its
+// call returns, e.g. by a builtin, or a hook.
+
+// callContext is the context of a call, allocated with its frame.
+type callContext struct {
+	Context
+	frame Frame
+}
+
+var callContexts = sync.Pool{
+	New: func() interface{} { return new(callContext) },
+}
+
+// smallFrame is the number of slots allocated with a frame's context, which
+// suits most functions; larger frames allocate their slots apart.
+const smallFrame = 4
+
+// frameContext is the context of a function's call, allocated with its
+// slots, if there are few.
+type frameContext struct {
+	Context
+	small [smallFrame]Value
+	large []Value
+}
+
+var frameContexts = sync.Pool{
+	New: func() interface{} { return new(frameContext) },
+}
+
+// ExitCall lets the context of a call, from EnterCall, be reused, once the
+// call has returned, and its error is traced. The context must not be used
+// afterwards.
+func (ctx *Context) ExitCall() {
+
+	c, ok := ctx.recycle.(*callContext)
+	if !ok {
+		return
+	}
+
+	*c = callContext{}
+	callContexts.Put(c)
+}
+
+// releaseFrame lets the context of a function's call, from newFrame, be
+// reused once the call has returned. The buffers it holds, its large slots
+// and its stack of arguments, are kept for the next call.
+func (ctx *Context) releaseFrame() {
+
+	f, ok := ctx.recycle.(*frameContext)
+	if !ok {
+		return
+	}
+
+	large, stack := f.large, f.argStack[:0]
+	for i := range large {
+		large[i] = nil
+	}
+
+	*f = frameContext{}
+	f.large, f.argStack = large, stack
+	frameContexts.Put(f)
+}
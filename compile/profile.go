@@ -0,0 +1,143 @@
+package compile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pdk/meh/parser"
+)
+
+// Profile records how often each node of a script is evaluated, and for how
+// long, to find the hot spots of a script. It is safe for concurrent use.
+type Profile struct {
+	mu    sync.Mutex
+	nodes map[profileKey]*profileEntry
+}
+
+// profileEntry is a NodeProfile, and the evaluations of the node under way.
+type profileEntry struct {
+	NodeProfile
+	active int
+	since  time.Time
+}
+
+// NodeProfile is the record of a node in a Profile. Time is the time during
+// which the node was being evaluated, including the time spent evaluating its
+// children and the functions it calls. Time spent in a recursive evaluation
+// of a node is only counted once.
+type NodeProfile struct {
+	File   string
+	Line   int
+	Column int
+	Node   string // the type and text of the node, e.g. FuncApply f
+	Hits   int64
+	Time   time.Duration
+}
+
+type profileKey struct {
+	file         string
+	line, column int
+	node         string
+}
+
+// NewProfile returns an empty Profile.
+func NewProfile() *Profile {
+	return &Profile{nodes: make(map[profileKey]*profileEntry)}
+}
+
+// SetProfile records the evaluation of each node in a profile. It applies to
+// the context and the contexts later created from it, but not to its parent.
+func (ctx *Context) SetProfile(p *Profile) {
+	ctx.profile = p
+}
+
+// enter records the start of an evaluation of a node, and returns the entry
+// to pass to exit at its end.
+func (p *Profile) enter(node parser.Node) *profileEntry {
+
+	key := profileKey{
+		line:   node.Item.Line,
+		column: node.Item.Column,
+		node:   node.Type().String() + " " + node.Item.Value,
+	}
+	if node.Item.Lexer != nil {
+		key.file = node.Item.Name()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.nodes[key]
+	if e == nil {
+		e = &profileEntry{NodeProfile: NodeProfile{
+			File:   key.file,
+			Line:   key.line,
+			Column: key.column,
+			Node:   key.node,
+		}}
+		p.nodes[key] = e
+	}
+
+	e.Hits++
+	if e.active == 0 {
+		e.since = time.Now()
+	}
+	e.active++
+
+	return e
+}
+
+// exit records the end of an evaluation of a node.
+func (p *Profile) exit(e *profileEntry) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.active--
+	if e.active == 0 {
+		e.Time += time.Since(e.since)
+	}
+}
+
+// Nodes returns the records of the profile, the most time first.
+func (p *Profile) Nodes() []NodeProfile {
+
+	p.mu.Lock()
+	nodes := make([]NodeProfile, 0, len(p.nodes))
+	for _, e := range p.nodes {
+		nodes = append(nodes, e.NodeProfile)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return nodes
+}
+
+// WriteReport writes a table of the records of the profile, the most time
+// first, with one line per node: file:line:column, hits, time, and node.
+func (p *Profile) WriteReport(w io.Writer) error {
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "position\thits\ttime\t\n")
+
+	for _, np := range p.Nodes() {
+		fmt.Fprintf(tw, "%s:%d:%d\t%d\t%v\t  %s\n",
+			np.File, np.Line, np.Column, np.Hits, np.Time, np.Node)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,109 @@
+package compile
+
+import (
+	"context"
+	"io"
+
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/parser"
+)
+
+// Program is a compiled script that can be run many times, e.g. compiled
+// once when a service starts, and run for each request. Runs may be
+// concurrent: each has its own child of the program's top context, so that
+// names assigned by one run are not seen by another.
+type Program struct {
+	node parser.Node
+	expr Expr
+	top  *Context
+}
+
+// NewProgram parses and compiles a script. The name is used in the positions
+// of errors. If the script cannot be parsed, the error is a diag.List.
+func NewProgram(name, src string) (*Program, error) {
+	node, errs := parser.NewFromString(name, src).Parse()
+	if len(errs) > 0 {
+		return nil, diag.ListOf(errs)
+	}
+
+	return compileProgram(node)
+}
+
+// LoadProgram reads a program written by Save, and compiles it, without
+// parsing the script again.
+func LoadProgram(r io.Reader) (*Program, error) {
+
+	node, err := parser.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return compileProgram(node)
+}
+
+func compileProgram(node parser.Node) (*Program, error) {
+
+	if errs := LabelErrors(node); len(errs) > 0 {
+		return nil, errs
+	}
+
+	expr, err := Compile(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		node: node,
+		expr: expr,
+		top:  NewTopContext(),
+	}, nil
+}
+
+// Save writes the program, so that it can be loaded with LoadProgram, e.g. by
+// a service shipping scripts checked by a build step.
+func (p *Program) Save(w io.Writer) error {
+	return parser.Encode(w, p.node)
+}
+
+// Top returns the top context shared by the runs of the program. Settings
+// (Allow, SetFuel, and so on) and names (Bind, RegisterFunc) given to it
+// before the first run apply to every run. Each run is given the fuel and
+// limits set on it afresh, rather than sharing them with the other runs.
+func (p *Program) Top() *Context {
+	return p.top
+}
+
+// Run runs the program in a new child of its top context, and returns the
+// value of its last statement, or of a top level return. The vars are
+// assigned in the child context before the program runs, converted as for
+// Bind.
+func (p *Program) Run(vars map[string]interface{}) (interface{}, error) {
+	return p.RunContext(context.Background(), vars)
+}
+
+// RunContext is Run, stopping the run when a Go context is done, as for
+// SetGoContext.
+func (p *Program) RunContext(c context.Context, vars map[string]interface{}) (interface{}, error) {
+
+	// each run has fuel and limits of its own, as set on the top context,
+	// rather than sharing what earlier runs left.
+	run := NewContext(p.top)
+	run.SetGoContext(c)
+	if n, ok := p.top.Fuel(); ok {
+		run.SetFuel(n)
+	}
+	if p.top.limits != nil {
+		run.SetLimits(p.top.limits.Limits)
+	}
+
+	for name, v := range vars {
+		run.Bind(name, v)
+	}
+
+	res, err := apply(run, p.expr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return Result(res), nil
+}
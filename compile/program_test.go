@@ -0,0 +1,92 @@
+package compile
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRunsHaveTheirOwnBudget(t *testing.T) {
+
+	program, err := NewProgram("budget", `strings.repeat("x", n)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program.Top().SetFuel(200)
+	program.Top().SetLimits(Limits{MaxValues: 5, MaxBytes: 100})
+
+	for i := 0; i < 10; i++ {
+		if _, err := program.Run(map[string]interface{}{"n": 60}); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	if n, _ := program.Top().Fuel(); n != 200 {
+		t.Errorf("top fuel = %d, want 200", n)
+	}
+}
+
+// TestConcurrentRuns runs one program from many goroutines, which go test
+// -race checks for data races.
+func TestConcurrentRuns(t *testing.T) {
+
+	program, err := NewProgram("concurrent", `
+		fib = fn(n) { n < 2 && return n; return fib(n - 1) + fib(n - 2) }
+		total = 0
+		i = 0
+		do { total = total + fib(i); i = i + 1 } until i > n
+		words = map(range(n), fn(k) { strings.repeat(prefix, k % 3) })
+		list(total, len(strings.join(words, "")), scale * n, randint(1, 9) < 10)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program.Top().Bind("scale", 3)
+	program.Top().SetFuel(1000000)
+	program.Top().SetLimits(Limits{MaxValues: 100000, MaxBytes: 100000})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				n := (g+i)%10 + 1
+				v, err := program.Run(map[string]interface{}{"n": n, "prefix": "ab"})
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				repeated := 0
+				for k := 0; k < n; k++ {
+					repeated += 2 * (k % 3)
+				}
+
+				want := []Value{fibSum(n), int64(repeated), int64(3 * n), true}
+				if !reflect.DeepEqual(v, want) {
+					errs <- fmt.Errorf("n = %d: got %v, want %v", n, v, want)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// fibSum returns the sum of the Fibonacci numbers up to the n'th.
+func fibSum(n int) int64 {
+	var sum, a, b int64 = 0, 0, 1
+	for i := 0; i <= n; i++ {
+		sum += a
+		a, b = b, a+b
+	}
+	return sum
+}
@@ -0,0 +1,41 @@
+package compile
+
+import (
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// Pruned is what Prune dropped from the statements of a block.
+type Pruned struct {
+	Unreachable []parser.Node // the statements after a return, break, or continue
+	Empty       []parser.Node // the empty blocks before the last statement
+}
+
+// Prune returns the statements of a block that compileBlock keeps: those up
+// to the first return, break, or continue, which can run, less the empty
+// blocks before the last statement, which have no effect. An empty block
+// that is the last statement is kept, as it is the value of the block. Lint
+// reports what is dropped.
+func Prune(stmts []parser.Node) ([]parser.Node, Pruned) {
+
+	var pruned Pruned
+
+	for i, stmt := range stmts {
+		if stmt.Type().Match(lex.Return, lex.Break, lex.Continue) {
+			pruned.Unreachable = stmts[i+1:]
+			stmts = stmts[:i+1]
+			break
+		}
+	}
+
+	kept := make([]parser.Node, 0, len(stmts))
+	for i, stmt := range stmts {
+		if i < len(stmts)-1 && stmt.Type().Match(lex.LeftBrace) && len(stmt.Children) == 0 {
+			pruned.Empty = append(pruned.Empty, stmt)
+			continue
+		}
+		kept = append(kept, stmt)
+	}
+
+	return kept, pruned
+}
@@ -0,0 +1,38 @@
+package compile
+
+import "fmt"
+
+// ScriptError is the error raised by a script with the error builtin, as
+// opposed to an error detected by the interpreter.
+type ScriptError struct {
+	Message string
+}
+
+func (e ScriptError) Error() string {
+	return e.Message
+}
+
+// builtinError stops the script with an error, reported at the position of
+// the call: error(msg), or error(format, args...) to format the message as
+// the format builtin does.
+func builtinError(ctx *Context, args ...Value) (Value, error) {
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("error: requires a message")
+	}
+
+	if len(args) == 1 {
+		msg, err := stringArg("error", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ScriptError{Message: msg}
+	}
+
+	msg, err := builtinFormat(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error: %v", err)
+	}
+
+	return nil, ScriptError{Message: msg.(string)}
+}
@@ -0,0 +1,39 @@
+package compile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScriptError(t *testing.T) {
+
+	for _, c := range []struct {
+		src, msg, at string
+	}{
+		{`error("failed")`, "failed", "eval:1:1 "},
+		{"x = 1\n  error(\"bad %d\", x)", "bad 1", "eval:2:3 "},
+		{"f = fn(n) {\n    n > 2 && error(\"too big: %d\", n)\n}\nf(3)", "too big: 3", "eval:2:14 "},
+	} {
+		_, err := Eval(c.src, nil)
+
+		var serr ScriptError
+		if !errors.As(err, &serr) {
+			t.Errorf("%q: got %v, want a ScriptError", c.src, err)
+			continue
+		}
+		if serr.Message != c.msg {
+			t.Errorf("%q: message %q, want %q", c.src, serr.Message, c.msg)
+		}
+		if !strings.HasPrefix(err.Error(), c.at) {
+			t.Errorf("%q: error %q, want it at %s", c.src, err, c.at)
+		}
+	}
+
+	for _, src := range []string{`error()`, `error(1)`, `error("%d", "x")`} {
+		_, err := Eval(src, nil)
+		if err == nil || errors.As(err, &ScriptError{}) {
+			t.Errorf("%s: got %v, want an error of the call, not a ScriptError", src, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package compile
+
+import (
+	"fmt"
+	"math"
+)
+
+// builtinRand returns a random float in [0.0, 1.0).
+func builtinRand(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("rand", args, 0); err != nil {
+		return nil, err
+	}
+
+	return ctx.random().Float64(), nil
+}
+
+// builtinRandInt returns a random int between a and b, inclusive:
+// randint(a, b).
+func builtinRandInt(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("randint", args, 2); err != nil {
+		return nil, err
+	}
+
+	a, err := intArg("randint", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := intArg("randint", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if b < a {
+		return nil, fmt.Errorf("randint: empty range %d to %d", a, b)
+	}
+
+	// the range has span+1 ints, which overflows an int64 if it is wider
+	// than half of them: draw from 64 bits then, rejecting those past it.
+	span := uint64(b) - uint64(a)
+	if span < math.MaxInt64 {
+		return a + ctx.random().Int63n(int64(span)+1), nil
+	}
+
+	r := ctx.random()
+	for {
+		v := r.Uint64()
+		if v <= span {
+			return int64(uint64(a) + v), nil
+		}
+	}
+}
+
+// builtinShuffle returns a copy of a list in random order.
+func builtinShuffle(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("shuffle", args, 1); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("shuffle", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	shuffled := append([]Value{}, list...)
+	ctx.random().Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return shuffled, nil
+}
+
+// builtinChoice returns a random element of a list.
+func builtinChoice(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("choice", args, 1); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("choice", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("choice: empty list")
+	}
+
+	return list[ctx.random().Intn(len(list))], nil
+}
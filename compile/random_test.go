@@ -0,0 +1,30 @@
+package compile
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRandIntFullRange(t *testing.T) {
+
+	ctx := NewTopContext()
+	ctx.Seed(1)
+
+	for _, r := range []struct{ a, b int64 }{
+		{0, math.MaxInt64},
+		{-1, math.MaxInt64},
+		{math.MinInt64, math.MaxInt64},
+		{math.MinInt64, 0},
+		{math.MaxInt64, math.MaxInt64},
+	} {
+		for i := 0; i < 100; i++ {
+			v, err := builtinRandInt(ctx, r.a, r.b)
+			if err != nil {
+				t.Fatalf("randint(%d, %d): %v", r.a, r.b, err)
+			}
+			if n := v.(int64); n < r.a || n > r.b {
+				t.Fatalf("randint(%d, %d) = %d, out of range", r.a, r.b, n)
+			}
+		}
+	}
+}
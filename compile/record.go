@@ -0,0 +1,111 @@
+package compile
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Record is a Go struct, or a pointer to one, exposed to scripts. Its
+// exported fields and methods are available by member access, e.g.
+// `order.total` or `order.Discount(10)`, and are read from the struct when
+// accessed, so a record bound to a pointer sees changes made by Go code.
+type Record struct {
+	v reflect.Value
+}
+
+// Bind makes a Go value available to scripts in the context under a name.
+// Structs, and pointers to structs, become records. Slices and arrays become
+// lists, and maps with string keys become maps, converting each element in
+// the same way. Funcs become functions, as for RegisterFunc. Ints and floats
+// of any size become ints and floats, except unsigned ints too large for an
+// int, which become floats.
+func (ctx *Context) Bind(name string, v interface{}) {
+	ctx.Set(name, FromGo(v))
+}
+
+// Field returns the value of an exported field or method of the record. A
+// name matches a field or method of the same name, or, failing that, of the
+// same name ignoring case, so that `order.total` finds a field Total.
+func (r Record) Field(name string) (Value, bool) {
+
+	if m := r.method(name); m.IsValid() {
+		f, err := goFunc(name, m.Interface())
+		if err != nil {
+			return nil, false
+		}
+		return f, true
+	}
+
+	s := reflect.Indirect(r.v)
+	if s.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	f, ok := s.Type().FieldByName(name)
+	if !ok || f.PkgPath != "" {
+		f, ok = s.Type().FieldByNameFunc(func(n string) bool {
+			return strings.EqualFold(n, name)
+		})
+	}
+	if !ok || f.PkgPath != "" {
+		return nil, false
+	}
+
+	// walk the embedded structs, as FieldByIndex panics at a nil pointer to
+	// one; a field promoted from a nil pointer is nil.
+	v := s
+	for i, x := range f.Index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				return nil, true
+			}
+			v = reflect.Indirect(v)
+		}
+		v = v.Field(x)
+	}
+
+	return fromReflect(v), true
+}
+
+// fields returns the exported fields of the record as a map.
+func (r Record) fields() map[string]Value {
+
+	m := make(map[string]Value)
+
+	s := reflect.Indirect(r.v)
+	for i := 0; i < s.NumField(); i++ {
+		if f := s.Type().Field(i); f.PkgPath == "" {
+			m[f.Name] = fromReflect(s.Field(i))
+		}
+	}
+
+	return m
+}
+
+// method returns the exported method of the record with a name, or the zero
+// Value.
+func (r Record) method(name string) reflect.Value {
+
+	if m := r.v.MethodByName(name); m.IsValid() {
+		return m
+	}
+
+	t := r.v.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		if strings.EqualFold(t.Method(i).Name, name) {
+			return r.v.Method(i)
+		}
+	}
+
+	return reflect.Value{}
+}
+
+// Interface returns the Go value of the record.
+func (r Record) Interface() interface{} {
+	return r.v.Interface()
+}
+
+func (r Record) String() string {
+	return fmt.Sprintf("%v", reflect.Indirect(r.v).Interface())
+}
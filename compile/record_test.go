@@ -0,0 +1,39 @@
+package compile
+
+import (
+	"testing"
+)
+
+type testInner struct {
+	X int
+}
+
+type testOuter struct {
+	*testInner
+	Name string
+}
+
+func TestRecordField(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		vars map[string]interface{}
+		want interface{}
+	}{
+		{"o.Name", map[string]interface{}{"o": testOuter{Name: "a"}}, "a"},
+		{"o.name", map[string]interface{}{"o": &testOuter{Name: "a"}}, "a"},
+		{"o.X", map[string]interface{}{"o": testOuter{testInner: &testInner{X: 3}}}, int64(3)},
+		{"o.x", map[string]interface{}{"o": &testOuter{testInner: &testInner{X: 3}}}, int64(3)},
+		{"o.X", map[string]interface{}{"o": testOuter{Name: "a"}}, nil},
+		{"o.X", map[string]interface{}{"o": &testOuter{Name: "a"}}, nil},
+	} {
+		got, err := Eval(c.src, c.vars)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package compile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pdk/meh/parser"
+)
+
+// compileRegex compiles a regex literal, e.g. /^a.*b$/i, so that a bad
+// pattern is reported before execution.
+func compileRegex(node parser.Node) (Expr, error) {
+
+	lit := node.Item.Value
+	end := strings.LastIndex(lit, "/")
+	if end < 1 {
+		return nil, node.Error(fmt.Errorf("malformed regex"))
+	}
+
+	pattern, flags := lit[1:end], lit[end+1:]
+
+	for _, f := range flags {
+		if !strings.ContainsRune("imsU", f) {
+			return nil, node.Error(fmt.Errorf("unknown regex flag %q", f))
+		}
+	}
+
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, node.Error(fmt.Errorf("invalid regex: %v", err))
+	}
+
+	return valFunc(re), nil
+}
+
+// toRegexp converts a regex or a string pattern to a *regexp.Regexp.
+func toRegexp(name string, v Value) (*regexp.Regexp, error) {
+
+	switch x := v.(type) {
+	case *regexp.Regexp:
+		return x, nil
+	case string:
+		re, err := regexp.Compile(x)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid regex: %v", name, err)
+		}
+		return re, nil
+	}
+
+	return nil, fmt.Errorf("%s: requires a regex, received %s", name, TypeName(v))
+}
+
+// regexMatcher returns a builtin that checks if a string matches a regex:
+// match(re, s).
+func regexMatcher(name string) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		re, s, err := regexArgs(name, args, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		return re.MatchString(s), nil
+	}
+}
+
+// regexReplacer returns a builtin that replaces all matches of a regex in a
+// string: replace(re, s, replacement). The replacement may refer to
+// submatches, e.g. $1 or ${name}.
+func regexReplacer(name string) Value {
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		re, s, err := regexArgs(name, args, 3)
+		if err != nil {
+			return nil, err
+		}
+
+		repl, err := stringArg(name, args, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		if ctx.limits == nil {
+			return re.ReplaceAllString(s, repl), nil
+		}
+
+		return replaceAll(ctx, name, re, s, repl)
+	}
+}
+
+// replaceAll is re.ReplaceAllString, checking the length of the result
+// against the limits of a run as it is built, rather than once it is.
+func replaceAll(ctx *Context, name string, re *regexp.Regexp, s, repl string) (Value, error) {
+
+	b := []byte{}
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		b = append(b, s[last:loc[0]]...)
+		b = re.ExpandString(b, repl, s, loc)
+		last = loc[1]
+
+		if err := ctx.checkLen(name, int64(len(b)+len(s)-last), true); err != nil {
+			return nil, err
+		}
+	}
+
+	return string(append(b, s[last:]...)), nil
+}
+
+// regexArgs checks the arguments of a regex builtin, and returns the leading
+// regex and string.
+func regexArgs(name string, args []Value, count int) (*regexp.Regexp, string, error) {
+
+	if err := expectArgs(name, args, count); err != nil {
+		return nil, "", err
+	}
+
+	re, err := toRegexp(name, args[0])
+	if err != nil {
+		return nil, "", err
+	}
+
+	s, err := stringArg(name, args, 1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return re, s, nil
+}
+
+// captures converts the submatch indexes of a match to a list of the whole
+// match followed by each group. A group that did not participate is nil.
+func captures(s string, loc []int) []Value {
+
+	groups := make([]Value, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] >= 0 {
+			groups[i] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+
+	return groups
+}
+
+// builtinReFind returns the first match of a regex in a string as a list of
+// the whole match followed by each group, or nil if there is no match:
+// re_find(re, s).
+func builtinReFind(ctx *Context, args ...Value) (Value, error) {
+
+	re, s, err := regexArgs("re_find", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+
+	return captures(s, loc), nil
+}
+
+// builtinReFindAll returns a list of every match of a regex in a string, each
+// a list as produced by re_find: re_findall(re, s).
+func builtinReFindAll(ctx *Context, args ...Value) (Value, error) {
+
+	re, s, err := regexArgs("re_findall", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	locs := re.FindAllStringSubmatchIndex(s, ctx.maxCount())
+	if err := ctx.checkLen("re_findall", int64(len(locs)), false); err != nil {
+		return nil, err
+	}
+
+	matches := []Value{}
+	for _, loc := range locs {
+		matches = append(matches, captures(s, loc))
+	}
+
+	return matches, nil
+}
+
+// builtinReGroups returns a map of the named groups of the first match of a
+// regex in a string, or nil if there is no match: re_groups(re, s), e.g.
+// re_groups(/(?P<user>\w+)@(?P<host>\w+)/, s).host
+func builtinReGroups(ctx *Context, args ...Value) (Value, error) {
+
+	re, s, err := regexArgs("re_groups", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+
+	groups := captures(s, loc)
+	named := make(map[string]Value)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			named[name] = groups[i]
+		}
+	}
+
+	return named, nil
+}
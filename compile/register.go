@@ -0,0 +1,95 @@
+package compile
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RegisterFunc makes a Go function available to scripts in the context under
+// a name, e.g.
+//
+//	ctx.RegisterFunc("discount", func(price float64, pct int) float64 { ... })
+//
+// Arguments are converted to the function's parameter types as by toGo, and
+// results back as for Bind. A function with several results returns them to
+// the script as a list. If the last result is an error, a non-nil error stops
+// the script, and is not otherwise returned.
+func (ctx *Context) RegisterFunc(name string, fn interface{}) error {
+
+	f, err := goFunc(name, fn)
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.Set(name, f)
+	return err
+}
+
+// goFunc adapts a Go function to a function Value.
+func goFunc(name string, fn interface{}) (func(*Context, ...Value) (Value, error), error) {
+
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func || fv.IsNil() {
+		return nil, fmt.Errorf("%s: requires a func, received %T", name, fn)
+	}
+
+	ft := fv.Type()
+	nIn, nOut := ft.NumIn(), ft.NumOut()
+
+	returnsErr := nOut > 0 && ft.Out(nOut-1) == errorType
+	if returnsErr {
+		nOut--
+	}
+
+	return func(ctx *Context, args ...Value) (Value, error) {
+
+		if ft.IsVariadic() {
+			if len(args) < nIn-1 {
+				return nil, fmt.Errorf("%s: received %d arguments, requires at least %d", name, len(args), nIn-1)
+			}
+		} else if err := expectArgs(name, args, nIn); err != nil {
+			return nil, err
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, a := range args {
+			t := paramType(ft, i)
+			v, err := toGo(a, t)
+			if err != nil {
+				return nil, fmt.Errorf("%s: argument %d: %v", name, i+1, err)
+			}
+			in[i] = v
+		}
+
+		out := fv.Call(in)
+
+		if returnsErr {
+			if err, _ := out[nOut].Interface().(error); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		switch nOut {
+		case 0:
+			return nil, nil
+		case 1:
+			return fromReflect(out[0]), nil
+		}
+
+		results := make([]Value, nOut)
+		for i := range results {
+			results[i] = fromReflect(out[i])
+		}
+
+		return results, nil
+	}, nil
+}
+
+// paramType returns the type of the i'th argument of a function, which for a
+// variadic function may be one of the variadic arguments.
+func paramType(ft reflect.Type, i int) reflect.Type {
+	if ft.IsVariadic() && i >= ft.NumIn()-1 {
+		return ft.In(ft.NumIn() - 1).Elem()
+	}
+	return ft.In(i)
+}
@@ -0,0 +1,25 @@
+package compile
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegisterFuncKeepsErrors(t *testing.T) {
+
+	errNotFound := errors.New("not found")
+
+	program, err := NewProgram("register", `f = fn() { lookup("x") }; f()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := program.Top().RegisterFunc("lookup", func(key string) (string, error) {
+		return "", errNotFound
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := program.Run(nil); !errors.Is(err, errNotFound) {
+		t.Errorf("got %v, want an error wrapping errNotFound", err)
+	}
+}
@@ -0,0 +1,104 @@
+package compile
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Render formats a value for display, e.g. by a REPL, much as a script would
+// write it: strings are quoted, lists are [1, 2], maps are {"a": 1} with
+// sorted keys, tuples are (1, 2), and functions are fn. A successful call's
+// (true, value) tuple is rendered as its value, and a return as the value
+// returned. Values of other types, e.g. those of embedders, are rendered with
+// their String method, if they have one.
+func Render(v Value) string {
+	b := strings.Builder{}
+	render(&b, v)
+	return b.String()
+}
+
+func render(b *strings.Builder, v Value) {
+
+	switch x := v.(type) {
+	case nil:
+		b.WriteString("nil")
+	case string:
+		b.WriteString(strconv.Quote(x))
+	case int64:
+		b.WriteString(strconv.FormatInt(x, 10))
+	case float64:
+		b.WriteString(renderFloat(x))
+	case bool:
+		b.WriteString(strconv.FormatBool(x))
+	case []Value:
+		b.WriteString("[")
+		for i, e := range x {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			render(b, e)
+		}
+		b.WriteString("]")
+	case map[string]Value:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(strconv.Quote(k))
+			b.WriteString(": ")
+			render(b, x[k])
+		}
+		b.WriteString("}")
+	case Tuple:
+		if r := Result(x); len(x.Values) == 2 && x.Values[0] == true {
+			render(b, r)
+			return
+		}
+		b.WriteString("(")
+		for i, e := range x.Values {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			render(b, e)
+		}
+		b.WriteString(")")
+	case FlowChange:
+		render(b, x.Value)
+	case *regexp.Regexp:
+		b.WriteString("/")
+		b.WriteString(x.String())
+		b.WriteString("/")
+	case time.Time:
+		b.WriteString(x.Format(time.RFC3339Nano))
+	case func(*Context, ...Value) (Value, error):
+		b.WriteString("fn")
+	case Record:
+		fmt.Fprintf(b, "%+v", x.Interface())
+	case fmt.Stringer:
+		b.WriteString(x.String())
+	default:
+		fmt.Fprintf(b, "%v", x)
+	}
+}
+
+// renderFloat formats a float so that it is not mistaken for an int.
+func renderFloat(f float64) string {
+
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+
+	return s + ".0"
+}
@@ -0,0 +1,227 @@
+package compile
+
+import (
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// A function's parameters, and the names it assigns, are resolved as it is
+// compiled to slots of its frame, a slice, so that reading or assigning them
+// is an index rather than a walk of maps. Only the function's own names are
+// resolved: a function sees the names of its callers, not of where it was
+// written, so the names of other functions can only be found as it runs.
+
+// layout is the slots of a function's frame: its parameters, in order, and
+// then the names it assigns.
+type layout struct {
+	names []string
+	slots map[string]int
+}
+
+// unassignedSlot fills the slots of a frame whose names are not yet
+// assigned, so that reading one finds the name of a caller, as it would if
+// the frame were a map.
+type unassignedSlot struct{}
+
+// isUnassigned checks if a slot's value is unassignedSlot.
+func isUnassigned(v Value) bool {
+	_, ok := v.(unassignedSlot)
+	return ok
+}
+
+// resolveLocals returns the layout of a function's frame, and its body with
+// the slot of each of its local names, in Node.Slot. The bodies of the
+// functions it defines are resolved when they are compiled.
+func resolveLocals(params []string, body parser.Node) (*layout, parser.Node) {
+
+	l := &layout{slots: make(map[string]int)}
+	for _, p := range params {
+		l.add(p)
+	}
+
+	parser.Inspect(body, func(n parser.Node) bool {
+		if n.Type().Match(lex.Function) {
+			return false
+		}
+		if n.Type().Match(lex.Assign) && len(n.Children) == 2 && n.Children[0].Type().Match(lex.Ident) {
+			l.add(n.Children[0].Item.Value)
+		}
+		return true
+	})
+
+	body = parser.Walk(body, parser.Visitor{
+		Pre: func(n parser.Node) (parser.Node, bool) {
+			if n.Type().Match(lex.Ident) {
+				if i, ok := l.slots[n.Item.Value]; ok {
+					n.Slot = i + 1
+				}
+			}
+			return n, !n.Type().Match(lex.Function)
+		},
+	})
+
+	return l, body
+}
+
+// add gives a name the next slot, if it has none.
+func (l *layout) add(name string) {
+
+	if _, ok := l.slots[name]; ok {
+		return
+	}
+
+	l.slots[name] = len(l.names)
+	l.names = append(l.names, name)
+}
+
+// newFrame returns a context for a call of a function with the given
+// layout, with its slots unassigned. releaseFrame lets it be reused once the
+// call returns.
+func newFrame(parent *Context, l *layout) *Context {
+
+	f := frameContexts.Get().(*frameContext)
+	f.init(parent)
+	f.recycle = f
+	f.layout = l
+
+	n := len(l.names)
+	switch {
+	case n <= smallFrame:
+		f.Context.slots = f.small[:n]
+	case cap(f.large) >= n:
+		f.Context.slots = f.large[:n]
+	default:
+		f.large = make([]Value, n)
+		f.Context.slots = f.large
+	}
+
+	for i := range f.Context.slots {
+		f.Context.slots[i] = unassignedSlot{}
+	}
+
+	return &f.Context
+}
+
+// pushArgs returns a slice for the n arguments of a call, and the mark to
+// pass to popArgs once the call returns. A function's frame, which only its
+// call evaluates in, keeps a stack of arguments that the calls it makes
+// reuse, e.g. those in a loop; other contexts, which runs may share,
+// allocate the slice.
+func (ctx *Context) pushArgs(n int) ([]Value, int) {
+
+	if n == 0 {
+		return nil, -1
+	}
+
+	if ctx.layout == nil {
+		return make([]Value, n), -1
+	}
+
+	mark := len(ctx.argStack)
+	for i := 0; i < n; i++ {
+		ctx.argStack = append(ctx.argStack, nil)
+	}
+
+	return ctx.argStack[mark : mark+n : mark+n], mark
+}
+
+// popArgs releases the arguments pushed since the mark, so that they are not
+// kept from the garbage collector.
+func (ctx *Context) popArgs(mark int) {
+
+	if mark < 0 {
+		return
+	}
+
+	for i := mark; i < len(ctx.argStack); i++ {
+		ctx.argStack[i] = nil
+	}
+	ctx.argStack = ctx.argStack[:mark]
+}
+
+// slot returns the slot of a name in the context's frame, and false if it
+// has none. The caller holds the lock.
+func (ctx *Context) slot(name string) (int, bool) {
+
+	if ctx.layout == nil {
+		return 0, false
+	}
+
+	i, ok := ctx.layout.slots[name]
+	return i, ok
+}
+
+// hasSlot checks if a slot resolved at compile time is the name's slot in
+// the context's frame, as it is when a function's body runs in its frame.
+func (ctx *Context) hasSlot(i int, name string) bool {
+	return ctx.layout != nil && i < len(ctx.slots) && ctx.layout.names[i] == name
+}
+
+// getSlot is Get, for a name resolved to a slot.
+func (ctx *Context) getSlot(i int, name string) Value {
+
+	if ctx.hasSlot(i, name) {
+		ctx.mu.RLock()
+		v := ctx.slots[i]
+		ctx.mu.RUnlock()
+
+		if !isUnassigned(v) {
+			return v
+		}
+	}
+
+	return ctx.Get(name)
+}
+
+// setSlot is Set, for a name resolved to a slot.
+func (ctx *Context) setSlot(i int, name string, value Value) (Value, error) {
+
+	if !ctx.hasSlot(i, name) {
+		return ctx.Set(name, value)
+	}
+
+	ctx.mu.Lock()
+	ctx.slots[i] = value
+	ctx.mu.Unlock()
+
+	return value, nil
+}
+
+// locals returns the names assigned in the context itself, in its map and
+// its slots. The caller holds the lock.
+func (ctx *Context) locals() map[string]Value {
+
+	if ctx.layout == nil {
+		return ctx.values
+	}
+
+	values := make(map[string]Value, len(ctx.values)+len(ctx.slots))
+	for name, v := range ctx.values {
+		values[name] = v
+	}
+	for i, v := range ctx.slots {
+		if !isUnassigned(v) {
+			values[ctx.layout.names[i]] = v
+		}
+	}
+
+	return values
+}
+
+// setLocals replaces the names assigned in the context itself, as locals
+// returned them. The caller holds the lock.
+func (ctx *Context) setLocals(values map[string]Value) {
+
+	ctx.values = make(map[string]Value, len(values))
+	for i := range ctx.slots {
+		ctx.slots[i] = unassignedSlot{}
+	}
+
+	for name, v := range values {
+		if i, ok := ctx.slot(name); ok {
+			ctx.slots[i] = v
+			continue
+		}
+		ctx.values[name] = v
+	}
+}
@@ -0,0 +1,118 @@
+package compile
+
+import "fmt"
+
+// builtinZip pairs up the elements of two lists as tuples, stopping at the
+// end of the shorter list: zip(a, b).
+func builtinZip(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("zip", args, 2); err != nil {
+		return nil, err
+	}
+
+	a, err := listArg("zip", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := listArg("zip", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	pairs := make([]Value, n)
+	for i := range pairs {
+		pairs[i] = NewTuple(a[i], b[i])
+	}
+
+	return pairs, nil
+}
+
+// builtinEnumerate pairs up each element of a list with its index as a
+// tuple: enumerate(list).
+func builtinEnumerate(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("enumerate", args, 1); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("enumerate", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]Value, len(list))
+	for i, v := range list {
+		pairs[i] = NewTuple(int64(i), v)
+	}
+
+	return pairs, nil
+}
+
+// builtinRange returns a list of ints counting from a start, up to but not
+// including an end: range(end) counts from 0, range(start, end) counts by 1,
+// and range(start, end, step) counts by step, which may be negative.
+func builtinRange(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("range", args, 1, 3); err != nil {
+		return nil, err
+	}
+
+	bounds := []int64{0, 0, 1}
+	for i := range args {
+		n, err := intArg("range", args, i)
+		if err != nil {
+			return nil, err
+		}
+		bounds[i] = n
+	}
+
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return nil, fmt.Errorf("range: step must not be 0")
+	}
+
+	// count, rather than step to the end, which may be past the ints.
+	n := rangeLen(start, end, step)
+	if err := ctx.checkLen("range", n, false); err != nil {
+		return nil, err
+	}
+
+	nums := make([]Value, n)
+	for k := int64(0); k < n; k++ {
+		nums[k] = start + k*step
+	}
+
+	return nums, nil
+}
+
+// rangeLen returns the number of ints range(start, end, step) produces.
+func rangeLen(start, end, step int64) int64 {
+
+	if step < 0 {
+		start, end, step = end, start, -step
+	}
+	if end <= start {
+		return 0
+	}
+
+	span := uint64(end - start)
+	n := span / uint64(step)
+	if span%uint64(step) != 0 {
+		n++
+	}
+
+	if n > 1<<63-1 {
+		return 1<<63 - 1
+	}
+	return int64(n)
+}
@@ -0,0 +1,46 @@
+package compile
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRangeEdgeOfInts(t *testing.T) {
+
+	for _, c := range []struct {
+		start, end, step int64
+		want             []Value
+	}{
+		{math.MaxInt64 - 7, math.MaxInt64, 5, []Value{int64(math.MaxInt64 - 7), int64(math.MaxInt64 - 2)}},
+		{math.MaxInt64 - 2, math.MaxInt64, 1, []Value{int64(math.MaxInt64 - 2), int64(math.MaxInt64 - 1)}},
+		{math.MinInt64 + 7, math.MinInt64, -5, []Value{int64(math.MinInt64 + 7), int64(math.MinInt64 + 2)}},
+		{math.MinInt64, math.MaxInt64, math.MaxInt64, []Value{int64(math.MinInt64), int64(-1), int64(math.MaxInt64 - 1)}},
+		{0, 10, 3, []Value{int64(0), int64(3), int64(6), int64(9)}},
+		{3, 0, -1, []Value{int64(3), int64(2), int64(1)}},
+		{0, 0, 1, []Value{}},
+	} {
+		got, err := builtinRange(NewTopContext(), c.start, c.end, c.step)
+		if err != nil {
+			t.Fatalf("range(%d, %d, %d): %v", c.start, c.end, c.step, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("range(%d, %d, %d) = %v, want %v", c.start, c.end, c.step, got, c.want)
+		}
+	}
+}
+
+func TestRangeTooLarge(t *testing.T) {
+
+	for _, args := range [][]Value{
+		{int64(math.MaxInt64)},
+		{int64(math.MinInt64), int64(math.MaxInt64)},
+		{int64(math.MaxInt64), int64(math.MinInt64), int64(-1)},
+	} {
+		_, err := builtinRange(NewTopContext(), args...)
+		if err == nil || !strings.Contains(err.Error(), "too large to allocate") {
+			t.Errorf("range%v: got %v, want too large to allocate", args, err)
+		}
+	}
+}
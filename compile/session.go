@@ -0,0 +1,242 @@
+package compile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// SessionVersion is the version of the sessions written by SaveSession. It
+// changes only when a reader of the previous version could misread the new
+// one.
+const SessionVersion = 1
+
+// A session is a JSON object
+//
+//	{"version": 1, "values": {"name": VALUE, ...}}
+//
+// where each VALUE is an object with a single field naming its type: nil,
+// bool, int, float, string, list, map, tuple, time (RFC 3339), or regex (the
+// pattern).
+type sessionFile struct {
+	Version int                     `json:"version"`
+	Values  map[string]sessionValue `json:"values"`
+}
+
+type sessionValue struct {
+	Nil    bool                     `json:"nil,omitempty"`
+	Bool   *bool                    `json:"bool,omitempty"`
+	Int    *int64                   `json:"int,omitempty"`
+	Float  *float64                 `json:"float,omitempty"`
+	String *string                  `json:"string,omitempty"`
+	List   *[]sessionValue          `json:"list,omitempty"`
+	Map    *map[string]sessionValue `json:"map,omitempty"`
+	Tuple  *[]sessionValue          `json:"tuple,omitempty"`
+	Time   *time.Time               `json:"time,omitempty"`
+	Regex  *string                  `json:"regex,omitempty"`
+}
+
+// SaveSession writes the names assigned in a context, so that LoadSession can
+// assign them again, e.g. in a later REPL session or another process. Only
+// the names of the context itself are written, not those of its parents, nor
+// the builtins and args of a top context. Values that cannot be written, such
+// as functions, records, NaN and infinite floats, or collections holding them,
+// are skipped, and their names returned.
+func (ctx *Context) SaveSession(w io.Writer) ([]string, error) {
+
+	f := sessionFile{
+		Version: SessionVersion,
+		Values:  make(map[string]sessionValue),
+	}
+	skipped := []string{}
+
+	ctx.mu.RLock()
+	for name, v := range ctx.locals() {
+		if ctx.parent == nil && predefined(name) {
+			continue
+		}
+
+		sv, ok := toSession(v)
+		if !ok {
+			skipped = append(skipped, name)
+			continue
+		}
+		f.Values[name] = sv
+	}
+	ctx.mu.RUnlock()
+
+	sort.Strings(skipped)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return nil, fmt.Errorf("cannot save session: %v", err)
+	}
+
+	return skipped, nil
+}
+
+// LoadSession assigns the names written by SaveSession in a context.
+func (ctx *Context) LoadSession(r io.Reader) error {
+
+	var f sessionFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return fmt.Errorf("cannot load session: %v", err)
+	}
+
+	if f.Version != SessionVersion {
+		return fmt.Errorf("cannot load session: version %d, requires %d", f.Version, SessionVersion)
+	}
+
+	values := make(map[string]Value, len(f.Values))
+	for name, sv := range f.Values {
+		v, err := fromSession(sv)
+		if err != nil {
+			return fmt.Errorf("cannot load session: %s: %v", name, err)
+		}
+		values[name] = v
+	}
+
+	for name, v := range values {
+		if _, err := ctx.Set(name, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// predefined checks if a name is assigned in every top context.
+func predefined(name string) bool {
+	_, ok := builtins[name]
+	return ok || name == "args"
+}
+
+// toSession converts a value to its session form, and returns false if it
+// cannot be written.
+func toSession(v Value) (sessionValue, bool) {
+
+	switch x := v.(type) {
+	case nil:
+		return sessionValue{Nil: true}, true
+	case bool:
+		return sessionValue{Bool: &x}, true
+	case int64:
+		return sessionValue{Int: &x}, true
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return sessionValue{}, false
+		}
+		return sessionValue{Float: &x}, true
+	case string:
+		return sessionValue{String: &x}, true
+	case time.Time:
+		// RFC 3339 has only four digit years.
+		if x.Year() < 0 || x.Year() > 9999 {
+			return sessionValue{}, false
+		}
+		return sessionValue{Time: &x}, true
+	case *regexp.Regexp:
+		pattern := x.String()
+		return sessionValue{Regex: &pattern}, true
+	case []Value:
+		list, ok := toSessionList(x)
+		return sessionValue{List: &list}, ok
+	case Tuple:
+		values := make([]Value, len(x.Values))
+		for i, e := range x.Values {
+			values[i] = e
+		}
+		list, ok := toSessionList(values)
+		return sessionValue{Tuple: &list}, ok
+	case map[string]Value:
+		m := make(map[string]sessionValue, len(x))
+		for k, e := range x {
+			sv, ok := toSession(e)
+			if !ok {
+				return sessionValue{}, false
+			}
+			m[k] = sv
+		}
+		return sessionValue{Map: &m}, true
+	}
+
+	return sessionValue{}, false
+}
+
+func toSessionList(values []Value) ([]sessionValue, bool) {
+
+	list := make([]sessionValue, len(values))
+	for i, e := range values {
+		sv, ok := toSession(e)
+		if !ok {
+			return nil, false
+		}
+		list[i] = sv
+	}
+
+	return list, true
+}
+
+// fromSession converts the session form of a value back to the value.
+func fromSession(sv sessionValue) (Value, error) {
+
+	switch {
+	case sv.Nil:
+		return nil, nil
+	case sv.Bool != nil:
+		return *sv.Bool, nil
+	case sv.Int != nil:
+		return *sv.Int, nil
+	case sv.Float != nil:
+		return *sv.Float, nil
+	case sv.String != nil:
+		return *sv.String, nil
+	case sv.Time != nil:
+		return *sv.Time, nil
+	case sv.Regex != nil:
+		return regexp.Compile(*sv.Regex)
+	case sv.List != nil:
+		return fromSessionList(*sv.List)
+	case sv.Tuple != nil:
+		list, err := fromSessionList(*sv.Tuple)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(list))
+		for i, e := range list {
+			values[i] = e
+		}
+		return NewTuple(values...), nil
+	case sv.Map != nil:
+		m := make(map[string]Value, len(*sv.Map))
+		for k, e := range *sv.Map {
+			v, err := fromSession(e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("value has no type")
+}
+
+func fromSessionList(list []sessionValue) ([]Value, error) {
+
+	values := make([]Value, len(list))
+	for i, e := range list {
+		v, err := fromSession(e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
@@ -0,0 +1,79 @@
+package compile
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+
+	when := time.Date(2024, 2, 29, 12, 30, 0, 0, time.UTC)
+
+	saved := map[string]Value{
+		"n":     nil,
+		"b":     true,
+		"i":     int64(-42),
+		"f":     2.5,
+		"s":     "héllo\n",
+		"when":  when,
+		"items": []Value{int64(1), "two", []Value{3.0}},
+		"attrs": map[string]Value{"a": int64(1), "b": map[string]Value{"c": false}},
+		"tuple": NewTuple(int64(1), "x"),
+	}
+	skipped := map[string]Value{
+		"nan":      math.NaN(),
+		"inf":      math.Inf(-1),
+		"nan_list": []Value{int64(1), math.NaN()},
+		"inf_dict": map[string]Value{"x": math.Inf(1)},
+		"far":      time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC),
+		"func":     Expr(func(*Context, ...Value) (Value, error) { return nil, nil }),
+	}
+
+	ctx := NewTopContext()
+	for name, v := range saved {
+		ctx.Set(name, v)
+	}
+	for name, v := range skipped {
+		ctx.Set(name, v)
+	}
+	ctx.Set("re", regexp.MustCompile(`a+b`))
+
+	var buf bytes.Buffer
+	names, err := ctx.SaveSession(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"far", "func", "inf", "inf_dict", "nan", "nan_list"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("skipped %v, want %v", names, want)
+	}
+
+	loaded := NewTopContext()
+	if err := loaded.LoadSession(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range saved {
+		got := loaded.Get(name)
+		if w, ok := want.(time.Time); ok {
+			if g, ok := got.(time.Time); !ok || !g.Equal(w) {
+				t.Errorf("%s = %v, want %v", name, got, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", name, got, want)
+		}
+	}
+	if re, ok := loaded.Get("re").(*regexp.Regexp); !ok || re.String() != `a+b` {
+		t.Errorf("re = %v, want /a+b/", loaded.Get("re"))
+	}
+	for name := range skipped {
+		if _, ok := loaded.locals()[name]; ok {
+			t.Errorf("%s was loaded", name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package compile
+
+import "fmt"
+
+// Snapshot is the state of the names of a context and its parents, taken by
+// Context.Snapshot, to which Context.Restore returns them.
+type Snapshot struct {
+	ctx    *Context
+	values []map[string]Value // of the context, then each parent
+}
+
+// Snapshot records the names assigned in a context and its parents, e.g. so
+// that a REPL can roll back a failed evaluation, or a test harness can run
+// each case from the same setup. Lists, maps, and tuples are copied, so that
+// later changes to them are not seen by the snapshot.
+func (ctx *Context) Snapshot() *Snapshot {
+
+	s := &Snapshot{ctx: ctx}
+	for c := ctx; c != nil; c = c.parent {
+		c.mu.RLock()
+		s.values = append(s.values, copyValues(c.locals()))
+		c.mu.RUnlock()
+	}
+
+	return s
+}
+
+// Restore returns the names of a context and its parents to those recorded
+// by a snapshot of the same context. A snapshot may be restored any number of
+// times. Restore should not be called while a run is using the context.
+func (ctx *Context) Restore(s *Snapshot) error {
+
+	if s == nil || s.ctx != ctx {
+		return fmt.Errorf("restore: snapshot is not of this context")
+	}
+
+	i := 0
+	for c := ctx; c != nil; c = c.parent {
+		c.mu.Lock()
+		c.setLocals(copyValues(s.values[i]))
+		c.mu.Unlock()
+		i++
+	}
+
+	return nil
+}
+
+// copyValues returns a deep copy of the names of a context.
+func copyValues(values map[string]Value) map[string]Value {
+
+	out := make(map[string]Value, len(values))
+	for k, v := range values {
+		out[k] = deepCopy(v)
+	}
+
+	return out
+}
+
+// deepCopy copies the lists, maps, and tuples of a value. Other values are
+// immutable, or, like records, belong to the embedding program.
+func deepCopy(v Value) Value {
+
+	switch x := v.(type) {
+	case []Value:
+		list := make([]Value, len(x))
+		for i, e := range x {
+			list[i] = deepCopy(e)
+		}
+		return list
+	case map[string]Value:
+		return copyValues(x)
+	case Tuple:
+		values := make([]interface{}, len(x.Values))
+		for i, e := range x.Values {
+			values[i] = deepCopy(e)
+		}
+		return Tuple{Values: values}
+	}
+
+	return v
+}
@@ -0,0 +1,102 @@
+package compile
+
+import (
+	"fmt"
+	"sort"
+)
+
+// builtinSort returns a sorted copy of a list of numbers, strings, or bools.
+func builtinSort(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("sort", args, 1); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("sort", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := append([]Value{}, list...)
+	if err := sortByKeys(nil, sorted); err != nil {
+		return nil, fmt.Errorf("sort: %v", err)
+	}
+
+	return sorted, nil
+}
+
+// builtinSortBy returns a copy of a list sorted by the keys produced by a
+// function: sort_by(list, fn(x) { ... }). The function is called once per
+// element.
+func builtinSortBy(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("sort_by", args, 2); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("sort_by", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFn, err := fnArg("sort_by", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]Value, len(list))
+	for i, v := range list {
+		keys[i], err = ctx.callback(keyFn, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := append([]Value{}, list...)
+	if err := sortByKeys(sorted, keys); err != nil {
+		return nil, fmt.Errorf("sort_by: %v", err)
+	}
+
+	return sorted, nil
+}
+
+// sortByKeys stably sorts vals and keys together, in the order of keys. vals
+// may be nil, to sort only keys.
+func sortByKeys(vals, keys []Value) error {
+
+	var err error
+
+	sort.Stable(&keyedValues{
+		vals: vals,
+		keys: keys,
+		less: func(a, b Value) bool {
+			c, cerr := Compare(a, b)
+			if cerr != nil && err == nil {
+				err = cerr
+			}
+			return c < 0
+		},
+	})
+
+	return err
+}
+
+type keyedValues struct {
+	vals, keys []Value
+	less       func(a, b Value) bool
+}
+
+func (kv *keyedValues) Len() int {
+	return len(kv.keys)
+}
+
+func (kv *keyedValues) Less(i, j int) bool {
+	return kv.less(kv.keys[i], kv.keys[j])
+}
+
+func (kv *keyedValues) Swap(i, j int) {
+	kv.keys[i], kv.keys[j] = kv.keys[j], kv.keys[i]
+	if kv.vals != nil {
+		kv.vals[i], kv.vals[j] = kv.vals[j], kv.vals[i]
+	}
+}
@@ -0,0 +1,358 @@
+package compile
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringsModule is available to scripts as `strings`, e.g.
+// `strings.split("a,b", ",")`.
+var stringsModule = map[string]Value{
+	"split":    stringsSplit,
+	"join":     stringsJoin,
+	"trim":     stringsTrim,
+	"upper":    stringsUpper,
+	"lower":    stringsLower,
+	"contains": stringsContains,
+	"replace":  stringsReplace,
+	"index":    stringsIndex,
+	"repeat":   stringsRepeat,
+	"pad":      stringsPad,
+	"pad_left": stringsPadLeft,
+}
+
+// stringsSplit splits a string on a separator: split(s, sep).
+func stringsSplit(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("split", args, 2); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("split", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sep, err := stringArg("split", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	split := strings.SplitN(s, sep, ctx.maxCount())
+	if err := ctx.checkLen("split", int64(len(split)), false); err != nil {
+		return nil, err
+	}
+
+	parts := []Value{}
+	for _, p := range split {
+		parts = append(parts, p)
+	}
+
+	return parts, nil
+}
+
+// stringsJoin joins a list of strings with a separator: join(list, sep).
+func stringsJoin(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("join", args, 2); err != nil {
+		return nil, err
+	}
+
+	list, err := listArg("join", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sep, err := stringArg("join", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []string{}
+	size := int64(0)
+	for i, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("join: element %d must be a string, received %s", i+1, TypeName(v))
+		}
+		parts = append(parts, s)
+		size += int64(len(s))
+	}
+
+	if len(list) > 1 {
+		if seps := repeatLen(len(sep), int64(len(list)-1)); seps > 1<<62 {
+			size = seps
+		} else {
+			size += seps
+		}
+	}
+
+	if err := ctx.checkLen("join", size, true); err != nil {
+		return nil, err
+	}
+
+	return strings.Join(parts, sep), nil
+}
+
+// stringsTrim removes leading and trailing white space, or leading and
+// trailing runes in a cutset: trim(s) or trim(s, cutset).
+func stringsTrim(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("trim", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("trim", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 1 {
+		return strings.TrimSpace(s), nil
+	}
+
+	cutset, err := stringArg("trim", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Trim(s, cutset), nil
+}
+
+// stringsUpper converts a string to upper case.
+func stringsUpper(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("upper", args, 1); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("upper", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.ToUpper(s), nil
+}
+
+// stringsLower converts a string to lower case.
+func stringsLower(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("lower", args, 1); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("lower", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.ToLower(s), nil
+}
+
+// stringsContains checks if a string contains a substring: contains(s, sub).
+func stringsContains(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("contains", args, 2); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("contains", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := stringArg("contains", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Contains(s, sub), nil
+}
+
+// stringsReplace replaces occurrences of a substring: replace(s, old, new)
+// replaces all, and replace(s, old, new, n) replaces the first n.
+func stringsReplace(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("replace", args, 3, 4); err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, 3)
+	for i := range strs {
+		s, err := stringArg("replace", args, i)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+
+	n := int64(-1)
+	if len(args) == 4 {
+		var err error
+		n, err = intArg("replace", args, 3)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ctx.limits != nil {
+		if err := ctx.checkLen("replace", replacedLen(strs[0], strs[1], strs[2], n), true); err != nil {
+			return nil, err
+		}
+	}
+
+	return strings.Replace(strs[0], strs[1], strs[2], int(n)), nil
+}
+
+// replacedLen returns the length of s with the first n occurrences of old
+// replaced by new, or all if n < 0, as strings.Replace would make it, or the
+// largest int64 if that would overflow.
+func replacedLen(s, old, new string, n int64) int64 {
+
+	count := int64(strings.Count(s, old))
+	if n >= 0 && n < count {
+		count = n
+	}
+
+	grown := repeatLen(len(new), count)
+	if grown == 1<<63-1 {
+		return grown
+	}
+
+	return int64(len(s)) - int64(len(old))*count + grown
+}
+
+// stringsIndex returns the (rune) index of the first occurrence of a
+// substring, or -1: index(s, sub).
+func stringsIndex(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("index", args, 2); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("index", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := stringArg("index", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return int64(-1), nil
+	}
+
+	return int64(utf8.RuneCountInString(s[:i])), nil
+}
+
+// stringsRepeat repeats a string n times: repeat(s, n).
+func stringsRepeat(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("repeat", args, 2); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("repeat", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := intArg("repeat", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 0 {
+		return nil, fmt.Errorf("repeat: negative count %d", n)
+	}
+
+	// checked whatever the limits, as strings.Repeat panics at a length
+	// that overflows an int.
+	if err := ctx.checkLen("repeat", repeatLen(len(s), n), true); err != nil {
+		return nil, err
+	}
+
+	return strings.Repeat(s, int(n)), nil
+}
+
+// stringsPad pads a string on the right to a width: pad(s, width) or
+// pad(s, width, fill).
+func stringsPad(ctx *Context, args ...Value) (Value, error) {
+
+	s, padding, err := padding(ctx, "pad", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return s + padding, nil
+}
+
+// stringsPadLeft pads a string on the left to a width: pad_left(s, width) or
+// pad_left(s, width, fill).
+func stringsPadLeft(ctx *Context, args ...Value) (Value, error) {
+
+	s, padding, err := padding(ctx, "pad_left", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return padding + s, nil
+}
+
+// padding returns the string to pad, and the padding needed to reach the
+// requested width.
+func padding(ctx *Context, name string, args []Value) (string, string, error) {
+
+	if err := expectArgRange(name, args, 2, 3); err != nil {
+		return "", "", err
+	}
+
+	s, err := stringArg(name, args, 0)
+	if err != nil {
+		return "", "", err
+	}
+
+	width, err := intArg(name, args, 1)
+	if err != nil {
+		return "", "", err
+	}
+
+	fill := " "
+	if len(args) == 3 {
+		fill, err = stringArg(name, args, 2)
+		if err != nil {
+			return "", "", err
+		}
+		if utf8.RuneCountInString(fill) != 1 {
+			return "", "", fmt.Errorf("%s: fill must be a single character, received %q", name, fill)
+		}
+	}
+
+	need := width - int64(utf8.RuneCountInString(s))
+	if need <= 0 {
+		return s, "", nil
+	}
+
+	size := repeatLen(len(fill), need)
+	if size <= 1<<63-1-int64(len(s)) {
+		size += int64(len(s))
+	}
+	if err := ctx.checkLen(name, size, true); err != nil {
+		return "", "", err
+	}
+
+	return s, strings.Repeat(fill, int(need)), nil
+}
+
+// repeatLen returns the length of a string of size bytes repeated n times,
+// or the largest int64 if that would overflow.
+func repeatLen(size int, n int64) int64 {
+	if n > 0 && int64(size) > (1<<63-1)/n {
+		return 1<<63 - 1
+	}
+	return int64(size) * n
+}
@@ -0,0 +1,34 @@
+package compile
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRepeatOverflow(t *testing.T) {
+
+	for _, c := range []struct {
+		fn   Expr
+		args []Value
+		want string
+	}{
+		{stringsRepeat, []Value{"ab", int64(math.MaxInt64)}, "repeat: string of 9223372036854775807 is too large to allocate"},
+		{stringsRepeat, []Value{"a", int64(math.MaxInt64)}, "repeat: string of 9223372036854775807 is too large to allocate"},
+		{stringsPad, []Value{"a", int64(math.MaxInt64)}, "pad: string of 9223372036854775807 is too large to allocate"},
+		{stringsPad, []Value{"a", int64(math.MaxInt64), "é"}, "pad: string of 9223372036854775807 is too large to allocate"},
+		{stringsPadLeft, []Value{"abc", int64(math.MaxInt64 - 1), "é"}, "pad_left: string of 9223372036854775807 is too large to allocate"},
+	} {
+		_, err := c.fn(NewTopContext(), c.args...)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%v: got %v, want %s", c.args, err, c.want)
+		}
+	}
+
+	if got, err := stringsRepeat(NewTopContext(), "", int64(math.MaxInt64)); err != nil || got != "" {
+		t.Errorf(`repeat("", MaxInt64) = %q, %v, want ""`, got, err)
+	}
+	if got, err := stringsPad(NewTopContext(), "ab", int64(4), "·"); err != nil || got != "ab"+strings.Repeat("·", 2) {
+		t.Errorf(`pad("ab", 4, "·") = %q, %v`, got, err)
+	}
+}
@@ -0,0 +1,110 @@
+package compile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+func init() {
+	// render is added here, rather than in the builtins map, since it refers
+	// to the map through FuncMap.
+	builtins["render"] = builtinRender
+}
+
+// FuncMap returns the functions visible in the context, other than the
+// builtins, as a template.FuncMap, so that Go templates can call into
+// scripts, e.g.
+//
+//	tmpl := template.New("page").Funcs(ctx.FuncMap())
+//
+// Each function takes any arguments, converted as for Bind, and returns the
+// result of the script's function, or its error, which stops the template.
+// Names assigned later are not included.
+func (ctx *Context) FuncMap() template.FuncMap {
+
+	funcs := template.FuncMap{}
+
+	for c := ctx; c != nil; c = c.parent {
+		c.mu.RLock()
+		for name, v := range c.locals() {
+			if _, ok := funcs[name]; ok {
+				continue
+			}
+			if c.parent == nil && predefined(name) {
+				continue
+			}
+			if fn, ok := Callable(v); ok {
+				funcs[name] = ctx.templateFunc(fn)
+			}
+		}
+		c.mu.RUnlock()
+	}
+
+	return funcs
+}
+
+// templateFunc adapts a function value for a template.
+func (ctx *Context) templateFunc(fn func(*Context, ...Value) (Value, error)) func(...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+
+		vals := make([]Value, len(args))
+		for i, a := range args {
+			vals[i] = FromGo(a)
+		}
+
+		return ctx.callback(fn, vals...)
+	}
+}
+
+// RegisterFuncMap makes the functions of a template.FuncMap available to
+// scripts, each as for RegisterFunc.
+func (ctx *Context) RegisterFuncMap(funcs template.FuncMap) error {
+
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := ctx.RegisterFunc(name, funcs[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// builtinRender renders a Go text/template with a value, usually a map:
+// render(text, data). The template may call the script's functions, as for
+// FuncMap, e.g. render("{{ greet .name }}", dict("name", "ann")).
+func builtinRender(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("render", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	text, err := stringArg("render", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var data Value
+	if len(args) > 1 {
+		data = args[1]
+	}
+
+	tmpl, err := template.New("render").Funcs(ctx.FuncMap()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("render: %v", err)
+	}
+
+	out := strings.Builder{}
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("render: %w", err)
+	}
+
+	return out.String(), nil
+}
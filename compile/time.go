@@ -0,0 +1,115 @@
+package compile
+
+import (
+	"fmt"
+	"time"
+)
+
+// Time layouts follow Go's reference time, Mon Jan 2 15:04:05 MST 2006, and
+// default to RFC 3339.
+
+// builtinNow returns the current time.
+func builtinNow(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("now", args, 0); err != nil {
+		return nil, err
+	}
+
+	return time.Now(), nil
+}
+
+// builtinClock returns the seconds elapsed since the context tree was
+// created, for timing parts of a script.
+func builtinClock(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("clock", args, 0); err != nil {
+		return nil, err
+	}
+
+	return time.Since(ctx.env.started).Seconds(), nil
+}
+
+// builtinSleep pauses for a number of milliseconds: sleep(ms). A canceled
+// run wakes early, with the Go context's error.
+func builtinSleep(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgs("sleep", args, 1); err != nil {
+		return nil, err
+	}
+
+	ms, err := floatArg("sleep", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	d := time.Duration(ms * float64(time.Millisecond))
+	if ctx.goCtx == nil {
+		time.Sleep(d)
+		return nil, nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil, nil
+	case <-ctx.goCtx.Done():
+		return nil, ctx.goCtx.Err()
+	}
+}
+
+// layoutArg returns the optional layout argument of a time builtin.
+func layoutArg(name string, args []Value, i int) (string, error) {
+	if len(args) <= i {
+		return time.RFC3339, nil
+	}
+	return stringArg(name, args, i)
+}
+
+// builtinFormatTime formats a time: format_time(t) or
+// format_time(t, layout).
+func builtinFormatTime(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("format_time", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	t, ok := args[0].(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("format_time: argument 1 must be a time, received %s", TypeName(args[0]))
+	}
+
+	layout, err := layoutArg("format_time", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Format(layout), nil
+}
+
+// builtinParseTime parses a time: parse_time(s) or parse_time(s, layout).
+// When the string does not match the layout, it returns an error tuple.
+func builtinParseTime(ctx *Context, args ...Value) (Value, error) {
+
+	if err := expectArgRange("parse_time", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	s, err := stringArg("parse_time", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := layoutArg("parse_time", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return failure("parse_time: %v", err), nil
+	}
+
+	return t, nil
+}
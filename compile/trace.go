@@ -0,0 +1,145 @@
+package compile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// Frame is a function call in progress: the name of the function called, and
+// the position of the call.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+	Column   int
+	caller   *Frame
+	depth    int
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s (%s:%d:%d)", f.Function, f.File, f.Line, f.Column)
+}
+
+// StackError is a runtime error raised inside a function call, with the calls
+// that were in progress when it was raised.
+type StackError struct {
+	Err   error
+	Stack []Frame // the innermost call first
+}
+
+func (e StackError) Error() string {
+
+	b := strings.Builder{}
+	b.WriteString(e.Err.Error())
+	for _, f := range e.Stack {
+		b.WriteString("\n\tat ")
+		b.WriteString(f.String())
+	}
+
+	return b.String()
+}
+
+// Unwrap allows unwrapping a StackError.
+func (e StackError) Unwrap() error {
+	return e.Err
+}
+
+// EnterCall returns the context in which to call a function, which records
+// the call in the stack of the run. The name is how the call refers to the
+// function, e.g. fact, or strings.upper. Once the call returns, and its error
+// is traced, ExitCall lets the context be reused. It returns an error
+// wrapping ErrCallDepth, and no context, if the call would exceed the
+// maximum call depth set by SetMaxDepth.
+func (ctx *Context) EnterCall(function string, at lex.Item) (*Context, error) {
+
+	depth := 1
+	if ctx.frame != nil {
+		depth = ctx.frame.depth + 1
+	}
+	if err := ctx.checkDepth(depth); err != nil {
+		return nil, err
+	}
+
+	c := callContexts.Get().(*callContext)
+	c.init(ctx)
+	c.recycle = c
+
+	c.frame = Frame{
+		Function: function,
+		Line:     at.Line,
+		Column:   at.Column,
+		caller:   ctx.frame,
+		depth:    depth,
+	}
+	if at.Lexer != nil {
+		c.frame.File = at.Name()
+	}
+	c.Context.frame = &c.frame
+
+	return &c.Context, nil
+}
+
+// Stack returns the function calls in progress in a context, the innermost
+// first.
+func (ctx *Context) Stack() []Frame {
+
+	stack := []Frame{}
+	for f := ctx.frame; f != nil; f = f.caller {
+		stack = append(stack, *f)
+	}
+
+	return stack
+}
+
+// Traced attaches the stack of a context to an error, unless the error
+// already has a stack, or is a script's exit. Evaluators trace the errors
+// of calls, in the context returned by EnterCall, so that the stack is
+// that of the innermost call. The error of exceeding the maximum call depth
+// is not traced, as its stack would be as deep as the maximum.
+func (ctx *Context) Traced(err error) error {
+
+	if ctx.frame == nil || errors.Is(err, ErrCallDepth) {
+		return err
+	}
+
+	var serr StackError
+	if errors.As(err, &serr) {
+		return err
+	}
+
+	var exit Exit
+	if errors.As(err, &exit) {
+		return err
+	}
+
+	return StackError{Err: err, Stack: ctx.Stack()}
+}
+
+// CallName returns how a call refers to the function it calls, e.g. fact, or
+// strings.upper, or fn for a function that is not named.
+func CallName(node parser.Node) string {
+
+	if len(node.Children) == 0 {
+		return "fn"
+	}
+
+	return calleeName(node.Children[0])
+}
+
+func calleeName(node parser.Node) string {
+
+	switch node.Type() {
+	case lex.Ident:
+		return node.Item.Value
+	case lex.Dot:
+		if len(node.Children) == 2 {
+			return calleeName(node.Children[0]) + "." + calleeName(node.Children[1])
+		}
+	}
+
+	return "fn"
+}
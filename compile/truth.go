@@ -0,0 +1,65 @@
+package compile
+
+// Truthiness selects which values are considered false by && and ||.
+type Truthiness byte
+
+// The available truthiness rules.
+const (
+	// OnlyFalseIsFalse treats false as false, and everything else as true.
+	OnlyFalseIsFalse Truthiness = iota
+	// EmptyIsFalse also treats nil, 0, 0.0, "", and empty collections as
+	// false.
+	EmptyIsFalse
+)
+
+// IsTruthy returns the boolean value of a value, according to the context's
+// truthiness rules. For a tuple, it is the truthiness of the first element in
+// the tuple.
+func (ctx *Context) IsTruthy(v Value) bool {
+	return isTruthy(ctx.env.truthiness, v)
+}
+
+// LogicResult is the value of a && or || expression that was decided by v.
+// Changes of flow, e.g. `x && return y`, pass through unchanged.
+func (ctx *Context) LogicResult(v Value) Value {
+
+	if !ctx.env.strictLogic || flowChange(v) != None {
+		return v
+	}
+
+	return ctx.IsTruthy(v)
+}
+
+func isTruthy(rule Truthiness, v Value) bool {
+
+	switch x := v.(type) {
+	case bool:
+		return x
+	case Tuple:
+		if len(x.Values) == 0 {
+			return rule == OnlyFalseIsFalse
+		}
+		return isTruthy(rule, x.Values[0])
+	}
+
+	if rule == OnlyFalseIsFalse {
+		return true
+	}
+
+	switch x := v.(type) {
+	case nil:
+		return false
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	case []Value:
+		return len(x) > 0
+	case map[string]Value:
+		return len(x) > 0
+	}
+
+	return true
+}
@@ -0,0 +1,179 @@
+package compile
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Unmarshal stores a script's result in the Go value target points to, so
+// that a script can produce e.g. configuration for Go code. Maps and records
+// fill structs, lists fill slices and arrays, and other values convert as
+// for the arguments of a function given to RegisterFunc. A struct field is
+// filled from the map key named by its `meh:"name"` tag, or else from the key
+// matching its name, ignoring case. A tag of "-" skips the field, and map keys
+// without a field are ignored.
+func Unmarshal(result Value, target interface{}) error {
+
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unmarshal: target must be a non-nil pointer, received %T", target)
+	}
+
+	if err := unmarshal(Result(result), rv.Elem()); err != nil {
+		return fmt.Errorf("unmarshal: %v", err)
+	}
+
+	return nil
+}
+
+func unmarshal(v Value, rv reflect.Value) error {
+
+	if v == nil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return unmarshal(v, rv.Elem())
+	case reflect.Interface:
+		if rv.NumMethod() == 0 {
+			return unmarshalAny(v, rv)
+		}
+	case reflect.Struct:
+		switch x := v.(type) {
+		case map[string]Value:
+			return unmarshalStruct(x, rv)
+		case Record:
+			if s := reflect.Indirect(x.v); s.Type().AssignableTo(rv.Type()) {
+				rv.Set(s)
+				return nil
+			}
+			return unmarshalStruct(x.fields(), rv)
+		}
+	case reflect.Slice:
+		if list, ok := v.([]Value); ok {
+			rv.Set(reflect.MakeSlice(rv.Type(), len(list), len(list)))
+			return unmarshalElements(list, rv)
+		}
+	case reflect.Array:
+		if list, ok := v.([]Value); ok {
+			if len(list) != rv.Len() {
+				return fmt.Errorf("requires a list of %d elements, received %d", rv.Len(), len(list))
+			}
+			return unmarshalElements(list, rv)
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]Value); ok && rv.Type().Key().Kind() == reflect.String {
+			rv.Set(reflect.MakeMapWithSize(rv.Type(), len(m)))
+			for k, e := range m {
+				ev := reflect.New(rv.Type().Elem()).Elem()
+				if err := unmarshal(e, ev); err != nil {
+					return fmt.Errorf("key %q: %v", k, err)
+				}
+				rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), ev)
+			}
+			return nil
+		}
+	}
+
+	gv, err := toGo(v, rv.Type())
+	if err != nil {
+		return err
+	}
+	rv.Set(gv)
+
+	return nil
+}
+
+func unmarshalElements(list []Value, rv reflect.Value) error {
+	for i, e := range list {
+		if err := unmarshal(e, rv.Index(i)); err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func unmarshalStruct(m map[string]Value, rv reflect.Value) error {
+
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Tag.Get("meh")
+		if name == "-" {
+			continue
+		}
+
+		v, ok := m[name]
+		if name == "" {
+			v, ok = lookupFold(m, f.Name)
+		}
+		if !ok {
+			continue
+		}
+
+		if err := unmarshal(v, rv.Field(i)); err != nil {
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// unmarshalAny stores a value in an empty interface, with lists and maps as
+// []interface{} and map[string]interface{}.
+func unmarshalAny(v Value, rv reflect.Value) error {
+
+	switch x := v.(type) {
+	case []Value:
+		list := make([]interface{}, len(x))
+		if err := unmarshal(x, reflect.ValueOf(&list).Elem()); err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(list))
+	case map[string]Value:
+		m := make(map[string]interface{}, len(x))
+		if err := unmarshal(x, reflect.ValueOf(&m).Elem()); err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(m))
+	case Record:
+		rv.Set(x.v)
+	default:
+		rv.Set(reflect.ValueOf(Result(v)))
+	}
+
+	return nil
+}
+
+// lookupFold returns the value of the key matching a name, preferring an
+// exact match to one that ignores case. Of several keys that match ignoring
+// case, e.g. "name" and "NAME" for Name, the first in sorted order is used,
+// so that the result does not depend on the order of the map.
+func lookupFold(m map[string]Value, name string) (Value, bool) {
+
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+
+	found, ok := "", false
+	for k := range m {
+		if strings.EqualFold(k, name) && (!ok || k < found) {
+			found, ok = k, true
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+
+	return m[found], true
+}
@@ -0,0 +1,108 @@
+package compile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testServer struct {
+	Host    string
+	Port    int    `meh:"listen_port"`
+	Secret  string `meh:"-"`
+	Tags    []string
+	Weights [2]float64
+	Limits  map[string]int
+	Backup  *testServer
+	Extra   interface{}
+	Inner   testInner
+	private int
+}
+
+func TestUnmarshal(t *testing.T) {
+
+	program, err := NewProgram("config", `dict(
+		"host", "example.com",
+		"listen_port", 8080,
+		"port", 1,
+		"secret", "ignored",
+		"tags", list("a", "b"),
+		"weights", list(1, 2.5),
+		"limits", dict("cpu", 2),
+		"backup", dict("HOST", "backup.example.com"),
+		"extra", list(1, dict("k", "v")),
+		"inner", inner,
+		"private", 3,
+		"unknown", true
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := program.Run(map[string]interface{}{"inner": &testInner{X: 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got testServer
+	if err := Unmarshal(result, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := testServer{
+		Host:    "example.com",
+		Port:    8080,
+		Tags:    []string{"a", "b"},
+		Weights: [2]float64{1, 2.5},
+		Limits:  map[string]int{"cpu": 2},
+		Backup:  &testServer{Host: "backup.example.com"},
+		Extra:   []interface{}{int64(1), map[string]interface{}{"k": "v"}},
+		Inner:   testInner{X: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n\t%+v\nwant\n\t%+v", got, want)
+	}
+}
+
+func TestUnmarshalFoldedKeys(t *testing.T) {
+
+	m := map[string]Value{"host": "a", "HOST": "b", "Host2": "c", "hOsT": "d"}
+
+	// whatever the order of the map, the first of the folded keys.
+	for i := 0; i < 20; i++ {
+		var s testServer
+		if err := Unmarshal(m, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Host != "b" {
+			t.Fatalf("Host = %q, want %q of the first key, HOST", s.Host, "b")
+		}
+	}
+
+	m["Host"] = "e"
+	var s testServer
+	if err := Unmarshal(m, &s); err != nil || s.Host != "e" {
+		t.Errorf("Host = %q, %v, want %q of the exact key", s.Host, err, "e")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+
+	for _, c := range []struct {
+		v      Value
+		target interface{}
+		err    string
+	}{
+		{int64(1), testServer{}, "unmarshal: target must be a non-nil pointer, received compile.testServer"},
+		{int64(1), (*testServer)(nil), "unmarshal: target must be a non-nil pointer"},
+		{map[string]Value{"weights": []Value{1.0}}, &testServer{}, "unmarshal: field Weights: requires a list of 2 elements, received 1"},
+		{map[string]Value{"tags": []Value{"a", int64(2)}}, &testServer{}, "unmarshal: field Tags: element 1:"},
+		{map[string]Value{"limits": map[string]Value{"cpu": "x"}}, &testServer{}, `unmarshal: field Limits: key "cpu":`},
+		{map[string]Value{"listen_port": "x"}, &testServer{}, "unmarshal: field Port:"},
+	} {
+		err := Unmarshal(c.v, c.target)
+		if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+			t.Errorf("Unmarshal(%v, %T): got %v, want %q", c.v, c.target, err, c.err)
+		}
+	}
+}
@@ -1,4 +1,83 @@
 package compile
 
-// Value is a value.
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Value is a value. Lists are []Value, and maps are map[string]Value.
 type Value interface{}
+
+// typeNames are the names that TypeName can return, and that may appear on
+// the right side of an `is` check.
+var typeNames = map[string]bool{
+	"nil":    true,
+	"bool":   true,
+	"int":    true,
+	"float":  true,
+	"string": true,
+	"tuple":  true,
+	"list":   true,
+	"map":    true,
+	"fn":     true,
+	"regex":  true,
+	"time":   true,
+	"record": true,
+}
+
+var typeNamesMu sync.RWMutex
+
+// IsTypeName checks if a name is the name of a meh type.
+func IsTypeName(name string) bool {
+	typeNamesMu.RLock()
+	defer typeNamesMu.RUnlock()
+
+	return typeNames[name]
+}
+
+// RegisterTypeName adds the name of a type, as returned by the TypeName
+// method of an embedder's values, so that scripts may check for it with `is`.
+// Names should be registered before any script is compiled.
+func RegisterTypeName(name string) {
+	typeNamesMu.Lock()
+	defer typeNamesMu.Unlock()
+
+	typeNames[name] = true
+}
+
+// TypeName returns the meh name of the type of a Value.
+func TypeName(v Value) string {
+
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case Tuple:
+		return "tuple"
+	case []Value:
+		return "list"
+	case map[string]Value:
+		return "map"
+	case func(*Context, ...Value) (Value, error):
+		return "fn"
+	case *regexp.Regexp:
+		return "regex"
+	case time.Time:
+		return "time"
+	case Record:
+		return "record"
+	case TypeNamer:
+		return v.(TypeNamer).TypeName()
+	}
+
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,209 @@
+// Package diag describes the problems found in a script, as Diagnostics that
+// editors and CI tools can consume, e.g. as JSON.
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious a Diagnostic is.
+type Severity int
+
+// The severities of diagnostics. Only errors stop a script from running.
+const (
+	Error Severity = iota
+	Warning
+	Info
+)
+
+var severityNames = []string{"error", "warning", "info"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the name of a severity.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if string(text) == name {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Code identifies the kind of problem a Diagnostic reports. The codes are
+// stable, so that tools may act on them.
+type Code string
+
+// The codes of diagnostics.
+const (
+	Lex               Code = "lex"                 // a malformed token, e.g. an unclosed string
+	UnclosedBrace     Code = "unclosed-brace"      // a { without a }
+	UnclosedParen     Code = "unclosed-paren"      // a ( without a )
+	UnmatchedClose    Code = "unmatched-close"     // a ) or } without a ( or {
+	MisplacedOperator Code = "misplaced-operator"  // an operator missing an operand
+	Syntax            Code = "syntax"              // a statement that cannot be parsed
+	Compile           Code = "compile"             // a problem found compiling the parse tree
+	Type              Code = "type"                // a mismatch with a type annotation
+	Runtime           Code = "runtime"             // an error while running the script
+	Policy            Code = "policy"              // a construct a filter may not use
+	Unused            Code = "unused"              // a name a function assigns but never reads
+	UnreadAssignment  Code = "unread-assignment"   // a value assigned, then replaced before it is read
+	Unreachable       Code = "unreachable"         // a statement after a return, break, or continue
+	AssignInCondition Code = "assign-in-condition" // an = where == was likely meant
+	Shadow            Code = "shadow"              // an assignment hiding a name of an enclosing scope
+	EmptyBlock        Code = "empty-block"         // a block with no statements, and no effect
+)
+
+// Diagnostic is a problem found in a script, with the span of the script it
+// concerns. Lines and columns count from 1, and the end is inclusive. A
+// Diagnostic without a position has a Line of 0.
+type Diagnostic struct {
+	File      string   `json:"file,omitempty"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"endLine"`
+	EndColumn int      `json:"endColumn"`
+	Severity  Severity `json:"severity"`
+	Code      Code     `json:"code"`
+	Message   string   `json:"message"`
+}
+
+// Error formats the diagnostic as file:line:column: severity: message [code].
+func (d Diagnostic) Error() string {
+
+	b := strings.Builder{}
+
+	if d.File != "" {
+		b.WriteString(d.File)
+		b.WriteString(":")
+	}
+
+	if d.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d: ", d.Line, d.Column)
+	} else if d.File != "" {
+		b.WriteString(" ")
+	}
+
+	fmt.Fprintf(&b, "%s: %s [%s]", d.Severity, d.Message, d.Code)
+
+	return b.String()
+}
+
+// Diagnoser is implemented by errors that can describe themselves as a
+// Diagnostic, e.g. the positioned errors of the lexer.
+type Diagnoser interface {
+	error
+	Diagnostic(code Code) Diagnostic
+}
+
+// From converts an error to a Diagnostic. An error that is, or wraps, a
+// Diagnostic or a Diagnoser keeps its position; other errors have none. The
+// code is used if the error does not carry one.
+func From(err error, code Code) Diagnostic {
+
+	var d Diagnostic
+	if errors.As(err, &d) {
+		return d
+	}
+
+	var dr Diagnoser
+	if errors.As(err, &dr) {
+		d = dr.Diagnostic(code)
+		if _, ok := err.(Diagnoser); !ok {
+			// keep what wrapping the error adds, e.g. a stack trace.
+			d.Message = strings.Replace(err.Error(), dr.Error(), d.Message, 1)
+		}
+		return d
+	}
+
+	return Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  err.Error(),
+	}
+}
+
+// List is the diagnostics found in a script, in the order found.
+type List []Diagnostic
+
+// Error formats the diagnostics, one per line.
+func (l List) Error() string {
+
+	lines := make([]string, len(l))
+	for i, d := range l {
+		lines[i] = d.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Append adds an error to the list, converted with From, or all of the
+// diagnostics of an error that is itself a List.
+func (l List) Append(err error, code Code) List {
+
+	var more List
+	if errors.As(err, &more) {
+		return append(l, more...)
+	}
+
+	return append(l, From(err, code))
+}
+
+// ListOf converts errors to a List, with From.
+func ListOf(errs []error) List {
+
+	l := make(List, len(errs))
+	for i, err := range errs {
+		l[i] = From(err, Syntax)
+	}
+
+	return l
+}
+
+// Sort orders the diagnostics by position: those of a file by line and
+// column, and the files in the order they were first found. Diagnostics
+// without a position come first in their file, in the order found.
+func (l List) Sort() {
+
+	files := make(map[string]int)
+	for _, d := range l {
+		if _, ok := files[d.File]; !ok {
+			files[d.File] = len(files)
+		}
+	}
+
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i], l[j]
+		if a.File != b.File {
+			return files[a.File] < files[b.File]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// Err returns the list as an error if it has any of severity Error, or nil.
+func (l List) Err() error {
+	for _, d := range l {
+		if d.Severity == Error {
+			return l
+		}
+	}
+	return nil
+}
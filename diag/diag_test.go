@@ -0,0 +1,31 @@
+package diag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+
+	l := List{
+		{File: "a.meh", Line: 4, Column: 1},
+		{File: "a.meh", Line: 5, Column: 2},
+		{File: "b.meh", Line: 1, Column: 1},
+		{File: "a.meh", Line: 3, Column: 7},
+		{File: "a.meh", Line: 5, Column: 1},
+		{File: "a.meh"},
+	}
+	l.Sort()
+
+	want := List{
+		{File: "a.meh"},
+		{File: "a.meh", Line: 3, Column: 7},
+		{File: "a.meh", Line: 4, Column: 1},
+		{File: "a.meh", Line: 5, Column: 1},
+		{File: "a.meh", Line: 5, Column: 2},
+		{File: "b.meh", Line: 1, Column: 1},
+	}
+	if !reflect.DeepEqual(l, want) {
+		t.Errorf("sorted\n\t%v\nwant\n\t%v", l, want)
+	}
+}
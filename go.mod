@@ -4,5 +4,6 @@ go 1.15
 
 require (
 	github.com/alecthomas/participle v0.6.0
+	github.com/peterh/liner v1.2.1
 	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
 )
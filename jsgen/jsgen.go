@@ -0,0 +1,309 @@
+// Package jsgen translates scripts to JavaScript, so that rules written in
+// meh, and validated by the interpreter, can also run in a browser, or in
+// node.
+package jsgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// available are the builtins the JavaScript runtime provides. A script
+// reading any other builtin, e.g. now or read_line, cannot be translated.
+var available = map[string]bool{
+	"type": true, "len": true, "list": true, "dict": true,
+	"int": true, "float": true, "str": true, "bool": true,
+	"map": true, "filter": true, "reduce": true, "sort": true, "sort_by": true,
+	"zip": true, "enumerate": true, "range": true,
+	"min": true, "max": true, "sum": true, "abs": true,
+	"assert": true, "assert_eq": true, "error": true,
+	"args": true,
+}
+
+// compileBuiltins are the names of the interpreter's builtins.
+var compileBuiltins = builtinNames()
+
+func builtinNames() map[string]bool {
+
+	names := make(map[string]bool)
+	for _, name := range compile.NewTopContext().Names() {
+		names[name] = true
+	}
+
+	return names
+}
+
+// identifier matches the names that Generate accepts for the function.
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// Generate translates a parsed script to JavaScript: a module defining a
+// function with the given name, which runs the script, e.g.
+//
+//	const { run } = require("./rules.js");
+//	run({ price: 2.5, qty: 4 }); // 10
+//
+// The function takes the names to assign before the script runs, and the
+// script's args, and returns the value of its last statement. It is
+// exported with module.exports if there is one, and as a global otherwise.
+//
+// Ints are BigInts while the script runs, so that they keep their 64 bits,
+// and are converted to numbers in the result, as are whole numbers to ints
+// in the names given. Maps are Maps, and objects in the result. An error is
+// thrown as an Error with the message the interpreter reports, as far as it
+// can be told in JavaScript.
+//
+// Only the builtins that do not reach the host, and do not depend on Go's
+// formatting, are available; a script reading another, or using a custom
+// operator, is refused, with a diag.List of the problems found.
+func Generate(name string, node parser.Node) (string, error) {
+
+	if !identifier.MatchString(name) {
+		return "", fmt.Errorf("cannot name the function %q: not a JavaScript identifier", name)
+	}
+
+	g := &generator{assigned: assignedNames(node)}
+	body := g.expr(node)
+	if len(g.errs) > 0 {
+		return "", g.errs
+	}
+
+	out := strings.Builder{}
+	fmt.Fprintf(&out, "// Code generated by meh js. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "(function () {\n\"use strict\";\n%s\n", runtimeJS)
+	fmt.Fprintf(&out, "function %s(vars, args) {\n", name)
+	fmt.Fprintf(&out, "\treturn rt.run(function (ctx) { return %s; }, vars, args);\n}\n\n", body)
+	fmt.Fprintf(&out, "if (typeof module !== \"undefined\" && module.exports) {\n")
+	fmt.Fprintf(&out, "\tmodule.exports.%s = %s;\n} else {\n\tglobalThis.%s = %s;\n}\n", name, name, name, name)
+	fmt.Fprintf(&out, "})();\n")
+
+	return out.String(), nil
+}
+
+// assignedNames returns the names a script assigns, or takes as parameters.
+func assignedNames(node parser.Node) map[string]bool {
+
+	names := make(map[string]bool)
+	parser.Inspect(node, func(n parser.Node) bool {
+		switch {
+		case n.Type().Match(lex.Assign) && len(n.Children) == 2:
+			names[n.Children[0].Item.Value] = true
+		case n.Type().Match(lex.Function) && len(n.Children) > 0:
+			for _, p := range n.Children[0].Children {
+				if p.Type().Match(lex.Colon) && len(p.Children) == 2 {
+					p = p.Children[0]
+				}
+				names[p.Item.Value] = true
+			}
+		}
+		return true
+	})
+
+	return names
+}
+
+// generator translates the nodes of a script, collecting the problems found
+// rather than stopping at the first, as the compiler does.
+type generator struct {
+	assigned map[string]bool
+	errs     diag.List
+}
+
+// fail records a problem with a node, and returns an expression to stand in
+// for it.
+func (g *generator) fail(node parser.Node, err error) string {
+	g.errs = g.errs.Append(node.Error(err), diag.Compile)
+	return "null"
+}
+
+// thunk wraps an expression in a function, to be evaluated by the runtime
+// when, and if, it is needed.
+func thunk(js string) string {
+	return "function () { return " + js + "; }"
+}
+
+// quote returns a JavaScript string literal of s.
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// position returns the prefix the interpreter gives the errors of a node.
+func position(node parser.Node) string {
+	return quote(strings.TrimSuffix(node.Error(errors.New("")).Error(), " "))
+}
+
+// expr translates a node to a JavaScript expression evaluated with the
+// script's context as ctx.
+func (g *generator) expr(node parser.Node) string {
+
+	switch node.Type() {
+	case lex.LeftBrace:
+		stmts := make([]string, len(node.Children))
+		for i, n := range node.Children {
+			stmts[i] = thunk(g.expr(n))
+		}
+		return "rt.block([" + strings.Join(stmts, ", ") + "])"
+
+	case lex.Ident:
+		name := node.Item.Value
+		if compileBuiltins[name] && !available[name] && !g.assigned[name] {
+			return g.fail(node, fmt.Errorf("%s is not available in JavaScript", name))
+		}
+		return "ctx.get(" + quote(name) + ")"
+
+	case lex.Nil:
+		return "null"
+	case lex.True:
+		return "true"
+	case lex.False:
+		return "false"
+
+	case lex.Return:
+		if len(node.Children) == 0 {
+			return "new rt.Flow(rt.RETURN, \"\", null)"
+		}
+		return "new rt.Flow(rt.RETURN, \"\", " + g.expr(node.Children[0]) + ")"
+
+	case lex.Break, lex.Continue:
+		flow, label := "rt.BREAK", ""
+		if node.Type().Match(lex.Continue) {
+			flow = "rt.CONTINUE"
+		}
+		if len(node.Children) > 0 {
+			label = node.Children[0].Item.Value
+		}
+		return "new rt.Flow(" + flow + ", " + quote(label) + ", null)"
+
+	case lex.Function:
+		return g.function(node)
+
+	case lex.FuncApply:
+		args := make([]string, len(node.Children[1].Children))
+		for i, a := range node.Children[1].Children {
+			args[i] = g.expr(a)
+		}
+		return "rt.call(ctx, " + position(node) + ", " + g.expr(node.Children[0]) +
+			", " + thunk("["+strings.Join(args, ", ")+"]") + ")"
+
+	case lex.Assign:
+		if len(node.Children) != 2 || !node.Children[0].Type().Match(lex.Ident) {
+			return g.fail(node, fmt.Errorf("assignment requires an identifier"))
+		}
+		return "ctx.set(" + quote(node.Children[0].Item.Value) + ", " + g.expr(node.Children[1]) + ")"
+
+	case lex.Number:
+		if i, err := strconv.ParseInt(node.Item.Value, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10) + "n"
+		}
+		f, err := strconv.ParseFloat(node.Item.Value, 64)
+		if err != nil {
+			return g.fail(node, fmt.Errorf("failed to convert number"))
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+
+	case lex.BacktickString, lex.DoubleQuoteString, lex.SingleQuoteString:
+		s, err := strconv.Unquote(node.Item.Value)
+		if err != nil {
+			return g.fail(node, fmt.Errorf("failed to convert string: %v", err))
+		}
+		return quote(s)
+
+	case lex.Regex:
+		return g.regex(node)
+
+	case lex.And, lex.Or:
+		f := "rt.and"
+		if node.Type().Match(lex.Or) {
+			f = "rt.or"
+		}
+		return f + "(" + thunk(g.expr(node.Children[0])) + ", " + thunk(g.expr(node.Children[1])) + ")"
+
+	case lex.Is:
+		name := node.Children[1].Item.Value
+		if !compile.IsTypeName(name) {
+			return g.fail(node, fmt.Errorf("unknown type name %q", name))
+		}
+		return "(rt.typeName(" + g.expr(node.Children[0]) + ") === " + quote(name) + ")"
+
+	case lex.Until:
+		do := node.Children[0]
+		if !do.Type().Match(lex.Do) || len(do.Children) == 0 {
+			return g.fail(node, fmt.Errorf("until requires a preceding do block"))
+		}
+		label := ""
+		if len(do.Children) > 1 {
+			label = do.Children[1].Item.Value
+		}
+		return "rt.loop(" + quote(label) + ", " + thunk(g.expr(do.Children[0])) + ", " + thunk(g.expr(node.Children[1])) + ")"
+
+	case lex.Dot:
+		return "rt.member(" + position(node) + ", " + g.expr(node.Children[0]) + ", " + quote(node.Children[1].Item.Value) + ")"
+
+	case lex.Plus, lex.Minus, lex.Mult, lex.Div, lex.Modulo,
+		lex.Equal, lex.NotEqual, lex.Greater, lex.GreaterOrEqual, lex.Less, lex.LessOrEqual:
+		return "rt.op(" + position(node) + ", " + quote(node.Item.Value) + ", " +
+			g.expr(node.Children[0]) + ", " + g.expr(node.Children[1]) + ")"
+	}
+
+	if _, ok := compile.CustomOperator(node.Type()); ok {
+		return g.fail(node, fmt.Errorf("custom operator %s is not available in JavaScript", node.Item.Value))
+	}
+
+	return g.fail(node, fmt.Errorf("cannot translate %s", node))
+}
+
+// function translates a fn. Its body runs in a new context of the caller's,
+// as in the interpreter, so that it sees the names of its callers.
+func (g *generator) function(node parser.Node) string {
+
+	if len(node.Children) != 2 && len(node.Children) != 3 {
+		return g.fail(node, fmt.Errorf("malformed function: requires param list & body"))
+	}
+
+	params := []string{}
+	for _, p := range node.Children[0].Children {
+		if p.Type().Match(lex.Colon) && len(p.Children) == 2 {
+			p = p.Children[0]
+		}
+		if !p.Type().Match(lex.Ident) {
+			return g.fail(node, fmt.Errorf("malformed function, parameters must be identifiers, found %v", p))
+		}
+		params = append(params, quote(p.Item.Value))
+	}
+
+	body := node.Children[1]
+	if !body.Type().Match(lex.LeftBrace) {
+		return g.fail(node, fmt.Errorf("malformed function: requires block"))
+	}
+
+	return "rt.fn([" + strings.Join(params, ", ") + "], function (ctx) { return " + g.expr(body) + "; })"
+}
+
+// regex translates a regex literal to a RegExp. Go's and JavaScript's
+// syntaxes agree for the common patterns; the U flag has no counterpart.
+func (g *generator) regex(node parser.Node) string {
+
+	lit := node.Item.Value
+	end := strings.LastIndex(lit, "/")
+	if end < 1 {
+		return g.fail(node, fmt.Errorf("malformed regex"))
+	}
+
+	pattern, flags := lit[1:end], lit[end+1:]
+	for _, f := range flags {
+		if !strings.ContainsRune("ims", f) {
+			return g.fail(node, fmt.Errorf("regex flag %q is not available in JavaScript", f))
+		}
+	}
+
+	return "new RegExp(" + quote(pattern) + ", " + quote(flags) + ")"
+}
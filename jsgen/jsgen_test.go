@@ -0,0 +1,127 @@
+package jsgen
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/parser"
+)
+
+func parse(t *testing.T, src string) parser.Node {
+
+	node, errs := parser.NewFromString("script.meh", src).Parse()
+	if len(errs) > 0 {
+		t.Fatalf("%q: %v", src, errs)
+	}
+
+	return node
+}
+
+func TestGenerateRefuses(t *testing.T) {
+
+	for _, c := range []struct {
+		name, src string
+		errs      []string
+	}{
+		{"run", "read_line()\n", []string{`script.meh:1:1: error: read_line is not available in JavaScript [compile]`}},
+		{"run", "x = now()\ny = 1 is widget\n", []string{
+			`script.meh:1:5: error: now is not available in JavaScript [compile]`,
+			`script.meh:2:5: error: unknown type name "widget" [compile]`,
+		}},
+		{"not-a-name", "1\n", []string{`cannot name the function "not-a-name": not a JavaScript identifier`}},
+	} {
+		_, err := Generate(c.name, parse(t, c.src))
+		if err == nil {
+			t.Errorf("%q: generated", c.src)
+			continue
+		}
+		if err.Error() != strings.Join(c.errs, "\n") {
+			t.Errorf("%q: error\n\t%v\nwant\n\t%s", c.src, err, strings.Join(c.errs, "\n\t"))
+		}
+	}
+}
+
+// TestGenerateRuns runs scripts translated to JavaScript in node, if it is
+// installed, and checks that they produce what the interpreter does.
+func TestGenerateRuns(t *testing.T) {
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "jsgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	semantics, err := ioutil.ReadFile("../ex/semantics.meh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, src := range []string{
+		"price * qty\n",
+		"7 / 2\n",
+		"9223372036854775807 + 1 == 0 - 9223372036854775807 - 1\n",
+		"f = fn(n) { n < 2 && return 1; return n * f(n - 1) }\nf(20)\n",
+		"map(list(1, 2, 3), fn(x) { x * 2.5 })\n",
+		"s = 0\ni = 0\ndo { i = i + 1; i == 3 && continue; s = s + i } until i >= 5\ns\n",
+		"dict(\"a\", 1, \"b\", list(true, nil))\n",
+		"type(1.5) + \" \" + type(\"x\")\n",
+		"mk = fn(a) { fn(b) { return b * 3 } }\nmk(1)(2)\n",
+		string(semantics) + "\"ok\"\n",
+	} {
+		want := interpret(t, src)
+
+		js, err := Generate("run", parse(t, src))
+		if err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+
+		file := filepath.Join(dir, "script.js")
+		if err := ioutil.WriteFile(file, []byte(js), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := exec.Command(node, "-e",
+			`const { run } = require(process.argv[1]); console.log(JSON.stringify(run({ price: 2.5, qty: 4 })))`,
+			file).CombinedOutput()
+		if err != nil {
+			t.Errorf("script %d: node failed: %v\n%s", i, err, out)
+			continue
+		}
+
+		if got := strings.TrimSpace(string(out)); got != want {
+			t.Errorf("script %d: JavaScript produced %s, interpreter %s", i, got, want)
+		}
+	}
+}
+
+// interpret runs a script in the interpreter, and returns its value as JSON.
+func interpret(t *testing.T, src string) string {
+
+	program, err := compile.NewProgram("script.meh", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := program.Run(map[string]interface{}{"price": 2.5, "qty": 4})
+	if err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out)
+}
@@ -0,0 +1,628 @@
+package jsgen
+
+// runtimeJS is the runtime that generated code calls on, mirroring package
+// compile: ints are BigInts, wrapped to 64 bits, floats are Numbers, maps are
+// Maps, tuples are Tuples, and a function is a JS function of the caller's
+// context and a list of arguments. Names are looked up in a chain of
+// contexts, as in the interpreter, so that functions see the names of their
+// callers.
+const runtimeJS = `
+var rt = (function () {
+	"use strict";
+
+	function MehError(message) {
+		this.name = "MehError";
+		this.message = message;
+		this.stack = (new Error(message)).stack;
+	}
+	MehError.prototype = Object.create(Error.prototype);
+	MehError.prototype.constructor = MehError;
+
+	function fail(message) {
+		throw new MehError(message);
+	}
+
+	// positioned gives an error the position of the code that failed, once.
+	function positioned(pos, err) {
+		if (err instanceof MehError) {
+			if (!err.positioned) {
+				err.message = pos + " " + err.message;
+				err.positioned = true;
+			}
+			return err;
+		}
+		var e = new MehError(pos + " " + (err && err.message !== undefined ? err.message : String(err)));
+		e.positioned = true;
+		return e;
+	}
+
+	function Tuple(values) {
+		this.values = values;
+	}
+
+	var RETURN = 1, BREAK = 2, CONTINUE = 3;
+
+	function Flow(type, label, value) {
+		this.type = type;
+		this.label = label;
+		this.value = value;
+	}
+
+	function Ctx(parent) {
+		this.values = new Map();
+		this.parent = parent;
+	}
+	Ctx.prototype.get = function (name) {
+		for (var c = this; c; c = c.parent) {
+			if (c.values.has(name)) {
+				return c.values.get(name);
+			}
+		}
+		return null;
+	};
+	Ctx.prototype.set = function (name, v) {
+		this.values.set(name, v);
+		return v;
+	};
+
+	function isInt(v) { return typeof v === "bigint"; }
+	function isFloat(v) { return typeof v === "number"; }
+	function isFn(v) { return typeof v === "function"; }
+
+	function typeName(v) {
+		if (v === null || v === undefined) { return "nil"; }
+		if (typeof v === "boolean") { return "bool"; }
+		if (isInt(v)) { return "int"; }
+		if (isFloat(v)) { return "float"; }
+		if (typeof v === "string") { return "string"; }
+		if (v instanceof Tuple) { return "tuple"; }
+		if (Array.isArray(v)) { return "list"; }
+		if (v instanceof Map) { return "map"; }
+		if (isFn(v)) { return "fn"; }
+		if (v instanceof RegExp) { return "regex"; }
+		return typeof v;
+	}
+
+	// goType returns the name Go gives the type of a value, for the errors
+	// that the interpreter reports with it.
+	function goType(v) {
+		var names = {
+			nil: "<nil>", int: "int64", float: "float64",
+			list: "[]compile.Value", map: "map[string]compile.Value",
+			tuple: "compile.Tuple", regex: "*regexp.Regexp",
+			fn: "func(*compile.Context, ...compile.Value) (compile.Value, error)"
+		};
+		var t = typeName(v);
+		return names[t] || t;
+	}
+
+	function truthy(v) {
+		if (typeof v === "boolean") { return v; }
+		if (v instanceof Tuple) {
+			return v.values.length === 0 ? true : truthy(v.values[0]);
+		}
+		return true;
+	}
+
+	function result(v) {
+		if (v instanceof Tuple && v.values.length === 2 && v.values[0] === true) {
+			return v.values[1];
+		}
+		return v;
+	}
+
+	function block(stmts) {
+		var last = null;
+		for (var i = 0; i < stmts.length; i++) {
+			last = stmts[i]();
+			if (last instanceof Flow) {
+				return last;
+			}
+		}
+		return new Tuple([true, last]);
+	}
+
+	function fn(params, body) {
+		return function (ctx, args) {
+			if (args.length !== params.length) {
+				fail("failed to apply function: received " + args.length + " arguments for " + params.length + " parameters");
+			}
+			var c = new Ctx(ctx);
+			for (var i = 0; i < params.length; i++) {
+				c.set(params[i], args[i]);
+			}
+			return body(c);
+		};
+	}
+
+	function apply(ctx, f, args) {
+		var res = f(ctx, args);
+		if (res instanceof Flow) {
+			if (res.type === RETURN) {
+				return res.value;
+			}
+			fail("FuncApply received non-return flow control change");
+		}
+		return res;
+	}
+
+	function call(ctx, pos, f, args) {
+		// as compile.Callable, call the fn a fn produced without a return.
+		f = result(f);
+		if (!isFn(f)) {
+			fail("cannot invoke non-function: " + goType(f) + " " + formatValue(f));
+		}
+		try {
+			return apply(ctx, f, args());
+		} catch (err) {
+			throw positioned(pos, err);
+		}
+	}
+
+	// callback calls a script function for a builtin, unwrapping its result.
+	function callback(ctx, f, args) {
+		return result(apply(ctx, f, args));
+	}
+
+	function and(l, r) {
+		var v = l();
+		return truthy(v) ? r() : v;
+	}
+
+	function or(l, r) {
+		var v = l();
+		return truthy(v) ? v : r();
+	}
+
+	function loop(label, body, cond) {
+		var last = null;
+		for (;;) {
+			var v = body();
+			if (v instanceof Flow) {
+				if (v.type === RETURN || (v.label !== "" && v.label !== label)) {
+					return v;
+				}
+				if (v.type === BREAK) {
+					return last;
+				}
+			} else {
+				last = v;
+			}
+			if (truthy(cond())) {
+				return last;
+			}
+		}
+	}
+
+	function member(pos, v, name) {
+		if (v instanceof Map) {
+			return v.has(name) ? v.get(name) : null;
+		}
+		throw positioned(pos, new MehError("cannot access ." + name + " of " + typeName(v)));
+	}
+
+	function wrap(i) {
+		return BigInt.asIntN(64, i);
+	}
+
+	var intOps = {
+		"+": function (a, b) { return wrap(a + b); },
+		"-": function (a, b) { return wrap(a - b); },
+		"*": function (a, b) { return wrap(a * b); },
+		"/": function (a, b) {
+			if (b === 0n) { fail("integer divide by zero"); }
+			return wrap(a / b);
+		},
+		"%": function (a, b) {
+			if (b === 0n) { fail("integer divide by zero"); }
+			return a % b;
+		}
+	};
+
+	var floatOps = {
+		"+": function (a, b) { return a + b; },
+		"-": function (a, b) { return a - b; },
+		"*": function (a, b) { return a * b; },
+		"/": function (a, b) { return a / b; }
+	};
+
+	var compareOps = {
+		"==": function (a, b) { return a === b; },
+		"!=": function (a, b) { return a !== b; },
+		">": function (a, b) { return a > b; },
+		">=": function (a, b) { return a >= b; },
+		"<": function (a, b) { return a < b; },
+		"<=": function (a, b) { return a <= b; }
+	};
+
+	function operate(op, a, b) {
+		var cmp = compareOps[op];
+		if (isInt(a) && isInt(b)) {
+			return cmp ? cmp(a, b) : intOps[op](a, b);
+		}
+		if ((isInt(a) || isFloat(a)) && (isInt(b) || isFloat(b)) && (cmp || floatOps[op])) {
+			return (cmp || floatOps[op])(Number(a), Number(b));
+		}
+		if (typeof a === "string" && typeof b === "string" && (cmp || op === "+")) {
+			return cmp ? cmp(a, b) : a + b;
+		}
+		fail("cannot apply operator to argument types " + goType(a) + ", " + goType(b));
+	}
+
+	function op(pos, o, a, b) {
+		try {
+			return operate(o, a, b);
+		} catch (err) {
+			throw positioned(pos, err);
+		}
+	}
+
+	function equal(a, b) {
+		if ((isInt(a) || isFloat(a)) && (isInt(b) || isFloat(b))) {
+			return Number(a) === Number(b) && (!isInt(a) || !isInt(b) || a === b);
+		}
+		if (Array.isArray(a) || a instanceof Tuple) {
+			var x = Array.isArray(a) ? a : a.values;
+			var y = Array.isArray(a) ? (Array.isArray(b) ? b : null) : (b instanceof Tuple ? b.values : null);
+			if (!y || x.length !== y.length) { return false; }
+			for (var i = 0; i < x.length; i++) {
+				if (!equal(x[i], y[i])) { return false; }
+			}
+			return true;
+		}
+		if (a instanceof Map) {
+			if (!(b instanceof Map) || a.size !== b.size) { return false; }
+			var same = true;
+			a.forEach(function (v, k) {
+				if (!b.has(k) || !equal(v, b.get(k))) { same = false; }
+			});
+			return same;
+		}
+		return a === b;
+	}
+
+	function compare(a, b) {
+		if ((isInt(a) || isFloat(a)) && (isInt(b) || isFloat(b))) {
+			var x = isInt(a) && isInt(b) ? a : Number(a), y = isInt(a) && isInt(b) ? b : Number(b);
+			return x < y ? -1 : x > y ? 1 : 0;
+		}
+		if ((typeof a === "string" && typeof b === "string") || (typeof a === "boolean" && typeof b === "boolean")) {
+			return a < b ? -1 : a > b ? 1 : 0;
+		}
+		fail("cannot compare " + typeName(a) + " and " + typeName(b));
+	}
+
+	// formatFloat formats a float as Go's strconv.FormatFloat(f, 'g', -1, 64).
+	function formatFloat(f) {
+		if (isNaN(f)) { return "NaN"; }
+		if (f === Infinity) { return "+Inf"; }
+		if (f === -Infinity) { return "-Inf"; }
+		var e = f.toExponential().split("e");
+		var exp = parseInt(e[1], 10);
+		if (exp < -4 || exp >= 6) {
+			var digits = e[1].replace(/^[+-]/, "");
+			return e[0] + "e" + (exp < 0 ? "-" : "+") + (digits.length < 2 ? "0" : "") + digits;
+		}
+		return String(f);
+	}
+
+	function str(v) {
+		if (v === null || v === undefined) { return "nil"; }
+		return formatValue(v);
+	}
+
+	// formatValue formats a value as Go's fmt does with %v.
+	function formatValue(v) {
+		if (v === null || v === undefined) { return "<nil>"; }
+		if (isInt(v)) { return v.toString(); }
+		if (isFloat(v)) { return formatFloat(v); }
+		if (Array.isArray(v)) { return "[" + v.map(formatValue).join(" ") + "]"; }
+		if (v instanceof Tuple) { return "{[" + v.values.map(formatValue).join(" ") + "]}"; }
+		if (v instanceof Map) {
+			var keys = Array.from(v.keys()).sort();
+			return "map[" + keys.map(function (k) { return k + ":" + formatValue(v.get(k)); }).join(" ") + "]";
+		}
+		if (v instanceof RegExp) { return v.source; }
+		return String(v);
+	}
+
+	function failure(message) {
+		return new Tuple([false, message]);
+	}
+
+	function expectArgs(name, args, n) {
+		if (args.length !== n) {
+			fail(name + ": received " + args.length + " arguments, requires " + n);
+		}
+	}
+
+	function expectArgRange(name, args, min, max) {
+		if (args.length < min || args.length > max) {
+			fail(name + ": received " + args.length + " arguments, requires " + min + " to " + max);
+		}
+	}
+
+	function arg(name, args, i, type) {
+		if (typeName(args[i]) !== type) {
+			fail(name + ": argument " + (i + 1) + " must be a" + (type === "int" ? "n " : " ") + type + ", received " + typeName(args[i]));
+		}
+		return args[i];
+	}
+
+	function aggregate(name, pick) {
+		return function (ctx, args) {
+			var nums = args.length === 1 && Array.isArray(args[0]) ? args[0] : args;
+			if (nums.length === 0) {
+				fail(name + ": requires at least one number");
+			}
+			nums.forEach(function (v, i) {
+				if (!isInt(v) && !isFloat(v)) {
+					fail(name + ": element " + i + " must be a number, received " + typeName(v));
+				}
+			});
+			var res = nums[0];
+			for (var i = 1; i < nums.length; i++) {
+				res = pick(res, nums[i]);
+			}
+			return res;
+		};
+	}
+
+	var builtins = {
+		type: function (ctx, args) {
+			expectArgs("type", args, 1);
+			return typeName(args[0]);
+		},
+		len: function (ctx, args) {
+			expectArgs("len", args, 1);
+			var v = args[0];
+			if (typeof v === "string") { return BigInt(Array.from(v).length); }
+			if (Array.isArray(v)) { return BigInt(v.length); }
+			if (v instanceof Map) { return BigInt(v.size); }
+			if (v instanceof Tuple) { return BigInt(v.values.length); }
+			fail("len: cannot take the length of " + typeName(v));
+		},
+		list: function (ctx, args) {
+			return args.slice();
+		},
+		dict: function (ctx, args) {
+			if (args.length % 2 !== 0) {
+				fail("dict: requires pairs of keys and values, received " + args.length + " arguments");
+			}
+			var m = new Map();
+			for (var i = 0; i < args.length; i += 2) {
+				if (typeof args[i] !== "string") {
+					fail("dict: keys must be strings, received " + typeName(args[i]));
+				}
+				m.set(args[i], args[i + 1]);
+			}
+			return m;
+		},
+		int: function (ctx, args) {
+			expectArgs("int", args, 1);
+			var v = args[0];
+			if (isInt(v)) { return v; }
+			if (isFloat(v)) {
+				if (isNaN(v) || v >= 9223372036854775807 || v < -9223372036854775808) {
+					return failure("int: " + formatFloat(v) + " is out of range");
+				}
+				return BigInt(Math.trunc(v));
+			}
+			if (typeof v === "string") {
+				var s = v.trim();
+				if (!/^[+-]?(0[xX][0-9a-fA-F_]+|0[oO]?[0-7_]+|0[bB][01_]+|[1-9][0-9_]*|0)$/.test(s)) {
+					return failure("int: cannot parse " + JSON.stringify(v));
+				}
+				var neg = s[0] === "-";
+				var digits = s.replace(/^[+-]/, "").replace(/_/g, "").replace(/^0([0-7])/, "0o$1").replace(/^0O/, "0o");
+				var n = BigInt(digits);
+				n = neg ? -n : n;
+				if (n !== BigInt.asIntN(64, n)) {
+					return failure("int: cannot parse " + JSON.stringify(v));
+				}
+				return n;
+			}
+			if (typeof v === "boolean") { return v ? 1n : 0n; }
+			return failure("int: cannot convert " + typeName(v));
+		},
+		float: function (ctx, args) {
+			expectArgs("float", args, 1);
+			var v = args[0];
+			if (isFloat(v)) { return v; }
+			if (isInt(v)) { return Number(v); }
+			if (typeof v === "string") {
+				var s = v.trim();
+				var f = /^[+-]?(inf|infinity)$/i.test(s) ? (s[0] === "-" ? -Infinity : Infinity) : Number(s);
+				if (s === "" || isNaN(f) && !/^[+-]?nan$/i.test(s)) {
+					return failure("float: cannot parse " + JSON.stringify(v));
+				}
+				return f;
+			}
+			if (typeof v === "boolean") { return v ? 1 : 0; }
+			return failure("float: cannot convert " + typeName(v));
+		},
+		str: function (ctx, args) {
+			expectArgs("str", args, 1);
+			return str(args[0]);
+		},
+		bool: function (ctx, args) {
+			expectArgs("bool", args, 1);
+			var v = args[0];
+			if (typeof v === "string") {
+				var s = v.trim();
+				if (["1", "t", "T", "TRUE", "true", "True"].indexOf(s) >= 0) { return true; }
+				if (["0", "f", "F", "FALSE", "false", "False"].indexOf(s) >= 0) { return false; }
+				return failure("bool: cannot parse " + JSON.stringify(v));
+			}
+			return truthy(v);
+		},
+		map: function (ctx, args) {
+			expectArgs("map", args, 2);
+			var list = arg("map", args, 0, "list"), f = arg("map", args, 1, "fn");
+			return list.map(function (v) { return callback(ctx, f, [v]); });
+		},
+		filter: function (ctx, args) {
+			expectArgs("filter", args, 2);
+			var list = arg("filter", args, 0, "list"), f = arg("filter", args, 1, "fn");
+			return list.filter(function (v) { return truthy(callback(ctx, f, [v])); });
+		},
+		reduce: function (ctx, args) {
+			expectArgs("reduce", args, 3);
+			var list = arg("reduce", args, 0, "list"), f = arg("reduce", args, 1, "fn");
+			return list.reduce(function (acc, v) { return callback(ctx, f, [acc, v]); }, args[2]);
+		},
+		sort: function (ctx, args) {
+			expectArgs("sort", args, 1);
+			var list = arg("sort", args, 0, "list").slice();
+			try {
+				return list.sort(compare);
+			} catch (err) {
+				fail("sort: " + err.message);
+			}
+		},
+		sort_by: function (ctx, args) {
+			expectArgs("sort_by", args, 2);
+			var list = arg("sort_by", args, 0, "list"), f = arg("sort_by", args, 1, "fn");
+			var keyed = list.map(function (v, i) { return { v: v, k: callback(ctx, f, [v]), i: i }; });
+			try {
+				keyed.sort(function (a, b) { return compare(a.k, b.k) || a.i - b.i; });
+			} catch (err) {
+				fail("sort_by: " + err.message);
+			}
+			return keyed.map(function (e) { return e.v; });
+		},
+		zip: function (ctx, args) {
+			expectArgs("zip", args, 2);
+			var a = arg("zip", args, 0, "list"), b = arg("zip", args, 1, "list");
+			var pairs = [];
+			for (var i = 0; i < a.length && i < b.length; i++) {
+				pairs.push(new Tuple([a[i], b[i]]));
+			}
+			return pairs;
+		},
+		enumerate: function (ctx, args) {
+			expectArgs("enumerate", args, 1);
+			return arg("enumerate", args, 0, "list").map(function (v, i) { return new Tuple([BigInt(i), v]); });
+		},
+		range: function (ctx, args) {
+			expectArgRange("range", args, 1, 3);
+			var bounds = [0n, 0n, 1n];
+			for (var i = 0; i < args.length; i++) {
+				bounds[i] = arg("range", args, i, "int");
+			}
+			if (args.length === 1) {
+				bounds = [0n, bounds[0], 1n];
+			}
+			var start = bounds[0], end = bounds[1], step = bounds[2];
+			if (step === 0n) {
+				fail("range: step must not be 0");
+			}
+			var nums = [];
+			for (var n = start; (step > 0n && n < end) || (step < 0n && n > end); n += step) {
+				nums.push(n);
+			}
+			return nums;
+		},
+		min: aggregate("min", function (a, b) {
+			if (isInt(a) && isInt(b)) { return b < a ? b : a; }
+			return Math.min(Number(a), Number(b));
+		}),
+		max: aggregate("max", function (a, b) {
+			if (isInt(a) && isInt(b)) { return b > a ? b : a; }
+			return Math.max(Number(a), Number(b));
+		}),
+		sum: aggregate("sum", function (a, b) {
+			return operate("+", a, b);
+		}),
+		abs: function (ctx, args) {
+			expectArgs("abs", args, 1);
+			var v = args[0];
+			if (isInt(v)) { return v < 0n ? wrap(-v) : v; }
+			if (isFloat(v)) { return Math.abs(v); }
+			fail("abs: argument 1 must be a number, received " + typeName(v));
+		},
+		assert: function (ctx, args) {
+			expectArgRange("assert", args, 1, 2);
+			if (truthy(args[0])) { return true; }
+			if (args.length === 1) { fail("assertion failed"); }
+			fail("assertion failed: " + arg("assert", args, 1, "string"));
+		},
+		assert_eq: function (ctx, args) {
+			expectArgs("assert_eq", args, 2);
+			if (!equal(args[0], args[1])) {
+				fail("assertion failed: " + typeName(args[0]) + " " + formatValue(args[0]) + " != " + typeName(args[1]) + " " + formatValue(args[1]));
+			}
+			return true;
+		},
+		error: function (ctx, args) {
+			if (args.length === 0) {
+				fail("error: requires a message");
+			}
+			// without format, the message cannot take arguments.
+			expectArgs("error", args, 1);
+			fail(arg("error", args, 0, "string"));
+		}
+	};
+
+	// fromJS converts a JS value to a script value: whole numbers become ints,
+	// objects become maps, and arrays lists.
+	function fromJS(v) {
+		if (v === undefined || v === null) { return null; }
+		if (typeof v === "number") { return Number.isInteger(v) ? BigInt(v) : v; }
+		if (Array.isArray(v)) { return v.map(fromJS); }
+		if (v instanceof Map || v instanceof Tuple || v instanceof RegExp || isFn(v)) { return v; }
+		if (typeof v === "object") {
+			var m = new Map();
+			Object.keys(v).forEach(function (k) { m.set(k, fromJS(v[k])); });
+			return m;
+		}
+		return v;
+	}
+
+	// toJS converts a script value to a JS value, as values.ToGo does to a
+	// Go value: ints become numbers, maps objects, the (true, value) tuple of
+	// a block its value, and other tuples arrays.
+	function toJS(v) {
+		if (isInt(v)) { return Number(v); }
+		if (Array.isArray(v)) { return v.map(toJS); }
+		if (v instanceof Tuple) {
+			if (v.values.length === 2 && v.values[0] === true) {
+				return toJS(v.values[1]);
+			}
+			return v.values.map(toJS);
+		}
+		if (v instanceof Map) {
+			var o = {};
+			v.forEach(function (e, k) { o[k] = toJS(e); });
+			return o;
+		}
+		return v;
+	}
+
+	// run runs a program, with the vars assigned in a child of a new top
+	// context, as Program.Run does.
+	function run(program, vars, args) {
+		var top = new Ctx(null);
+		Object.keys(builtins).forEach(function (name) { top.set(name, builtins[name]); });
+		top.set("args", (args || []).map(String));
+
+		var ctx = new Ctx(top);
+		Object.keys(vars || {}).forEach(function (name) { ctx.set(name, fromJS(vars[name])); });
+
+		var res = program(ctx);
+		if (res instanceof Flow) {
+			if (res.type !== RETURN) {
+				fail("FuncApply received non-return flow control change");
+			}
+			res = res.value;
+		}
+		return toJS(res);
+	}
+
+	return {
+		Flow: Flow, RETURN: RETURN, BREAK: BREAK, CONTINUE: CONTINUE,
+		block: block, fn: fn, call: call, and: and, or: or, loop: loop,
+		member: member, op: op, typeName: typeName, run: run
+	};
+})();
+`
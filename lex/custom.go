@@ -0,0 +1,178 @@
+package lex
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// custom holds the operators added with RegisterOperator, and the keywords
+// added with RegisterKeyword, their new types numbered from TypeCount.
+var custom = struct {
+	sync.RWMutex
+	bySymbol map[string]Type
+	keywords map[string]Type
+	symbols  map[Type]string
+	next     Type
+}{
+	bySymbol: make(map[string]Type),
+	keywords: make(map[string]Type),
+	symbols:  make(map[Type]string),
+	next:     TypeCount,
+}
+
+// RegisterOperator adds an operator of one or two runes, e.g. "~=", to the
+// lexer, and returns its Type, whose name is the symbol. Where the lexer
+// could read either, a two rune operator is preferred to one rune. The
+// symbol must not already be an operator, and must not start with a rune
+// that starts another kind of item, e.g. a letter, digit, quote, #, or /.
+// Operators should be registered before any input is lexed, e.g. in an init
+// function.
+func RegisterOperator(symbol string) (Type, error) {
+
+	runes := []rune(symbol)
+	if len(runes) < 1 || len(runes) > 2 {
+		return Error, fmt.Errorf("operator %q must have one or two runes", symbol)
+	}
+
+	r := runes[0]
+	if isLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune("\"'`#/", r) {
+		return Error, fmt.Errorf("operator %q cannot start with %q", symbol, r)
+	}
+
+	if builtinOperator(runes) {
+		return Error, fmt.Errorf("operator %q already exists", symbol)
+	}
+
+	custom.Lock()
+	defer custom.Unlock()
+
+	if _, ok := custom.bySymbol[symbol]; ok {
+		return Error, fmt.Errorf("operator %q already exists", symbol)
+	}
+
+	t := custom.next
+	custom.next++
+	custom.bySymbol[symbol] = t
+	custom.symbols[t] = symbol
+
+	return t, nil
+}
+
+// RegisterKeyword adds a word to the lexer as a keyword, rather than an
+// identifier, e.g. for a DSL. The keyword is of the Type t, e.g. Function,
+// for "func" to write fn literals, or, if t is Nada, of a new Type, whose
+// name is the word, which it returns, e.g. for `rule`, or `when`, which the
+// parser may gather as an operator registered with parser.RegisterOperator.
+// The word must be an identifier, and must not already be a keyword.
+// Keywords should be registered before any input is lexed, e.g. in an init
+// function.
+func RegisterKeyword(word string, t Type) (Type, error) {
+
+	if word == "" {
+		return Error, fmt.Errorf("keyword must not be empty")
+	}
+	for i, r := range word {
+		if !isLetter(r) && (i == 0 || !isDigit(r)) {
+			return Error, fmt.Errorf("keyword %q must be an identifier", word)
+		}
+	}
+
+	if _, ok := keywords[word]; ok {
+		return Error, fmt.Errorf("keyword %q already exists", word)
+	}
+
+	custom.Lock()
+	defer custom.Unlock()
+
+	if _, ok := custom.keywords[word]; ok {
+		return Error, fmt.Errorf("keyword %q already exists", word)
+	}
+
+	switch {
+	case t == Nada:
+		t = custom.next
+		custom.next++
+		custom.symbols[t] = word
+	case t == EOF || t == Error || t >= custom.next:
+		return Error, fmt.Errorf("keyword %q cannot be of type %v", word, t)
+	}
+
+	custom.keywords[word] = t
+
+	return t, nil
+}
+
+// customKeyword returns the Type of a registered keyword.
+func customKeyword(word string) (Type, bool) {
+
+	custom.RLock()
+	defer custom.RUnlock()
+
+	t, ok := custom.keywords[word]
+	return t, ok
+}
+
+// builtinOperator checks if the runes are one of the operators of the lexer.
+func builtinOperator(runes []rune) bool {
+	if len(runes) == 1 {
+		return singleRuneOperator(runes[0]) != Error
+	}
+	return doubleRuneOperator(runes[0], runes[1]) != Error
+}
+
+// customOperator returns the registered operator of two runes, if any, or
+// else of the first rune, and the number of runes it has.
+func customOperator(r1, r2 rune) (Type, int) {
+
+	custom.RLock()
+	defer custom.RUnlock()
+
+	if len(custom.bySymbol) == 0 {
+		return Error, 0
+	}
+
+	if r2 != eof {
+		if t, ok := custom.bySymbol[string([]rune{r1, r2})]; ok {
+			return t, 2
+		}
+	}
+
+	if t, ok := custom.bySymbol[string(r1)]; ok {
+		return t, 1
+	}
+
+	return Error, 0
+}
+
+// customSymbol returns the symbol of a registered operator.
+func customSymbol(t Type) (string, bool) {
+
+	custom.RLock()
+	defer custom.RUnlock()
+
+	s, ok := custom.symbols[t]
+	return s, ok
+}
+
+// TypeNamed returns the Type with a name, as returned by String, including
+// those of registered operators, and keywords.
+func TypeNamed(name string) (Type, bool) {
+
+	for t := Type(0); t < TypeCount; t++ {
+		if t.String() == name {
+			return t, true
+		}
+	}
+
+	custom.RLock()
+	defer custom.RUnlock()
+
+	if t, ok := custom.bySymbol[name]; ok {
+		return t, true
+	}
+
+	t, ok := custom.keywords[name]
+	return t, ok && t >= TypeCount && custom.symbols[t] == name
+}
@@ -3,22 +3,35 @@ package lex
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pdk/meh/diag"
 )
 
-// Item is produced by a lexer.
+// Item is produced by a lexer. Its position is that of its first rune, and
+// EndLine and EndColumn are those of its last, as columns are counted, with
+// tabs to the next tab stop. Offset and Length are its bytes in the input,
+// e.g. for a formatter to replace it.
 type Item struct {
 	*Lexer
 	Type
-	Value  string
-	Line   int
-	Column int
-	error  // perhaps there was a problem
+	Value     string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Offset    int
+	Length    int
+	error     // perhaps there was a problem
 }
 
-// ItemError composes an Item with an error.
+// ItemError composes an Item with an error, and the span of the source it
+// concerns, if it is more than the item.
 type ItemError struct {
 	item *Item
 	err  error
+	span Span
 }
 
 // Unwrap allows unwrapping an ItemError.
@@ -48,6 +61,119 @@ func (i *Item) Error(err error) ItemError {
 	}
 }
 
+// ErrorIn composes an Item with an error that concerns a span of the source
+// around it, e.g. the expression the item is the operator of. The error is
+// reported at the item, and its Diagnostic spans the span, unless the span
+// is empty.
+func (i *Item) ErrorIn(err error, span Span) ItemError {
+	return ItemError{
+		item: i,
+		err:  err,
+		span: span,
+	}
+}
+
+// Diagnostic describes the error as a Diagnostic spanning the item, or the
+// span the error concerns.
+func (ierr ItemError) Diagnostic(code diag.Code) diag.Diagnostic {
+
+	d := ierr.item.Diagnose(code, ierr.err)
+	if ierr.span.Line > 0 {
+		d.Line, d.Column = ierr.span.Line, ierr.span.Column
+		d.EndLine, d.EndColumn = ierr.span.EndLine, ierr.span.EndColumn
+	}
+
+	return d
+}
+
+// Span is a range of the source, from the first rune of an item to the last
+// rune of the same or a later one, e.g. of an expression, as positions are
+// counted, with the bytes from Offset up to EndOffset. A span with no Line is
+// empty.
+type Span struct {
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Offset    int
+	EndOffset int
+}
+
+// Span returns the span of the item.
+func (i Item) Span() Span {
+
+	endLine, endCol := i.End()
+
+	return Span{
+		Line:      i.Line,
+		Column:    i.Column,
+		EndLine:   endLine,
+		EndColumn: endCol,
+		Offset:    i.Offset,
+		EndOffset: i.Offset + i.Length,
+	}
+}
+
+// Join returns the span from the start of the first of two spans to the end
+// of the last.
+func (s Span) Join(other Span) Span {
+
+	switch {
+	case other.Line == 0:
+		return s
+	case s.Line == 0:
+		return other
+	}
+
+	if other.Line < s.Line || (other.Line == s.Line && other.Column < s.Column) {
+		s.Line, s.Column, s.Offset = other.Line, other.Column, other.Offset
+	}
+	if other.EndLine > s.EndLine || (other.EndLine == s.EndLine && other.EndColumn > s.EndColumn) {
+		s.EndLine, s.EndColumn, s.EndOffset = other.EndLine, other.EndColumn, other.EndOffset
+	}
+
+	return s
+}
+
+// End returns the line and column of the last rune of the item: EndLine and
+// EndColumn, if the lexer set them, or counted from its value, e.g. for an
+// item restored from a compiled program.
+func (i Item) End() (int, int) {
+
+	if i.EndLine > 0 {
+		return i.EndLine, i.EndColumn
+	}
+
+	// the last rune follows everything before it, which may end a line,
+	// e.g. a separator or comment ending in a newline.
+	_, size := utf8.DecodeLastRuneInString(i.Value)
+	before := i.Value[:len(i.Value)-size]
+
+	nl := strings.LastIndex(before, "\n")
+	if nl < 0 {
+		return i.Line, i.Column + utf8.RuneCountInString(before)
+	}
+
+	return i.Line + strings.Count(before, "\n"), utf8.RuneCountInString(before[nl+1:]) + 1
+}
+
+// Diagnose describes an error found at the item as a Diagnostic.
+func (i Item) Diagnose(code diag.Code, err error) diag.Diagnostic {
+
+	endLine, endCol := i.End()
+
+	return diag.Diagnostic{
+		File:      i.Name(),
+		Line:      i.Line,
+		Column:    i.Column,
+		EndLine:   endLine,
+		EndColumn: endCol,
+		Severity:  diag.Error,
+		Code:      code,
+		Message:   err.Error(),
+	}
+}
+
 // func (i Item) String() string {
 // 	return fmt.Sprintf("[%s %s]", i.Type, i.Value)
 // }
@@ -93,6 +219,8 @@ const (
 	Break
 	Function
 	FuncApply
+	Do
+	Until
 	// expr separator
 	Separator
 	// identifiers
@@ -102,6 +230,7 @@ const (
 	DoubleQuoteString
 	SingleQuoteString
 	BacktickString
+	Regex
 	// comments
 	HashComment
 	SlashComment
@@ -134,8 +263,12 @@ const (
 	MultAssign
 	DivAssign
 	ModuloAssign
+	Increment
+	Decrement
 	Or
 	And
+	Is
+	Colon
 	// max number of Item Types
 	TypeCount
 )
@@ -165,6 +298,10 @@ func (t Type) String() string {
 		return "Function"
 	case FuncApply:
 		return "FuncApply"
+	case Do:
+		return "Do"
+	case Until:
+		return "Until"
 	case Return:
 		return "Return"
 	case Separator:
@@ -177,6 +314,8 @@ func (t Type) String() string {
 		return "SingleQuoteString"
 	case BacktickString:
 		return "BacktickString"
+	case Regex:
+		return "Regex"
 	case HashComment:
 		return "HashComment"
 	case SlashComment:
@@ -229,12 +368,24 @@ func (t Type) String() string {
 		return "DivAssign"
 	case ModuloAssign:
 		return "ModuloAssign"
+	case Increment:
+		return "Increment"
+	case Decrement:
+		return "Decrement"
 	case LessOrEqual:
 		return "LessOrEqual"
 	case Or:
 		return "Or"
 	case And:
 		return "And"
+	case Is:
+		return "Is"
+	case Colon:
+		return "Colon"
+	}
+
+	if symbol, ok := customSymbol(t); ok {
+		return symbol
 	}
 
 	return "unknown"
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"sort"
+	"sync"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/pdk/meh/diag"
 )
 
 const (
@@ -20,11 +23,22 @@ type Lexer struct {
 	input        io.Reader
 	scanner      *bufio.Scanner
 	backupBuffer chan fetch
-	current      strings.Builder
+	current      []byte
+	interned     map[string]string
 	curLine      int
 	curCol       int
-	items        chan Item
+	offset       int
+	lastRune     rune
+	state        stateFunc
+	pending      []Item
+	head         int
+	end          *Item
 	lastItem     Item
+	opens        []Type // the parens and braces open, innermost last
+	rules        SeparatorRules
+
+	diagMu      sync.Mutex
+	diagnostics diag.List
 }
 
 type fetch struct {
@@ -40,24 +54,135 @@ func (l *Lexer) Name() string {
 	return l.name
 }
 
-// New creates a new lexer.
-func New(name string, input io.Reader) (*Lexer, chan Item) {
+// Report records a problem found in the input of the lexer, by the lexer or
+// by a later stage, e.g. the parser. A problem already reported is ignored.
+func (l *Lexer) Report(d diag.Diagnostic) {
+	if l == nil {
+		return
+	}
+
+	l.diagMu.Lock()
+	defer l.diagMu.Unlock()
+
+	for _, prior := range l.diagnostics {
+		if prior == d {
+			return
+		}
+	}
+
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// Diagnostics returns the problems reported for the input of the lexer.
+func (l *Lexer) Diagnostics() diag.List {
+	if l == nil {
+		return nil
+	}
+
+	l.diagMu.Lock()
+	defer l.diagMu.Unlock()
+
+	return append(diag.List{}, l.diagnostics...)
+}
+
+// Source returns a lexer that produces no items, for items restored from
+// elsewhere, e.g. a compiled program, that need the name of their input.
+func Source(name string) *Lexer {
+	return &Lexer{name: name}
+}
+
+// NewLexer returns a lexer of an input, whose items are read with Next, as
+// they are needed, e.g.
+//
+//	l := lex.NewLexer("rules.meh", input)
+//	for item := l.Next(); item.Type != lex.EOF; item = l.Next() {
+//		...
+//	}
+func NewLexer(name string, input io.Reader) *Lexer {
 	s := bufio.NewScanner(input)
 	s.Split(bufio.ScanRunes)
 
-	l := &Lexer{
+	return &Lexer{
 		name:         name,
 		input:        input,
 		scanner:      s,
 		backupBuffer: make(chan fetch, 2),
-		items:        make(chan Item),
+		state:        shebang,
+		rules:        DefaultSeparatorRules(),
 		curLine:      1,
 		curCol:       1,
 	}
+}
 
-	go l.run()
+// New creates a new lexer, which sends its items down a channel from a
+// goroutine of its own, closing it after the EOF item. The channel must be
+// read to the end, or the goroutine is left blocked; NewLexer's Next reads
+// the items without one.
+func New(name string, input io.Reader) (*Lexer, chan Item) {
+	l := NewLexer(name, input)
+	items := make(chan Item)
+
+	go func() {
+		defer close(items)
 
-	return l, l.items
+		for {
+			i := l.Next()
+			items <- i
+			if i.Type == EOF {
+				return
+			}
+		}
+	}()
+
+	return l, items
+}
+
+// Next returns the next item of the input, lexing as much of the input as
+// it needs. At the end of the input it returns an EOF item, and again on
+// each later call.
+func (l *Lexer) Next() Item {
+	if !l.fill() {
+		return *l.end
+	}
+
+	i := l.pending[l.head]
+	l.head++
+	if l.head == len(l.pending) {
+		l.pending, l.head = l.pending[:0], 0
+	}
+
+	return i
+}
+
+// Peek returns the item Next will return, without consuming it.
+func (l *Lexer) Peek() Item {
+	if !l.fill() {
+		return *l.end
+	}
+
+	return l.pending[l.head]
+}
+
+// fill runs the lexer until it has emitted an item that has not been read,
+// and returns false if there are none left.
+func (l *Lexer) fill() bool {
+
+	for l.head == len(l.pending) {
+		if l.end != nil {
+			return false
+		}
+
+		if l.state == nil {
+			l.emit(EOF)
+			end := l.pending[len(l.pending)-1]
+			l.end = &end
+			continue
+		}
+
+		l.state = l.state(l)
+	}
+
+	return true
 }
 
 const eof = -1
@@ -89,82 +214,164 @@ func (l *Lexer) peek() rune {
 	return n
 }
 
-// run consumes input to produce items.
-func (l *Lexer) run() {
-	defer func() {
-		// log.Printf("lexer closing")
-		close(l.items)
-	}()
+// advancePos moves the position past the text of an item, or of space, and
+// returns the line and column of its last rune.
+func (l *Lexer) advancePos(s []byte) (int, int) {
+	// log.Printf("advancing: %q", s)
+	endLine, endCol := l.curLine, l.curCol
+	l.offset += len(s)
+
+	// \r\n ends one line, even if an item, e.g. a comment, takes the \r.
+	for _, r := range string(s) {
+		switch {
+		case r == '\n' && l.lastRune == '\r':
+		case r == '\n' || r == '\r':
+			endLine, endCol = l.curLine, l.curCol
+			l.curLine++
+			l.curCol = 1
+		default:
+			endLine, endCol = l.curLine, l.curCol
+			l.curCol = nextColumn(l.curCol, r)
+		}
 
-	for state := cleanSlate; state != nil; {
-		state = state(l)
+		l.lastRune = r
 	}
 
-	l.emit(EOF)
+	return endLine, endCol
+}
 
-	// log.Printf("lexer run complete")
+// nextColumn returns the column after a rune, of a line, at a column.
+func nextColumn(col int, r rune) int {
+	if r == '\t' {
+		col++
+		col = col + (col % tabWidth)
+	}
+	return col + 1
 }
 
-func (l *Lexer) advancePos(s string) {
-	// log.Printf("advancing: %q", s)
-	var last rune
-	for _, r := range s {
-		if r == '\t' {
-			l.curCol++
-			l.curCol = l.curCol + (l.curCol % tabWidth)
-		}
+// Offset returns the byte offset in a line of the rune at a column, as the
+// lexer counts columns, e.g. to point at an Item in the line. It is the
+// length of the line if the line is shorter.
+func Offset(line string, column int) int {
 
-		if r == '\n' || (r == '\r' && last != '\n') {
-			l.curLine++
-			l.curCol = 0
+	col := 1
+	for i, r := range line {
+		if col >= column {
+			return i
 		}
-		l.curCol++
-
-		last = r
+		col = nextColumn(col, r)
 	}
+
+	return len(line)
 }
 
-// emit sends an Item down the channel.
+// emit adds an Item to those to be read.
 func (l *Lexer) emit(t Type) {
-	line, col, s := l.curLine, l.curCol, l.current.String()
-	l.advancePos(s)
-	l.current.Reset()
+	line, col, offset, s := l.curLine, l.curCol, l.offset, l.value(t)
+	endLine, endCol := l.advancePos(l.current)
+	l.current = l.current[:0]
 
 	i := Item{
-		Lexer:  l,
-		Type:   t,
-		Value:  s,
-		Line:   line,
-		Column: col,
+		Lexer:     l,
+		Type:      t,
+		Value:     s,
+		Line:      line,
+		Column:    col,
+		EndLine:   endLine,
+		EndColumn: endCol,
+		Offset:    offset,
+		Length:    len(s),
 	}
 
 	if i.Type != HashComment && i.Type != SlashComment {
 		l.lastItem = i
 	}
+	l.nest(t)
 
-	l.items <- i
+	l.pending = append(l.pending, i)
 }
 
 func (l *Lexer) emitError(err error) {
-	line, col, s := l.curLine, l.curCol, l.current.String()
-	l.advancePos(s)
-	l.current.Reset()
+	line, col, offset, s := l.curLine, l.curCol, l.offset, string(l.current)
+	endLine, endCol := l.advancePos(l.current)
+	l.current = l.current[:0]
 
 	var i Item
 	i = Item{
-		Lexer:  l,
-		Type:   Error,
-		Value:  s,
-		Line:   line,
-		Column: col,
-		error:  i.Error(err),
+		Lexer:     l,
+		Type:      Error,
+		Value:     s,
+		Line:      line,
+		Column:    col,
+		EndLine:   endLine,
+		EndColumn: endCol,
+		Offset:    offset,
+		Length:    len(s),
+		error:     i.Error(err),
 	}
 
-	l.items <- i
+	l.Report(i.Diagnose(diag.Lex, err))
+	l.lastItem = i
+	l.pending = append(l.pending, i)
 }
 
 func (l *Lexer) collect(r rune) {
-	l.current.WriteRune(r)
+	if 0 <= r && r < utf8.RuneSelf {
+		l.current = append(l.current, byte(r))
+		return
+	}
+
+	var b [utf8.UTFMax]byte
+	n := utf8.EncodeRune(b[:], r)
+	l.current = append(l.current, b[:n]...)
+}
+
+// internLimit is the length of the longest value, other than an identifier,
+// that is interned, e.g. a short string literal; longer ones are seldom
+// repeated.
+const internLimit = 32
+
+// value returns the value of the item being emitted, interned if it is an
+// identifier, or a short value of another type but a comment.
+func (l *Lexer) value(t Type) string {
+
+	switch {
+	case t == HashComment || t == SlashComment:
+		return string(l.current)
+	case t == Ident || len(l.current) <= internLimit:
+		return l.intern(l.current)
+	}
+
+	return string(l.current)
+}
+
+// Intern returns the lexer's copy of a value, making it if there is none, so
+// that each name, or other short value, of an input is allocated once, and
+// its copies, e.g. a name and the keys of the maps it is assigned in,
+// compare equal at a glance. Items restored from elsewhere, e.g. a compiled
+// program, are interned with the lexer of their input. As the lexing, it is
+// not safe for concurrent use.
+func (l *Lexer) Intern(s string) string {
+	if l == nil {
+		return s
+	}
+	return l.intern([]byte(s))
+}
+
+func (l *Lexer) intern(b []byte) string {
+
+	if s, ok := l.interned[string(b)]; ok {
+		return s
+	}
+
+	if l.interned == nil {
+		l.interned = make(map[string]string)
+	}
+
+	s := string(b)
+	l.interned[s] = s
+
+	return s
 }
 
 type stateFunc func(*Lexer) stateFunc
@@ -214,6 +421,14 @@ func cleanSlate(l *Lexer) stateFunc {
 		if p == '/' {
 			return slashComment
 		}
+		if !l.afterOperand() {
+			return regex
+		}
+	case '.':
+		// .5 is a number, but m.x, or f(x).y, is a member.
+		if isDecimal(p) && !l.afterOperand() {
+			return number
+		}
 	}
 
 	op := doubleRuneOperator(r, p)
@@ -230,6 +445,22 @@ func cleanSlate(l *Lexer) stateFunc {
 		return cleanSlate
 	}
 
+	op, n := customOperator(r, p)
+	if n == 2 {
+		r, err := l.next()
+		if err != nil {
+			l.emitError(fmt.Errorf("failed to scan double rune operator: %v", err))
+			return nil
+		}
+
+		l.collect(r)
+	}
+	if op != Error {
+		l.emit(op)
+
+		return cleanSlate
+	}
+
 	op = singleRuneOperator(r)
 	if op != Error {
 		l.emit(op)
@@ -260,22 +491,11 @@ func word(l *Lexer) stateFunc {
 
 		l.backup(r, nil)
 
-		switch l.current.String() {
-		case "nil":
-			l.emit(Nil)
-		case "fn":
-			l.emit(Function)
-		case "true":
-			l.emit(True)
-		case "false":
-			l.emit(False)
-		case "return":
-			l.emit(Return)
-		case "continue":
-			l.emit(Continue)
-		case "break":
-			l.emit(Break)
-		default:
+		if t, ok := keywords[string(l.current)]; ok {
+			l.emit(t)
+		} else if t, ok := customKeyword(string(l.current)); ok {
+			l.emit(t)
+		} else {
 			l.emit(Ident)
 		}
 
@@ -283,19 +503,26 @@ func word(l *Lexer) stateFunc {
 	}
 }
 
+// number scans a number, with a point before, among, or after its digits,
+// e.g. .5, 1.5, or 5.
 func number(l *Lexer) stateFunc {
-	gotPoint := false
+	gotPoint := l.current[0] == '.'
 
 	for {
 		r, err := l.next()
-		if err != nil || isLetter(r) {
+		if err != nil {
 			l.emitError(fmt.Errorf("failed to scan number: %v", err))
 			return nil
 		}
 
+		if isLetter(r) {
+			l.collect(r)
+			return invalidNumber
+		}
+
 		if ('0' <= r && r <= '9') || (r == '.' && !gotPoint) {
 			l.collect(r)
-			gotPoint = r == '.'
+			gotPoint = gotPoint || r == '.'
 			continue
 		}
 
@@ -307,20 +534,37 @@ func number(l *Lexer) stateFunc {
 	}
 }
 
-func (l *Lexer) maybeEmitSeparator(r rune) {
-	switch r {
-	case '\n', '\r', '\v', '\f':
-		switch l.lastItem.Type {
-		case Ident, Number, DoubleQuoteString,
-			SingleQuoteString, BacktickString,
-			RightParen,
-			RightBrace: // unclear if RightBrace should be here
+// invalidNumber scans the rest of a number run into a word, e.g. 12abc, and
+// reports it, lexing on after it.
+func invalidNumber(l *Lexer) stateFunc {
+	for {
+		r, err := l.next()
+		if err != nil {
+			l.emitError(fmt.Errorf("failed to scan number: %v", err))
+			return nil
+		}
 
-			l.emit(Separator)
+		if isLetter(r) || isDigit(r) {
+			l.collect(r)
+			continue
 		}
+
+		l.backup(r, nil)
+		l.emitError(fmt.Errorf("invalid number literal %q", l.current))
+
+		return cleanSlate
 	}
 }
 
+// afterOperand checks if the last item could be the end of an operand, in
+// which case a following / is division rather than the start of a regex.
+func (l *Lexer) afterOperand() bool {
+	return l.lastItem.Type.Match(Ident, Number,
+		DoubleQuoteString, SingleQuoteString, BacktickString, Regex,
+		Nil, True, False,
+		RightParen, RightBrace)
+}
+
 func whitespace(l *Lexer) stateFunc {
 	for {
 		n, err := l.next()
@@ -337,14 +581,49 @@ func whitespace(l *Lexer) stateFunc {
 		}
 
 		// count how much space we ate
-		l.advancePos(l.current.String())
-		l.current.Reset()
+		l.advancePos(l.current)
+		l.current = l.current[:0]
 
 		l.backup(n, nil)
 		return cleanSlate
 	}
 }
 
+// shebang skips a first line starting with #!, e.g. #!/usr/bin/env meh, so
+// that a script can be run as a command. It produces no items.
+func shebang(l *Lexer) stateFunc {
+
+	r, err := l.next()
+	if r != '#' {
+		l.backup(r, err)
+		return cleanSlate
+	}
+
+	n, err := l.next()
+	if n != '!' {
+		l.backup(r, nil)
+		l.backup(n, err)
+		return cleanSlate
+	}
+
+	// the line is counted as space.
+	l.collect(r)
+	for n != '\n' && n != eof {
+		l.collect(n)
+		if n, err = l.next(); err != nil {
+			l.emitError(fmt.Errorf("failed to scan within #! line: %v", err))
+			return nil
+		}
+	}
+	if n == '\n' {
+		l.collect(n)
+	}
+
+	l.advancePos(l.current)
+	l.current = l.current[:0]
+	return cleanSlate
+}
+
 // hashComment reads until the end of the line.
 func hashComment(l *Lexer) stateFunc {
 	for {
@@ -354,10 +633,15 @@ func hashComment(l *Lexer) stateFunc {
 			return nil
 		}
 
-		l.collect(n)
+		if n != eof {
+			l.collect(n)
+		}
 
 		if n == '\n' || n == '\r' || n == eof {
 			l.emit(HashComment)
+			// the comment takes the line ending, which may end a
+			// statement.
+			l.maybeEmitSeparator(n)
 			return cleanSlate
 		}
 	}
@@ -372,10 +656,15 @@ func slashComment(l *Lexer) stateFunc {
 			return nil
 		}
 
-		l.collect(n)
+		if n != eof {
+			l.collect(n)
+		}
 
 		if n == '\n' || n == '\r' || n == eof {
 			l.emit(SlashComment)
+			// the comment takes the line ending, which may end a
+			// statement.
+			l.maybeEmitSeparator(n)
 			return cleanSlate
 		}
 	}
@@ -475,8 +764,97 @@ func backtickString(l *Lexer) stateFunc {
 	}
 }
 
+// regex scans a slash delimited regular expression, followed by any flags,
+// e.g. /^a.*b$/i
+func regex(l *Lexer) stateFunc {
+	for {
+		n, err := l.next()
+		if err != nil {
+			l.emitError(fmt.Errorf("failed to scan within regex: %v", err))
+			return nil
+		}
+
+		if n == '\n' || n == '\r' || n == eof {
+			l.emitError(errors.New("unclosed regex"))
+			return nil
+		}
+
+		l.collect(n)
+
+		if n == '\\' {
+			n, err := l.next()
+			if err != nil {
+				l.emitError(fmt.Errorf("failed to scan within regex: %v", err))
+				return nil
+			}
+
+			l.collect(n)
+			continue
+		}
+
+		if n == '/' {
+			break
+		}
+	}
+
+	for {
+		n, err := l.next()
+		if err != nil {
+			l.emitError(fmt.Errorf("failed to scan regex flags: %v", err))
+			return nil
+		}
+
+		if !isLetter(n) {
+			l.backup(n, nil)
+			l.emit(Regex)
+			return cleanSlate
+		}
+
+		l.collect(n)
+	}
+}
+
 // below copied from https://golang.org/src/go/scanner/scanner.go
 
+// keywords are the words that are not identifiers.
+var keywords = map[string]Type{
+	"nil":      Nil,
+	"fn":       Function,
+	"true":     True,
+	"false":    False,
+	"return":   Return,
+	"continue": Continue,
+	"break":    Break,
+	"is":       Is,
+	"do":       Do,
+	"until":    Until,
+}
+
+// Keywords returns the sorted words that are not identifiers, including
+// those registered with RegisterKeyword, e.g. for completion in an editor.
+func Keywords() []string {
+
+	words := make([]string, 0, len(keywords))
+	for w := range keywords {
+		words = append(words, w)
+	}
+
+	custom.RLock()
+	for w := range custom.keywords {
+		words = append(words, w)
+	}
+	custom.RUnlock()
+
+	sort.Strings(words)
+
+	return words
+}
+
+// IsIdentRune checks if a rune may be part of an identifier.
+func IsIdentRune(ch rune) bool {
+	return isLetter(ch) || isDigit(ch)
+}
+
 func isLetter(ch rune) bool {
 	return 'a' <= lower(ch) && lower(ch) <= 'z' || ch == '_' || ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
@@ -0,0 +1,139 @@
+package lex
+
+import (
+	"strings"
+	"testing"
+)
+
+// lexAll returns the items of a source, less the EOF.
+func lexAll(src string) ([]Item, *Lexer) {
+
+	l := NewLexer("test.meh", strings.NewReader(src))
+
+	items := []Item{}
+	for i := l.Next(); i.Type != EOF; i = l.Next() {
+		items = append(items, i)
+	}
+
+	return items, l
+}
+
+func TestItemPositions(t *testing.T) {
+
+	type pos struct {
+		value                                   string
+		line, col, endLine, endCol, off, length int
+	}
+
+	items, _ := lexAll("x = \"héllo\"\n  y2 += 1.5\n`a\nbc` + 1")
+
+	want := []pos{
+		{"x", 1, 1, 1, 1, 0, 1},
+		{"=", 1, 3, 1, 3, 2, 1},
+		{`"héllo"`, 1, 5, 1, 11, 4, 8},
+		{"\n", 1, 12, 1, 12, 12, 1},
+		{"y2", 2, 3, 2, 4, 15, 2},
+		{"+=", 2, 6, 2, 7, 18, 2},
+		{"1.5", 2, 9, 2, 11, 21, 3},
+		{"\n", 2, 12, 2, 12, 24, 1},
+		{"`a\nbc`", 3, 1, 4, 3, 25, 6},
+		{"+", 4, 5, 4, 5, 32, 1},
+		{"1", 4, 7, 4, 7, 34, 1},
+	}
+
+	if len(items) != len(want) {
+		t.Fatalf("lexed %d items, want %d: %v", len(items), len(want), items)
+	}
+
+	for i, w := range want {
+		it := items[i]
+		got := pos{it.Value, it.Line, it.Column, it.EndLine, it.EndColumn, it.Offset, it.Length}
+		if got != w {
+			t.Errorf("item %d: %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestItemEndFromValue(t *testing.T) {
+
+	for _, c := range []struct {
+		item      Item
+		line, col int
+	}{
+		{Item{Value: "x", Line: 2, Column: 4}, 2, 4},
+		{Item{Value: "héllo", Line: 1, Column: 3}, 1, 7},
+		{Item{Value: "`a\nbc`", Line: 3, Column: 1}, 4, 3},
+		{Item{Value: "# c\n", Line: 1, Column: 5}, 1, 8},
+	} {
+		if line, col := c.item.End(); line != c.line || col != c.col {
+			t.Errorf("%q at %d:%d ends %d:%d, want %d:%d", c.item.Value, c.item.Line, c.item.Column, line, col, c.line, c.col)
+		}
+	}
+}
+
+// typesAndValues returns the type and value of each item of a source, e.g.
+// "Number .5".
+func typesAndValues(src string) []string {
+
+	items, _ := lexAll(src)
+
+	got := []string{}
+	for _, i := range items {
+		got = append(got, i.Type.String()+" "+i.Value)
+	}
+
+	return got
+}
+
+func TestDotFloats(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		want []string
+	}{
+		{".5", []string{"Number .5"}},
+		{"5.", []string{"Number 5."}},
+		{"5.25", []string{"Number 5.25"}},
+		{".5 + 5.", []string{"Number .5", "Plus +", "Number 5."}},
+		{"x.y", []string{"Ident x", "Dot .", "Ident y"}},
+		{"x.5", []string{"Ident x", "Dot .", "Number 5"}},
+		{"f(.5)", []string{"Ident f", "LeftParen (", "Number .5", "RightParen )"}},
+		{"1.5.x", []string{"Number 1.5", "Dot .", "Ident x"}},
+	} {
+		got := typesAndValues(c.src)
+		if strings.Join(got, ", ") != strings.Join(c.want, ", ") {
+			t.Errorf("%q: lexed %q, want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestNumberRunIntoWord(t *testing.T) {
+
+	for _, c := range []struct {
+		src   string
+		want  []string
+		diags []string
+	}{
+		{"1x + 2", []string{"Error 1x", "Plus +", "Number 2"},
+			[]string{`test.meh:1:1: error: invalid number literal "1x" [lex]`}},
+		{"a = 3abc\nb = 4", []string{"Ident a", "Assign =", "Error 3abc", "Separator \n", "Ident b", "Assign =", "Number 4"},
+			[]string{`test.meh:1:5: error: invalid number literal "3abc" [lex]`}},
+		{"1.e 0x1", []string{"Error 1.e", "Error 0x1"},
+			[]string{`test.meh:1:1: error: invalid number literal "1.e" [lex]`, `test.meh:1:5: error: invalid number literal "0x1" [lex]`}},
+		{"12 x", []string{"Number 12", "Ident x"}, nil},
+	} {
+		got := typesAndValues(c.src)
+		if strings.Join(got, ", ") != strings.Join(c.want, ", ") {
+			t.Errorf("%q: lexed %q, want %q", c.src, got, c.want)
+		}
+
+		_, l := lexAll(c.src)
+		diags := []string{}
+		for _, d := range l.Diagnostics() {
+			diags = append(diags, d.Error())
+		}
+		if strings.Join(diags, "\n") != strings.Join(c.diags, "\n") {
+			t.Errorf("%q: diagnostics %q, want %q", c.src, diags, c.diags)
+		}
+	}
+}
@@ -26,6 +26,8 @@ func singleRuneOperator(r rune) Type {
 		return Dot
 	case '=':
 		return Assign
+	case ':':
+		return Colon
 	case '(':
 		return LeftParen
 	case ')':
@@ -72,6 +74,14 @@ func doubleRuneOperator(r1, r2 rune) Type {
 		}
 	}
 
+	if r1 == '+' && r2 == '+' {
+		return Increment
+	}
+
+	if r1 == '-' && r2 == '-' {
+		return Decrement
+	}
+
 	if r1 == '|' && r2 == '|' {
 		return Or
 	}
@@ -0,0 +1,122 @@
+package lex
+
+import (
+	"strings"
+)
+
+// SeparatorRules are the rules of where a line break ends a statement, as
+// a `;` does. A line break the rules do not end a statement at continues
+// it on the next line.
+type SeparatorRules struct {
+	// After are the types of the items that a line break after ends a
+	// statement, e.g. names and literals, but not operators, so that an
+	// expression continues on the next line after a trailing operator.
+	After []Type
+
+	// InParens makes a line break in parens end a statement, as it does in
+	// braces, e.g. in the body of a fn literal passed to a call, rather
+	// than continue it, so that the arguments of a call may be on several
+	// lines.
+	InParens bool
+}
+
+// DefaultSeparatorRules returns the rules of meh: a line break ends a
+// statement after an operand, a keyword that may end one, or a close, and
+// not in parens.
+func DefaultSeparatorRules() SeparatorRules {
+	return SeparatorRules{
+		After: []Type{
+			Ident, Number, DoubleQuoteString,
+			SingleQuoteString, BacktickString, Regex,
+			Nil, True, False, Function,
+			Return, Break, Continue,
+			Increment, Decrement,
+			RightParen, RightBrace,
+		},
+	}
+}
+
+// SetSeparatorRules sets the rules of where a line break ends a statement,
+// e.g. for a language embedding meh whose blocks continue after a close
+// brace. The rules should be set before the first item is read.
+func (l *Lexer) SetSeparatorRules(rules SeparatorRules) {
+	l.rules = rules
+}
+
+// ends checks if a line break after an item of the type ends a statement,
+// outside parens.
+func (r SeparatorRules) ends(t Type) bool {
+	return t.Match(r.After...)
+}
+
+// maybeEmitSeparator emits a Separator for a line break that ends a
+// statement.
+func (l *Lexer) maybeEmitSeparator(r rune) {
+	if l.inParens() && !l.rules.InParens {
+		return
+	}
+
+	// a line break after an error ends its statement too, so that the
+	// parse of the next line is not lost with it.
+	switch r {
+	case '\n', '\r', '\v', '\f':
+		if l.rules.ends(l.lastItem.Type) || l.lastItem.Type == Error {
+			l.emit(Separator)
+		}
+	}
+}
+
+// nest keeps track of the parens and braces open. A close closes its open,
+// and any left open inside it, as the parser matches them; a close without
+// an open is left to the parser to report.
+func (l *Lexer) nest(t Type) {
+
+	var open Type
+	switch t {
+	case LeftParen, LeftBrace:
+		l.opens = append(l.opens, t)
+		return
+	case RightParen:
+		open = LeftParen
+	case RightBrace:
+		open = LeftBrace
+	default:
+		return
+	}
+
+	for i := len(l.opens) - 1; i >= 0; i-- {
+		if l.opens[i] == open {
+			l.opens = l.opens[:i]
+			return
+		}
+	}
+}
+
+// inParens checks if the innermost group open is a paren.
+func (l *Lexer) inParens() bool {
+	return len(l.opens) > 0 && l.opens[len(l.opens)-1] == LeftParen
+}
+
+// Complete reads the rest of the input, and checks if it is complete
+// statements, rather than the start of one that continues in more input,
+// e.g. for a REPL to decide whether to run the lines entered, or to read
+// another: every paren and brace is closed, no raw string is open, and the
+// last line ends a statement, as the separator rules decide. Input with any
+// other error is complete, so that the error is reported.
+func (l *Lexer) Complete() bool {
+
+	last := Separator
+	for item := l.Next(); item.Type != EOF; item = l.Next() {
+		switch item.Type {
+		case HashComment, SlashComment:
+			continue
+		case Error:
+			// the lexer stops at an error, which more input can only
+			// mend if it is an open raw string.
+			return !strings.HasPrefix(item.Value, "`")
+		}
+		last = item.Type
+	}
+
+	return len(l.opens) == 0 && (last == Separator || l.rules.ends(last))
+}
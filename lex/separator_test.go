@@ -0,0 +1,61 @@
+package lex
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineBreakEndsStatement(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		ends bool
+	}{
+		{"x\n", true},
+		{"1.5\n", true},
+		{"\"s\"\n", true},
+		{"nil\n", true},
+		{"true\n", true},
+		{"false\n", true},
+		{"fn\n", true},
+		{"return\n", true},
+		{"break\n", true},
+		{"continue\n", true},
+		{"x++\n", true},
+		{"f()\n", true},
+		{"{ x }\n", true},
+		{"x +\n", false},
+		{"x &&\n", false},
+		{"x =\n", false},
+		{"f(x,\n", false},
+		{"f(true\n", false},
+		{"x is\n", false},
+	} {
+		items, _ := lexAll(c.src)
+		last := items[len(items)-1]
+		if got := last.Type == Separator; got != c.ends {
+			t.Errorf("%q: line break ends statement %v, want %v: %v", c.src, got, c.ends, items)
+		}
+
+		complete := NewLexer("test.meh", strings.NewReader(c.src)).Complete()
+		if complete != c.ends {
+			t.Errorf("%q: complete %v, want %v", c.src, complete, c.ends)
+		}
+	}
+}
+
+func TestSeparatorRules(t *testing.T) {
+
+	l := NewLexer("test.meh", strings.NewReader("f(a\n)\n{ x }\ny\n"))
+	l.SetSeparatorRules(SeparatorRules{After: []Type{Ident}, InParens: true})
+
+	var types []string
+	for i := l.Next(); i.Type != EOF; i = l.Next() {
+		types = append(types, i.Type.String())
+	}
+
+	want := "Ident LeftParen Ident Separator RightParen LeftBrace Ident RightBrace Ident Separator"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("items %s, want %s", got, want)
+	}
+}
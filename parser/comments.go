@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"github.com/pdk/meh/lex"
+)
+
+// Comments are dropped as the input is parsed, unless the parser is set to
+// keep them, e.g. for a formatter, or a tool documenting functions. Each is
+// then attached to a node of the tree: a comment after a token on the same
+// line trails the token, and any other leads the token following it, where
+// separators and commas are not tokens, as they are not nodes of the tree. A
+// comment is then moved out to the largest node the token starts, or ends,
+// so that e.g.
+//
+//	# area is the area of a circle.
+//	area = fn(r) { 3.14 * r * r } # the radius may be negative
+//
+// leads and trails the assignment, rather than the names `area` and `}`. The
+// comments before a close, and after the last statement of the input, trail
+// the block it closes, or the program.
+
+// Comments are the comments attached to a node, in the order of the input.
+type Comments struct {
+	Leading  []lex.Item
+	Trailing []lex.Item
+}
+
+// SetKeepComments selects whether Parse attaches the comments of the input
+// to the nodes of the tree, in Node.Comments, rather than dropping them.
+func (p *Parser) SetKeepComments(keep bool) {
+	p.keepComments = keep
+}
+
+// attachComment attaches a comment to the last node, if the comment is on
+// the line it ends, or to the comments leading the next node.
+func attachComment(nodes []Node, comment lex.Item, leading []lex.Item) []lex.Item {
+
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if nodes[i].Type().Match(lex.Separator, lex.Comma) {
+			continue
+		}
+
+		if endLine, _ := nodes[i].Item.End(); endLine == comment.Line {
+			c := nodes[i].comments()
+			c.Trailing = append(c.Trailing, comment)
+			return leading
+		}
+		break
+	}
+
+	return append(leading, comment)
+}
+
+// comments returns the comments of a node, adding them if it has none.
+func (n *Node) comments() *Comments {
+	if n.Comments == nil {
+		n.Comments = &Comments{}
+	}
+	return n.Comments
+}
+
+// closeComments returns the comments of a node, with those of the close of
+// its group trailing it.
+func closeComments(n Node, close Node) *Comments {
+
+	if close.Comments == nil {
+		return n.Comments
+	}
+
+	c := &Comments{}
+	if n.Comments != nil {
+		*c = *n.Comments
+	}
+	c.Trailing = append(append(append([]lex.Item{}, c.Trailing...),
+		close.Comments.Leading...), close.Comments.Trailing...)
+
+	return c
+}
+
+// hoistComments moves the comments leading the first token of each node,
+// and trailing its last, out to the node.
+func hoistComments(n Node) Node {
+
+	if len(n.Children) == 0 {
+		return n
+	}
+
+	var leading, trailing []lex.Item
+	if n.Comments != nil {
+		leading, trailing = n.Comments.Leading, n.Comments.Trailing
+	}
+
+	children := make([]Node, len(n.Children))
+	for i, c := range n.Children {
+		c = hoistComments(c)
+
+		if c.Comments != nil && c.Span.Line > 0 && n.Span.Line > 0 {
+			kept := *c.Comments
+			if c.Span.Offset == n.Span.Offset {
+				leading = append(kept.Leading[:len(kept.Leading):len(kept.Leading)], leading...)
+				kept.Leading = nil
+			}
+			if c.Span.EndOffset == n.Span.EndOffset {
+				trailing = append(trailing[:len(trailing):len(trailing)], kept.Trailing...)
+				kept.Trailing = nil
+			}
+
+			c.Comments = nil
+			if len(kept.Leading) > 0 || len(kept.Trailing) > 0 {
+				c.Comments = &kept
+			}
+		}
+
+		children[i] = c
+	}
+	n.Children = children
+
+	n.Comments = nil
+	if len(leading) > 0 || len(trailing) > 0 {
+		n.Comments = &Comments{Leading: leading, Trailing: trailing}
+	}
+
+	return n
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"sync"
+
+	"github.com/pdk/meh/lex"
+)
+
+// Precedence is how tightly a registered operator binds, relative to the
+// built-in operators.
+type Precedence int
+
+// The precedences of registered operators. Power binds more tightly than
+// any built-in operator except `.` and calls; each of the others binds less
+// tightly than the built-in operators named, and more tightly than those of
+// the next.
+const (
+	Power          Precedence = iota // before * / %, e.g. for **
+	Multiplicative                   // after * / %
+	Additive                         // after + -
+	Comparison                       // after < > <= >= == !=
+	Logical                          // after && ||
+)
+
+// custom holds the operators registered at each precedence.
+var custom = struct {
+	sync.RWMutex
+	ops map[Precedence][]lex.Type
+}{
+	ops: make(map[Precedence][]lex.Type),
+}
+
+// RegisterOperator makes the parser gather a binary operator, e.g. one
+// added to the lexer with lex.RegisterOperator, at a precedence. Operators of
+// the same precedence gather left to right. Operators should be registered
+// before any input is parsed.
+func RegisterOperator(op lex.Type, p Precedence) {
+	custom.Lock()
+	defer custom.Unlock()
+
+	custom.ops[p] = append(custom.ops[p], op)
+}
+
+// customLevels are the levels at which the operators registered at each
+// precedence bind.
+var customLevels = map[Precedence]int{
+	Power:          levelPower,
+	Multiplicative: levelCustomMultiplicative,
+	Additive:       levelCustomAdditive,
+	Comparison:     levelCustomComparison,
+	Logical:        levelLogical,
+}
+
+// operatorLevels returns the levels of the binary operators, built-in and
+// registered. An operator registered at more than one level, or that is
+// built in, binds at the tightest.
+func operatorLevels() map[lex.Type]int {
+
+	levels := make(map[lex.Type]int, len(builtinLevels))
+	for op, level := range builtinLevels {
+		levels[op] = level
+	}
+
+	custom.RLock()
+	defer custom.RUnlock()
+
+	for p, ops := range custom.ops {
+		for _, op := range ops {
+			if level := customLevels[p]; level > levels[op] {
+				levels[op] = level
+			}
+		}
+	}
+
+	return levels
+}
@@ -0,0 +1,523 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+)
+
+// A statement is parsed by precedence climbing: an operand, and then each
+// binary operator that binds at least as tightly as the caller requires,
+// with the operand to its right parsed at the next tighter level, so that
+// e.g. `a + b * c` gathers `b * c` first. The groups of the statement, in
+// parens and braces, are already parsed, as blocks of their own, and are
+// operands, as are names and literals.
+
+// The levels at which the binary operators bind, loosest first. The
+// operators registered at a precedence bind at the level after the built-in
+// operators it names. A return takes the expression after it, up to the
+// first && or || or looser operator.
+const (
+	levelAssign = iota + 1
+	levelUntil
+	levelLogical
+	levelAndOr
+	levelReturn
+	levelComma
+	levelCustomComparison
+	levelComparison
+	levelIs
+	levelCustomAdditive
+	levelAdditive
+	levelCustomMultiplicative
+	levelMultiplicative
+	levelPower
+	levelOperand
+)
+
+// builtinLevels are the levels of the built-in binary operators.
+var builtinLevels = map[lex.Type]int{
+	lex.Assign:         levelAssign,
+	lex.PlusAssign:     levelAssign,
+	lex.MinusAssign:    levelAssign,
+	lex.MultAssign:     levelAssign,
+	lex.DivAssign:      levelAssign,
+	lex.ModuloAssign:   levelAssign,
+	lex.Until:          levelUntil,
+	lex.And:            levelAndOr,
+	lex.Or:             levelAndOr,
+	lex.Comma:          levelComma,
+	lex.Less:           levelComparison,
+	lex.Greater:        levelComparison,
+	lex.LessOrEqual:    levelComparison,
+	lex.GreaterOrEqual: levelComparison,
+	lex.Equal:          levelComparison,
+	lex.NotEqual:       levelComparison,
+	lex.Is:             levelIs,
+	lex.Plus:           levelAdditive,
+	lex.Minus:          levelAdditive,
+	lex.Mult:           levelMultiplicative,
+	lex.Div:            levelMultiplicative,
+	lex.Modulo:         levelMultiplicative,
+}
+
+// syntaxError is a problem found parsing a statement, at the node where it
+// was found.
+type syntaxError struct {
+	node Node
+	code diag.Code
+	err  error
+}
+
+func (e syntaxError) Error() string {
+	return e.err.Error()
+}
+
+// report records the problem with the lexer of the input, as report does.
+func (e syntaxError) report() {
+	e.node.Item.Report(e.node.Item.Diagnose(e.code, e.err))
+}
+
+// statement holds the nodes of a statement being parsed, and the position
+// of the next.
+type statement struct {
+	nodes  []Node
+	pos    int
+	levels map[lex.Type]int
+}
+
+// parseStatement parses the nodes of a statement, separators removed, to a
+// single node, or returns the first problem found, as a syntaxError.
+func parseStatement(nodes []Node, levels map[lex.Type]int) (Node, error) {
+
+	s := &statement{nodes: nodes, levels: levels}
+
+	n, err := s.expression(levelAssign)
+	if err != nil {
+		return Node{}, err
+	}
+
+	n = s.increments(n)
+
+	if s.pos < len(s.nodes) {
+		return Node{}, s.unexpected(s.nodes[s.pos])
+	}
+
+	return reassign(n), nil
+}
+
+// expression parses an operand, and the binary operators after it binding
+// at least as tightly as min. Assignments gather right to left, and the
+// other operators left to right.
+func (s *statement) expression(min int) (Node, error) {
+
+	left, limit, err := s.operand(min)
+	if err != nil {
+		return Node{}, err
+	}
+
+	for s.pos < len(s.nodes) {
+
+		op := s.nodes[s.pos]
+		level := s.level(op)
+		if level == 0 || level < min {
+			break
+		}
+		if level >= limit {
+			return Node{}, misplaced(op)
+		}
+		s.pos++
+
+		next := level + 1
+		if level == levelAssign {
+			next = level
+		}
+
+		right, err := s.expression(next)
+		if err != nil {
+			return Node{}, err
+		}
+
+		left = binary(op, left, right)
+	}
+
+	return left, nil
+}
+
+// level returns the level of a binary operator, or 0 if the node is not one.
+func (s *statement) level(n Node) int {
+	if n.Resolved {
+		return 0
+	}
+	return s.levels[n.Type()]
+}
+
+// binary gathers an operator and its operands. The operands of a chain of
+// commas, `a, b, c`, are gathered into a single node.
+func binary(op, left, right Node) Node {
+
+	n := Node{
+		Item:     op.Item,
+		Resolved: true,
+		Comments: op.Comments,
+		Children: []Node{left, right},
+	}
+
+	if op.Type().Match(lex.Comma) && left.Type().Match(lex.Comma) {
+		n.Children = append(left.Children[:len(left.Children):len(left.Children)], right)
+	}
+
+	return joinSpans(n)
+}
+
+// operand parses the operand of an operator binding at least as tightly as
+// min, and returns the level of the operators that may follow it: a return,
+// `return x`, may only be followed by operators looser than its expression.
+func (s *statement) operand(min int) (Node, int, error) {
+
+	if s.pos == len(s.nodes) {
+		return Node{}, 0, s.missing()
+	}
+
+	if n := s.nodes[s.pos]; unresolvedType(n).Match(lex.Return) {
+		if min > levelReturn {
+			return Node{}, 0, misplaced(n)
+		}
+		s.pos++
+
+		n.Resolved = true
+		if s.pos < len(s.nodes) && startsOperand(s.nodes[s.pos]) {
+			x, err := s.expression(levelComma)
+			if err != nil {
+				return Node{}, 0, err
+			}
+			n.Children = []Node{x}
+		}
+
+		return joinSpans(n), levelReturn, nil
+	}
+
+	x, err := s.primary()
+	if err != nil {
+		return Node{}, 0, err
+	}
+
+	// a type annotation, `x: int`.
+	for s.pos < len(s.nodes) && unresolvedType(s.nodes[s.pos]).Match(lex.Colon) {
+		colon := s.nodes[s.pos]
+		s.pos++
+
+		t, err := s.primary()
+		if err != nil {
+			return Node{}, 0, err
+		}
+
+		x = binary(colon, x, t)
+	}
+
+	return s.postfix(x), levelOperand, nil
+}
+
+// postfix gathers the function applications, `f(x)`, and member accesses,
+// `m.name`, after an operand, left to right, so that e.g. `m.f(x).y` chains
+// as expected. Any operand may be called, or accessed, including the result
+// of a call, e.g. `f(x)(y)`, and an expression in parens, e.g.
+// `(fn(a) { a * 2 })(1)`.
+func (s *statement) postfix(x Node) Node {
+
+	for x.Resolved && s.pos < len(s.nodes) {
+
+		n := s.nodes[s.pos]
+
+		switch {
+		case unresolvedType(n).Match(lex.Dot) &&
+			s.pos+1 < len(s.nodes) &&
+			s.nodes[s.pos+1].Type().Match(lex.Ident):
+
+			x = joinSpans(Node{
+				Item:     n.Item,
+				Resolved: true,
+				Comments: n.Comments,
+				Children: []Node{operand(x), s.nodes[s.pos+1]},
+			})
+			s.pos += 2
+
+		case n.Item.Match(lex.LeftParen):
+			fn := operand(x)
+
+			item := fn.Item
+			item.Type = lex.FuncApply
+
+			x = joinSpans(Node{
+				Item:     item,
+				Resolved: true,
+				Children: []Node{fn, n},
+			})
+			s.pos++
+
+		default:
+			return x
+		}
+	}
+
+	return x
+}
+
+// operand returns the expression of an operand of a call or member access:
+// the expression in parens, rather than the parens, which are a block of
+// statements, if there is only one, and it is not a list. The expression is
+// given the span of the parens.
+func operand(n Node) Node {
+
+	if !n.Type().Match(lex.LeftParen) || len(n.Children) != 1 || n.Children[0].Type().Match(lex.Comma) {
+		return n
+	}
+
+	x := operand(n.Children[0])
+	x.Span = x.Span.Join(n.Span)
+	if x.Comments == nil {
+		x.Comments = n.Comments
+	}
+
+	return x
+}
+
+// primary parses a name, literal, or group, a fn literal, a do, or a break
+// or continue, with its label.
+func (s *statement) primary() (Node, error) {
+
+	if s.pos == len(s.nodes) {
+		return Node{}, s.missing()
+	}
+
+	n := s.nodes[s.pos]
+	s.pos++
+
+	switch {
+	case unresolvedType(n).Match(lex.Function):
+		if s.typeName() {
+			n.Resolved = true
+			return n, nil
+		}
+		return s.function(n)
+
+	case unresolvedType(n).Match(lex.Do):
+		return s.do(n, nil)
+
+	case n.Type().Match(lex.Break, lex.Continue):
+		if s.pos < len(s.nodes) && s.nodes[s.pos].Type().Match(lex.Ident) {
+			n.Children = []Node{s.nodes[s.pos]}
+			s.pos++
+		}
+		return joinSpans(n), nil
+
+	case n.Type().Match(lex.Ident) &&
+		s.pos+2 < len(s.nodes) &&
+		unresolvedType(s.nodes[s.pos]).Match(lex.Colon) &&
+		unresolvedType(s.nodes[s.pos+1]).Match(lex.Do):
+
+		// a labeled do, `outer: do { body }`.
+		s.pos++
+		do := s.nodes[s.pos]
+		s.pos++
+		return s.do(do, &n)
+
+	case n.Resolved, n.Type().Match(lex.Error):
+		return n, nil
+	}
+
+	return Node{}, misplaced(n)
+}
+
+// typeName checks if a fn, just read, names the type after an `is` or a
+// `:`, rather than starting a fn literal.
+func (s *statement) typeName() bool {
+	return s.pos >= 2 && unresolvedType(s.nodes[s.pos-2]).Match(lex.Is, lex.Colon)
+}
+
+// function parses a fn literal, `fn (params) { body }`, after its fn, to a
+// Function node. A return type annotation, `fn (params): type { body }`,
+// becomes a third child.
+func (s *statement) function(fn Node) (Node, error) {
+
+	rest := s.nodes[s.pos:]
+
+	switch {
+	case len(rest) >= 2 &&
+		rest[0].Type().Match(lex.LeftParen) &&
+		rest[1].Type().Match(lex.LeftBrace):
+
+		fn.Children = []Node{rest[0], rest[1]}
+		s.pos += 2
+
+	case len(rest) >= 4 &&
+		rest[0].Type().Match(lex.LeftParen) &&
+		unresolvedType(rest[1]).Match(lex.Colon) &&
+		rest[2].Type().Match(lex.Ident, lex.Function, lex.Nil) &&
+		rest[3].Type().Match(lex.LeftBrace):
+
+		t := rest[2]
+		t.Resolved = true
+		fn.Children = []Node{rest[0], rest[3], t}
+		s.pos += 4
+
+	default:
+		return Node{}, syntaxError{fn, diag.Syntax,
+			fmt.Errorf("%s requires (params) and a { body }", fn.Item.Value)}
+	}
+
+	fn.Resolved = true
+	return joinSpans(fn), nil
+}
+
+// do parses a do, `do { body }`, after its do, to a Do node, which is later
+// joined with its condition by `until`. A label, `outer: do { body }`,
+// becomes a second child.
+func (s *statement) do(do Node, label *Node) (Node, error) {
+
+	if s.pos == len(s.nodes) || !s.nodes[s.pos].Type().Match(lex.LeftBrace) {
+		return Node{}, syntaxError{do, diag.Syntax,
+			fmt.Errorf("%s requires a { body }", do.Item.Value)}
+	}
+
+	do.Resolved = true
+	do.Children = []Node{s.nodes[s.pos]}
+	s.pos++
+
+	if label != nil {
+		do.Children = append(do.Children, *label)
+	}
+
+	return joinSpans(do), nil
+}
+
+// increments gathers the increments and decrements after an expression,
+// `x++`, to `x += 1`, or `x -= 1`.
+func (s *statement) increments(x Node) Node {
+
+	for s.pos < len(s.nodes) && unresolvedType(s.nodes[s.pos]).Match(lex.Increment, lex.Decrement) {
+
+		n := s.nodes[s.pos]
+		s.pos++
+
+		one := n.Item
+		one.Type = lex.Number
+		one.Value = "1"
+
+		op := Node{
+			Item:     n.Item,
+			Resolved: true,
+			Comments: n.Comments,
+			Children: []Node{
+				x,
+				{Item: one, Resolved: true},
+			},
+		}
+		op.Item.Type = lex.PlusAssign
+		if n.Type().Match(lex.Decrement) {
+			op.Item.Type = lex.MinusAssign
+		}
+
+		x = joinSpans(op)
+	}
+
+	return x
+}
+
+// reassign rewrites an operator assignment of a statement, `x += y`, to an
+// assignment, `x = x + y`.
+func reassign(n Node) Node {
+
+	newOp := assignOp(n.Type())
+	if newOp.Match(lex.Error) || len(n.Children) != 2 {
+		return n
+	}
+
+	op := Node{
+		Item:     n.Item,
+		Resolved: true,
+		Children: []Node{
+			n.Children[0],
+			n.Children[1],
+		},
+	}
+	op.Item.Type = newOp
+
+	assign := Node{
+		Item:     n.Item,
+		Resolved: true,
+		Comments: n.Comments,
+		Children: []Node{
+			n.Children[0],
+			joinSpans(op),
+		},
+	}
+	assign.Item.Type = lex.Assign
+
+	return joinSpans(assign)
+}
+
+func assignOp(op lex.Type) lex.Type {
+	switch op {
+	case lex.PlusAssign:
+		return lex.Plus
+	case lex.MinusAssign:
+		return lex.Minus
+	case lex.MultAssign:
+		return lex.Mult
+	case lex.DivAssign:
+		return lex.Div
+	case lex.ModuloAssign:
+		return lex.Modulo
+	}
+
+	return lex.Error
+}
+
+// startsOperand checks if a node may start an operand, rather than being an
+// operator, so that a return without one, e.g. `a && return || b`, is not
+// given the operator.
+func startsOperand(n Node) bool {
+	return n.Resolved || n.Type().Match(lex.Function, lex.Do, lex.Return, lex.Error)
+}
+
+// missing returns the problem of a statement ending where an operand is
+// required, at the operator requiring it.
+func (s *statement) missing() error {
+	return misplaced(s.nodes[s.pos-1])
+}
+
+// unexpected returns the problem of a node left over after the expression
+// of a statement.
+func (s *statement) unexpected(n Node) error {
+
+	if !startsOperand(n) {
+		return misplaced(n)
+	}
+
+	return syntaxError{n, diag.Syntax,
+		fmt.Errorf("cannot parse statement: unexpected %q", n.Item.Value)}
+}
+
+// misplaced returns the problem of an operator without its operands.
+func misplaced(n Node) error {
+	return syntaxError{n, diag.MisplacedOperator,
+		fmt.Errorf("misplaced operator/missing operand %q", n.Item.Value)}
+}
+
+func unresolvedType(n Node) lex.Type {
+	if n.Resolved {
+		return lex.Nada
+	}
+	return n.Item.Type
+}
+
+// joinSpans returns a node with its span widened to those of its children,
+// which are already parsed.
+func joinSpans(n Node) Node {
+	for _, c := range n.Children {
+		n.Span = n.Span.Join(c.Span)
+	}
+	return n
+}
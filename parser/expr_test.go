@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestParseStatements(t *testing.T) {
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"x = 1 - 2 - 3", "<Assign~= Ident~x <Minus~- <Minus~- Number~1 Number~2> Number~3>>"},
+		{"a = b = 1 + 2 * 3 - 4", "<Assign~= Ident~a <Assign~= Ident~b <Minus~- <Plus~+ Number~1 <Mult~* Number~2 Number~3>> Number~4>>>"},
+		{"f() until x is int && y < 2 || z", "<Until~until <FuncApply~f Ident~f LeftParen~(> <Or~|| <And~&& <Is~is Ident~x Ident~int> <Less~< Ident~y Number~2>> Ident~z>>"},
+		{"a, b, c = 1, 2, 3", "<Assign~= <Comma~, Ident~a Ident~b Ident~c> <Comma~, Number~1 Number~2 Number~3>>"},
+		{"return a, b", "<Return~return <Comma~, Ident~a Ident~b>>"},
+		{"return x && y", "<And~&& <Return~return Ident~x> Ident~y>"},
+		{"a = return 1", "<Assign~= Ident~a <Return~return Number~1>>"},
+		{"x = y = return", "<Assign~= Ident~x <Assign~= Ident~y Return~return>>"},
+		{"do { break } until return a, b", "<Until~until <Do~do <LeftBrace~{ Break~break>> <Return~return <Comma~, Ident~a Ident~b>>>"},
+		{"f(a, b).c(d)", "<FuncApply~. <Dot~. <FuncApply~f Ident~f <LeftParen~( Ident~a Ident~b>> Ident~c> <LeftParen~( Ident~d>>"},
+		{"a.b(c)(d)", "<FuncApply~. <FuncApply~. <Dot~. Ident~a Ident~b> <LeftParen~( Ident~c>> <LeftParen~( Ident~d>>"},
+		{"x: int = 1", "<Assign~= <Colon~: Ident~x Ident~int> Number~1>"},
+		{"f = fn(x) { x }", "<Assign~= Ident~f <Function~fn <LeftParen~( Ident~x> <LeftBrace~{ Ident~x>>>"},
+	}
+
+	for _, tt := range tests {
+		node, errs := NewFromString("t.meh", tt.input).Parse()
+		if len(errs) > 0 {
+			t.Errorf("%q: %v", tt.input, errs)
+			continue
+		}
+
+		if got := node.Children[0].String(); got != tt.want {
+			t.Errorf("%q parsed to\n\t%s\nwant\n\t%s", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestParseErrorPositions checks that a statement that cannot be parsed is
+// reported at the token where the parse failed, rather than where the
+// statement starts.
+func TestParseErrorPositions(t *testing.T) {
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"y =", `t.meh:1:3: error: misplaced operator/missing operand "=" [misplaced-operator]`},
+		{"x = 1 +", `t.meh:1:7: error: misplaced operator/missing operand "+" [misplaced-operator]`},
+		{"a + * b", `t.meh:1:5: error: misplaced operator/missing operand "*" [misplaced-operator]`},
+		{"a b", `t.meh:1:3: error: cannot parse statement: unexpected "b" [syntax]`},
+		{"1 2 3", `t.meh:1:3: error: cannot parse statement: unexpected "2" [syntax]`},
+		{"until return is nil", `t.meh:1:1: error: misplaced operator/missing operand "until" [misplaced-operator]`},
+		{"x = 1\nf = fn x", `t.meh:2:5: error: fn requires (params) and a { body } [syntax]`},
+	}
+
+	for _, tt := range tests {
+		_, errs := NewFromString("t.meh", tt.input).Parse()
+		if len(errs) != 1 {
+			t.Errorf("%q: got errors %v, want 1", tt.input, errs)
+			continue
+		}
+
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("%q: got error\n\t%s\nwant\n\t%s", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"github.com/pdk/meh/lex"
+)
+
+// A parse tree can be written out, e.g. by a build step, and read back to be
+// compiled without parsing the source again. The encoding names item types
+// rather than numbering them, so that it survives the addition of new types.
+// The spans and comments of the nodes are kept, for the errors and tools
+// that use them.
+
+// irMagic starts an encoded parse tree.
+const irMagic = "meh-ir\n"
+
+// irVersion is the version of the encoding, for changes that old readers
+// cannot handle: 2 added the spans and comments of nodes.
+const irVersion = 2
+
+type irFile struct {
+	Version int
+	Name    string
+	Types   []string
+	Root    irNode
+}
+
+type irNode struct {
+	Type     int
+	Value    string
+	Line     int
+	Column   int
+	Span     lex.Span
+	Comments *irComments
+	Children []irNode
+}
+
+type irComments struct {
+	Leading  []irComment
+	Trailing []irComment
+}
+
+type irComment struct {
+	Type   int
+	Value  string
+	Line   int
+	Column int
+}
+
+// IsEncoded checks if input starts with an encoded parse tree, without
+// consuming it.
+func IsEncoded(r *bufio.Reader) bool {
+	prefix, _ := r.Peek(len(irMagic))
+	return string(prefix) == irMagic
+}
+
+// Encode writes a parse tree, as produced by Parse.
+func Encode(w io.Writer, node Node) error {
+
+	f := irFile{
+		Version: irVersion,
+		Name:    node.Item.Name(),
+	}
+
+	index := make(map[lex.Type]int)
+	f.Root = encodeNode(node, &f, index)
+
+	if _, err := io.WriteString(w, irMagic); err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(f)
+}
+
+func encodeNode(node Node, f *irFile, index map[lex.Type]int) irNode {
+
+	n := irNode{
+		Type:   encodeType(node.Type(), f, index),
+		Value:  node.Item.Value,
+		Line:   node.Item.Line,
+		Column: node.Item.Column,
+		Span:   node.Span,
+	}
+
+	if node.Comments != nil {
+		n.Comments = &irComments{
+			Leading:  encodeComments(node.Comments.Leading, f, index),
+			Trailing: encodeComments(node.Comments.Trailing, f, index),
+		}
+	}
+
+	for _, c := range node.Children {
+		n.Children = append(n.Children, encodeNode(c, f, index))
+	}
+
+	return n
+}
+
+func encodeComments(items []lex.Item, f *irFile, index map[lex.Type]int) []irComment {
+
+	var comments []irComment
+	for _, item := range items {
+		comments = append(comments, irComment{
+			Type:   encodeType(item.Type, f, index),
+			Value:  item.Value,
+			Line:   item.Line,
+			Column: item.Column,
+		})
+	}
+
+	return comments
+}
+
+// encodeType returns the index of a type in the names of the file, adding
+// it if it is new.
+func encodeType(t lex.Type, f *irFile, index map[lex.Type]int) int {
+
+	i, ok := index[t]
+	if !ok {
+		i = len(f.Types)
+		index[t] = i
+		f.Types = append(f.Types, t.String())
+	}
+
+	return i
+}
+
+// Decode reads a parse tree written by Encode.
+func Decode(r io.Reader) (Node, error) {
+
+	magic := make([]byte, len(irMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, []byte(irMagic)) {
+		return Node{}, fmt.Errorf("not an encoded meh program")
+	}
+
+	var f irFile
+	if err := gob.NewDecoder(r).Decode(&f); err != nil {
+		return Node{}, fmt.Errorf("cannot decode meh program: %v", err)
+	}
+
+	if f.Version != irVersion {
+		return Node{}, fmt.Errorf("cannot decode meh program: version %d, requires %d", f.Version, irVersion)
+	}
+
+	types := make([]lex.Type, len(f.Types))
+	for i, name := range f.Types {
+		t, ok := typeNamed(name)
+		if !ok {
+			return Node{}, fmt.Errorf("cannot decode meh program: unknown item type %s", name)
+		}
+		types[i] = t
+	}
+
+	return decodeNode(f.Root, lex.Source(f.Name), types)
+}
+
+func decodeNode(n irNode, source *lex.Lexer, types []lex.Type) (Node, error) {
+
+	t, err := decodeType(n.Type, types)
+	if err != nil {
+		return Node{}, err
+	}
+
+	node := Node{
+		Item: lex.Item{
+			Lexer:  source,
+			Type:   t,
+			Value:  source.Intern(n.Value),
+			Line:   n.Line,
+			Column: n.Column,
+		},
+		Resolved: true,
+		Span:     n.Span,
+	}
+
+	if n.Comments != nil {
+		node.Comments = &Comments{}
+		if node.Comments.Leading, err = decodeComments(n.Comments.Leading, source, types); err != nil {
+			return Node{}, err
+		}
+		if node.Comments.Trailing, err = decodeComments(n.Comments.Trailing, source, types); err != nil {
+			return Node{}, err
+		}
+	}
+
+	for _, c := range n.Children {
+		child, err := decodeNode(c, source, types)
+		if err != nil {
+			return Node{}, err
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+func decodeComments(comments []irComment, source *lex.Lexer, types []lex.Type) ([]lex.Item, error) {
+
+	var items []lex.Item
+	for _, c := range comments {
+		t, err := decodeType(c.Type, types)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, lex.Item{
+			Lexer:  source,
+			Type:   t,
+			Value:  c.Value,
+			Line:   c.Line,
+			Column: c.Column,
+		})
+	}
+
+	return items, nil
+}
+
+func decodeType(i int, types []lex.Type) (lex.Type, error) {
+
+	if i < 0 || i >= len(types) {
+		return 0, fmt.Errorf("cannot decode meh program: bad item type %d", i)
+	}
+
+	return types[i], nil
+}
+
+// typeNamed returns the item type with a name.
+func typeNamed(name string) (lex.Type, bool) {
+	return lex.TypeNamed(name)
+}
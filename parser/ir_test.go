@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pdk/meh/lex"
+)
+
+const roundTripSource = `# area is the area of a circle.
+area = fn(r) {
+	3.14 * r * r # the radius may be negative
+}
+// the unit circle
+unit = area(1)
+`
+
+func TestEncodeRoundTrip(t *testing.T) {
+
+	want := parseKeepingComments(t)
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sameTree(t, "", got, want)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+
+	want := parseKeepingComments(t)
+
+	data, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sameTree(t, "", got, want)
+}
+
+func parseKeepingComments(t *testing.T) Node {
+
+	p := NewFromString("circle.meh", roundTripSource)
+	p.SetKeepComments(true)
+
+	node, errs := p.Parse()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if node.Children[0].Span.Line == 0 || node.Children[0].Comments == nil {
+		t.Fatalf("the parsed statement has no span or comments: %v", node.Children[0])
+	}
+
+	return node
+}
+
+// sameTree checks that a decoded tree has the items, spans, and comments of
+// the tree encoded.
+func sameTree(t *testing.T, path string, got, want Node) {
+
+	path += "/" + want.Type().String()
+
+	if got.Type() != want.Type() || got.Item.Value != want.Item.Value ||
+		got.Item.Line != want.Item.Line || got.Item.Column != want.Item.Column {
+		t.Errorf("%s: item %v, want %v", path, got.Item, want.Item)
+	}
+
+	if got.Span != want.Span {
+		t.Errorf("%s: span %+v, want %+v", path, got.Span, want.Span)
+	}
+
+	if (got.Comments == nil) != (want.Comments == nil) {
+		t.Errorf("%s: comments %v, want %v", path, got.Comments, want.Comments)
+	} else if want.Comments != nil {
+		sameComments(t, path+" leading", got.Comments.Leading, want.Comments.Leading)
+		sameComments(t, path+" trailing", got.Comments.Trailing, want.Comments.Trailing)
+	}
+
+	if len(got.Children) != len(want.Children) {
+		t.Fatalf("%s: %d children, want %d", path, len(got.Children), len(want.Children))
+	}
+
+	for i := range want.Children {
+		sameTree(t, path, got.Children[i], want.Children[i])
+	}
+}
+
+func sameComments(t *testing.T, path string, got, want []lex.Item) {
+
+	if len(got) != len(want) {
+		t.Errorf("%s: %d comments, want %d", path, len(got), len(want))
+		return
+	}
+
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Value != want[i].Value ||
+			got[i].Line != want[i].Line || got[i].Column != want[i].Column {
+			t.Errorf("%s: comment %v, want %v", path, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pdk/meh/lex"
+)
+
+// JSONVersion is the version of the JSON form of a parse tree written by
+// Marshal. It changes only when a reader of the previous version could
+// misread the new one: 2 added the spans and comments of nodes.
+const JSONVersion = 2
+
+// The JSON form of a parse tree, for tools such as linters and visualizers,
+// is an object
+//
+//	{"version": 2, "name": "script.meh", "root": NODE}
+//
+// where name is the name of the input, and each NODE is an object
+//
+//	{"type": "Plus", "value": "+", "line": 3, "column": 7,
+//	 "span": SPAN, "comments": COMMENTS, "children": [NODE, ...]}
+//
+// Types are the names of lex types, e.g. "Ident", "Number", "FuncApply", or
+// "LeftBrace" for a block. The SPAN is the source of the node and its
+// children,
+//
+//	{"line": 3, "column": 1, "endLine": 3, "endColumn": 11, "offset": 40, "endOffset": 51}
+//
+// and COMMENTS are those attached to the node, if the parser kept them,
+//
+//	{"leading": [COMMENT, ...], "trailing": [COMMENT, ...]}
+//
+// each {"type": "HashComment", "value": "# ...", "line": 2, "column": 1}. A
+// node may omit "span", "comments", and "children", and comments "leading"
+// and "trailing", when they are empty. The root is the LeftBrace block of the
+// statements of the program, as produced by Parse.
+
+type jsonFile struct {
+	Version int      `json:"version"`
+	Name    string   `json:"name"`
+	Root    jsonNode `json:"root"`
+}
+
+type jsonNode struct {
+	Type     string        `json:"type"`
+	Value    string        `json:"value"`
+	Line     int           `json:"line"`
+	Column   int           `json:"column"`
+	Span     *jsonSpan     `json:"span,omitempty"`
+	Comments *jsonComments `json:"comments,omitempty"`
+	Children []jsonNode    `json:"children,omitempty"`
+}
+
+type jsonSpan struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+	Offset    int `json:"offset"`
+	EndOffset int `json:"endOffset"`
+}
+
+type jsonComments struct {
+	Leading  []jsonComment `json:"leading,omitempty"`
+	Trailing []jsonComment `json:"trailing,omitempty"`
+}
+
+type jsonComment struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// Marshal returns the JSON form of a parse tree.
+func Marshal(node Node) ([]byte, error) {
+	return json.MarshalIndent(jsonFile{
+		Version: JSONVersion,
+		Name:    node.Item.Name(),
+		Root:    toJSON(node),
+	}, "", "  ")
+}
+
+func toJSON(node Node) jsonNode {
+
+	n := jsonNode{
+		Type:   node.Type().String(),
+		Value:  node.Item.Value,
+		Line:   node.Item.Line,
+		Column: node.Item.Column,
+	}
+
+	if node.Span.Line > 0 {
+		s := jsonSpan(node.Span)
+		n.Span = &s
+	}
+
+	if node.Comments != nil {
+		n.Comments = &jsonComments{
+			Leading:  commentsToJSON(node.Comments.Leading),
+			Trailing: commentsToJSON(node.Comments.Trailing),
+		}
+	}
+
+	for _, c := range node.Children {
+		n.Children = append(n.Children, toJSON(c))
+	}
+
+	return n
+}
+
+func commentsToJSON(items []lex.Item) []jsonComment {
+
+	var comments []jsonComment
+	for _, item := range items {
+		comments = append(comments, jsonComment{
+			Type:   item.Type.String(),
+			Value:  item.Value,
+			Line:   item.Line,
+			Column: item.Column,
+		})
+	}
+
+	return comments
+}
+
+// Unmarshal reads the JSON form of a parse tree, e.g. one produced or
+// rewritten by another tool, so that it can be compiled.
+func Unmarshal(data []byte) (Node, error) {
+
+	var f jsonFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Node{}, fmt.Errorf("cannot read meh JSON: %v", err)
+	}
+
+	if f.Version != JSONVersion {
+		return Node{}, fmt.Errorf("cannot read meh JSON: version %d, requires %d", f.Version, JSONVersion)
+	}
+
+	return fromJSON(f.Root, lex.Source(f.Name))
+}
+
+func fromJSON(n jsonNode, source *lex.Lexer) (Node, error) {
+
+	t, ok := typeNamed(n.Type)
+	if !ok {
+		return Node{}, fmt.Errorf("cannot read meh JSON: %d:%d: unknown type %q", n.Line, n.Column, n.Type)
+	}
+
+	node := Node{
+		Item: lex.Item{
+			Lexer:  source,
+			Type:   t,
+			Value:  source.Intern(n.Value),
+			Line:   n.Line,
+			Column: n.Column,
+		},
+		Resolved: true,
+	}
+
+	if n.Span != nil {
+		node.Span = lex.Span(*n.Span)
+	}
+
+	if n.Comments != nil {
+		var err error
+		node.Comments = &Comments{}
+		if node.Comments.Leading, err = commentsFromJSON(n.Comments.Leading, source); err != nil {
+			return Node{}, err
+		}
+		if node.Comments.Trailing, err = commentsFromJSON(n.Comments.Trailing, source); err != nil {
+			return Node{}, err
+		}
+	}
+
+	for _, c := range n.Children {
+		child, err := fromJSON(c, source)
+		if err != nil {
+			return Node{}, err
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+func commentsFromJSON(comments []jsonComment, source *lex.Lexer) ([]lex.Item, error) {
+
+	var items []lex.Item
+	for _, c := range comments {
+		t, ok := typeNamed(c.Type)
+		if !ok {
+			return nil, fmt.Errorf("cannot read meh JSON: %d:%d: unknown type %q", c.Line, c.Column, c.Type)
+		}
+
+		items = append(items, lex.Item{
+			Lexer:  source,
+			Type:   t,
+			Value:  c.Value,
+			Line:   c.Line,
+			Column: c.Column,
+		})
+	}
+
+	return items, nil
+}
@@ -1,28 +1,26 @@
 package parser
 
 import (
+	"fmt"
 	"io"
-	"log"
+	"sort"
 	"strings"
 
+	"github.com/pdk/meh/diag"
 	"github.com/pdk/meh/lex"
 )
 
 // Parser handles parsing a stream of input
 type Parser struct {
-	lexer *lex.Lexer
-	items chan lex.Item
-	// itemBuf []lex.Item
+	lexer        *lex.Lexer
+	keepComments bool
+	levels       map[lex.Type]int // the levels of the binary operators
 }
 
 // NewFromReader creates a parser for an input stream.
 func NewFromReader(name string, reader io.Reader) *Parser {
-
-	lexer, items := lex.New(name, reader)
-
 	return &Parser{
-		lexer: lexer,
-		items: items,
+		lexer: lex.NewLexer(name, reader),
 	}
 }
 
@@ -31,10 +29,19 @@ func NewFromString(name, input string) *Parser {
 	return NewFromReader(name, strings.NewReader(input))
 }
 
+// SetSeparatorRules sets the rules of where a line break ends a statement,
+// as lex.Lexer.SetSeparatorRules does, before the input is parsed.
+func (p *Parser) SetSeparatorRules(rules lex.SeparatorRules) {
+	p.lexer.SetSeparatorRules(rules)
+}
+
 // Node is a node in the parse tree.
 type Node struct {
 	Item     lex.Item
-	Resolved bool `json:"-"` // marker for "parsed"
+	Resolved bool      `json:"-"` // marker for "parsed"
+	Slot     int       `json:"-"` // 1 + the frame slot of a local name, set by the compiler
+	Span     lex.Span  `json:"-"` // the source of the node and its children, set by the parser
+	Comments *Comments `json:"-"` // the comments attached to the node, if the parser keeps them
 	Children []Node
 }
 
@@ -43,12 +50,27 @@ func (n Node) Type() lex.Type {
 	return n.Item.Type
 }
 
+// Error composes the node's item with an error, which concerns the node's
+// span, if it has one.
 func (n Node) Error(err error) error {
-	return n.Item.Error(err)
+	return n.Item.ErrorIn(err, n.Span)
 }
 
 func (n Node) String() string {
 	s := strings.Builder{}
+	n.write(&s, false)
+	return s.String()
+}
+
+// Sexpr returns the s-expression form of the node, as String, with the line
+// and column of each node, e.g. <Plus~+@1:3 Number~1@1:1 Number~2@1:5>.
+func (n Node) Sexpr() string {
+	s := strings.Builder{}
+	n.write(&s, true)
+	return s.String()
+}
+
+func (n Node) write(s *strings.Builder, positions bool) {
 
 	if len(n.Children) > 0 {
 		s.WriteString("<")
@@ -58,20 +80,26 @@ func (n Node) String() string {
 	s.WriteString("~")
 	s.WriteString(n.Item.Value)
 
+	if positions {
+		fmt.Fprintf(s, "@%d:%d", n.Item.Line, n.Item.Column)
+	}
+
 	for _, c := range n.Children {
 		s.WriteString(" ")
-		s.WriteString(c.String())
+		c.write(s, positions)
 	}
 
 	if len(n.Children) > 0 {
 		s.WriteString(">")
 	}
-
-	return s.String()
 }
 
-// Parse will parse the complete input, and return an AST.
-func (p *Parser) Parse() Node {
+// Parse will parse the complete input, and return an AST, along with the
+// errors found, each a diag.Diagnostic. Statements that cannot be parsed are
+// reported, and left out of the AST, and the parse carries on with the next,
+// so that the errors of the whole input are found; the AST should not be run
+// if there are any.
+func (p *Parser) Parse() (Node, []error) {
 	prog := lex.Item{
 		Lexer:  p.lexer,
 		Type:   lex.LeftBrace,
@@ -80,48 +108,47 @@ func (p *Parser) Parse() Node {
 		Column: 1,
 	}
 
-	return parseItems(prog, nodify(noComment(p.items)))
+	p.levels = operatorLevels()
+
+	nodes := nodify(p.lexer, p.keepComments)
+	node := p.parseItems(prog, nodes)
+	if p.keepComments {
+		node.Comments = closeComments(node, nodes[len(nodes)-1])
+		node = hoistComments(node)
+	}
+
+	var errs []error
+	for _, d := range p.Diagnostics() {
+		if d.Severity == diag.Error {
+			errs = append(errs, d)
+		}
+	}
+
+	return node, errs
 }
 
-func parseItems(wrapItem lex.Item, items chan Node) Node {
+// parseItems parses nodes as a block of statements: parenthesized groups,
+// then braced groups, are parsed recursively, and the nodes are split into
+// statements, each parsed by parseStatement. A statement that cannot be
+// parsed is reported where the problem was found, and left out.
+func (p *Parser) parseItems(wrapItem lex.Item, nodes []Node) Node {
+
+	nodes = p.group(nodes, lex.LeftParen, lex.RightParen, diag.UnclosedParen, "open paren without close")
+	nodes = p.group(nodes, lex.LeftBrace, lex.RightBrace, diag.UnclosedBrace, "open brace without close")
 
 	stmts := []Node{}
 
-	for x := range pipeline(
-		slicify(bracify(parenthify(items))),
-		// logify("slicify"),
-		raiseParenComma,
-		// logify("raiseParenComma"),
-		funcify,
-		// logify("funcify"),
-		funcApply,
-		// logify("funcapply"),
-		binaryOps(lex.Mult, lex.Div, lex.Modulo),
-		binaryOps(lex.Plus, lex.Minus),
-		binaryOps(lex.Less, lex.Greater, lex.LessOrEqual, lex.GreaterOrEqual, lex.Equal, lex.NotEqual),
-		// logify("binops"),
-		binaryOps(lex.Comma),
-		// logify("comma"),
-		collapse(lex.Comma),
-		// logify("collapse"),
-		returnify,
-		binaryOps(lex.And, lex.Or),
-		binaryOpsRightToLeft(lex.Assign, lex.PlusAssign, lex.MinusAssign, lex.MultAssign, lex.DivAssign, lex.ModuloAssign),
-		reassign,
-		checkResolved,
-	) {
-
-		if len(x) > 1 {
-			n := x[0]
-			log.Printf("error parsing statement near %s:%d:%d : %v", n.Item.Name(), n.Item.Line, n.Item.Column, x)
-			continue
-		}
-		if len(x) == 0 {
-			log.Printf("parser received statment with 0 elements (very bad!)")
+	for _, x := range statements(nodes) {
+
+		stmt, err := parseStatement(x, p.levels)
+		if err != nil {
+			if serr, ok := err.(syntaxError); ok && !hasLexError(x) {
+				serr.report()
+			}
 			continue
 		}
 
-		stmts = append(stmts, x[0])
+		stmts = append(stmts, stmt)
 	}
 
 	return Node{
@@ -131,388 +158,163 @@ func parseItems(wrapItem lex.Item, items chan Node) Node {
 	}
 }
 
-// func logify(label string) func(stmt []Node) []Node {
-// 	return func(stmt []Node) []Node {
-// 		log.Printf("%s: %v", label, stmt)
-// 		return stmt
-// 	}
-// }
-
-func checkResolved(stmt []Node) []Node {
-
-	for _, node := range stmt {
-		if !node.Resolved {
-			log.Printf("%s:%d:%d misplaced operator/missing operand %q",
-				node.Item.Name(), node.Item.Line, node.Item.Column,
-				node.Item.Value)
-		}
-		checkResolved(node.Children)
-	}
-
-	return stmt
+// report records a problem found parsing a node with the lexer of its input,
+// from which Diagnostics collects them.
+func report(node Node, code diag.Code, format string, args ...interface{}) {
+	node.Item.Report(node.Item.Diagnose(code, fmt.Errorf(format, args...)))
 }
 
-func funcApply(stmt []Node) []Node {
-
-	for i := 0; i < len(stmt)-1; i++ {
-		if !stmt[i].Resolved || !stmt[i+1].Item.Match(lex.LeftParen) {
-			continue
+// hasLexError checks if a statement includes an error found by the lexer,
+// which the lexer has reported.
+func hasLexError(stmt []Node) bool {
+	for _, n := range stmt {
+		if n.Type().Match(lex.Error) {
+			return true
 		}
-
-		fn := stmt[i]
-		params := stmt[i+1]
-
-		newItem := fn.Item
-		newItem.Type = lex.FuncApply
-
-		node := Node{
-			Item:     newItem,
-			Resolved: true,
-			Children: []Node{fn, params},
-		}
-
-		return funcApply(gorp(stmt[:i], node, stmt[i+2:]))
 	}
-
-	return stmt
+	return false
 }
 
-func funcify(stmt []Node) []Node {
-
-	for i := 0; i < len(stmt)-2; i++ {
+// Diagnostics returns the problems found in the input by Parse, and by the
+// lexer, of any severity, in the order of their positions.
+func (p *Parser) Diagnostics() diag.List {
 
-		if stmt[i].Resolved ||
-			!stmt[i].Type().Match(lex.Function) ||
-			!stmt[i+1].Type().Match(lex.LeftParen) ||
-			!stmt[i+2].Type().Match(lex.LeftBrace) {
-			continue
-		}
-
-		n := stmt[i]
-		n.Resolved = true
-		n.Children = []Node{
-			stmt[i+1], stmt[i+2],
-		}
+	ds := p.lexer.Diagnostics()
+	sort.SliceStable(ds, func(i, j int) bool {
+		return ds[i].Line < ds[j].Line || (ds[i].Line == ds[j].Line && ds[i].Column < ds[j].Column)
+	})
 
-		return funcify(gorp(stmt[:i], n, stmt[i+3:]))
-	}
-
-	return stmt
+	return ds
 }
 
-func returnify(stmt []Node) []Node {
-
-	for i, n := range stmt {
-		if n.Resolved || !n.Type().Match(lex.Return) {
-			continue
-		}
-
-		n.Resolved = true
-
-		if i+1 < len(stmt) && stmt[i+1].Resolved {
-			n.Children = []Node{
-				stmt[i+1],
-			}
-
-			return returnify(gorp(stmt[:i], n, stmt[i+2:]))
-		}
+// listed returns a group whose only statement is a list, e.g. the arguments
+// of a call, `(a, b)`, with the elements of the list as its children.
+func listed(g Node) Node {
 
-		return returnify(gorp(stmt[:i], n, stmt[i+1:]))
+	if g.Type().Match(lex.LeftParen) && len(g.Children) == 1 && g.Children[0].Type().Match(lex.Comma) {
+		g.Children = g.Children[0].Children
 	}
 
-	return stmt
+	return g
 }
 
-func reassign(stmt []Node) []Node {
-
-	// [+= x y] => [= x [+ x y]]
-	for i, n := range stmt {
+// statements splits nodes into statements at separators and the end of the
+// input, dropping empty statements.
+func statements(nodes []Node) [][]Node {
 
-		if n.Resolved {
-			continue
-		}
+	stmts := [][]Node{}
+	stmt := []Node{}
 
-		newOp := assignOp(n.Type())
-		if newOp.Match(lex.Error) {
+	for _, n := range nodes {
+		if n.Item.Type == lex.Separator || n.Item.Type == lex.EOF {
+			if len(stmt) > 0 {
+				stmts = append(stmts, stmt)
+				stmt = []Node{}
+			}
 			continue
 		}
 
-		opNode := Node{
-			Item:     n.Item,
-			Resolved: n.Resolved,
-			Children: []Node{
-				n.Children[0],
-				n.Children[1],
-			},
-		}
-		opNode.Item.Type = newOp
-
-		newNode := Node{
-			Item:     n.Item,
-			Resolved: n.Resolved,
-			Children: []Node{
-				n.Children[0],
-				opNode,
-			},
-		}
-		newNode.Item.Type = lex.Assign
-
-		return reassign(gorp(stmt[:i], newNode, stmt[i+1:]))
+		stmt = append(stmt, n)
 	}
 
-	return stmt
-}
-
-func assignOp(op lex.Type) lex.Type {
-	switch op {
-	case lex.PlusAssign:
-		return lex.Plus
-	case lex.MinusAssign:
-		return lex.Minus
-	case lex.MultAssign:
-		return lex.Mult
-	case lex.DivAssign:
-		return lex.Div
-	case lex.ModuloAssign:
-		return lex.Modulo
-	}
-
-	return lex.Error
-}
-
-func binaryOps(operators ...lex.Type) func(stmt []Node) []Node {
-
-	var f func(stmt []Node) []Node
-	f = func(stmt []Node) []Node {
-
-		// [... x * y ...] => [... {* [x y]} ...]
-		for i := 0; i < len(stmt)-2; i++ {
-			if unresolvedType(stmt[i+1]).Match(operators...) {
-				operation := Node{
-					Resolved: true,
-					Item:     stmt[i+1].Item,
-					Children: []Node{stmt[i], stmt[i+2]},
-				}
-				return f(gorp(stmt[:i], operation, stmt[i+3:]))
-			}
-		}
-
-		return stmt
+	if len(stmt) > 0 {
+		stmts = append(stmts, stmt)
 	}
 
-	return f
+	return stmts
 }
 
-func binaryOpsRightToLeft(operators ...lex.Type) func(stmt []Node) []Node {
-
-	var f func(stmt []Node) []Node
-	f = func(stmt []Node) []Node {
-
-		// [... x * y ...] => [... {* [x y]} ...]
-		for i := len(stmt) - 2; i >= 0; i-- {
-			if unresolvedType(stmt[i+1]).Match(operators...) {
-				operation := Node{
-					Resolved: true,
-					Item:     stmt[i+1].Item,
-					Children: []Node{stmt[i], stmt[i+2]},
-				}
-				return f(gorp(stmt[:i], operation, stmt[i+3:]))
+// group gathers the nodes between each open and its matching close, e.g. (
+// and ), into a node of the open, parsed as a block of statements. An open
+// without a close is reported, and gathers the nodes up to where the parse
+// synchronizes, the end of its statement for a paren, and the end of the
+// input for a brace, so that what follows is parsed, and its problems found,
+// as if it were closed. A close without an open is reported, and dropped; a
+// brace ends the statement it is in.
+func (p *Parser) group(nodes []Node, open, close lex.Type, code diag.Code, problem string) []Node {
+
+	out := []Node{}
+
+	for i := 0; i < len(nodes); i++ {
+
+		n := nodes[i]
+		if n.Item.Type.Match(close) && !n.Resolved {
+			report(n, diag.UnmatchedClose, "close without open %q", n.Item.Value)
+			if close.Match(lex.RightBrace) {
+				n.Item.Type = lex.Separator
+				out = append(out, n)
 			}
+			continue
 		}
 
-		return stmt
-	}
-
-	return f
-}
-
-func raiseParenComma(stmt []Node) []Node {
-
-	for i, n := range stmt {
-
-		if !stmt[i].Type().Match(lex.LeftParen) ||
-			len(stmt[i].Children) != 1 ||
-			!stmt[i].Children[0].Type().Match(lex.Comma) {
+		if !n.Item.Type.Match(open) || n.Resolved {
+			out = append(out, n)
 			continue
 		}
 
-		n.Children = n.Children[0].Children
-
-		return raiseParenComma(gorp(stmt[:i], n, stmt[i+1:]))
-	}
-
-	return stmt
-}
-
-func collapse(operators ...lex.Type) func(stmt []Node) []Node {
-
-	var f func(stmt []Node) []Node
-	f = func(stmt []Node) []Node {
-
-		// [ * [ * ... ] ... ] => [ * ... ... ]
-		for i := 0; i < len(stmt); i++ {
-
-			op := stmt[i]
-			if len(op.Children) == 0 || !op.Type().Match(operators...) {
-				continue
+		end, closed := matching(nodes, i, open, close)
+		if !closed {
+			report(n, code, problem)
+			if open.Match(lex.LeftParen) {
+				end = synchronize(nodes, i)
 			}
-
-			childOp := op.Children[0]
-			if op.Type() != childOp.Type() {
-				continue
-			}
-
-			op.Children = append(childOp.Children, op.Children[1:]...)
-
-			return f(gorp(stmt[:i], op, stmt[i+1:]))
 		}
 
-		return stmt
-	}
-
-	return f
-}
-
-func unresolvedType(n Node) lex.Type {
-	if n.Resolved {
-		return lex.Nada
-	}
-	return n.Item.Type
-}
-
-func gorp(before []Node, middle Node, after []Node) []Node {
-	return append(append(before, middle), after...)
-}
-
-func pipeline(in chan []Node, jobs ...func([]Node) []Node) chan []Node {
-
-	if len(jobs) == 0 {
-		return in
-	}
-
-	f := jobs[0]
-	out := make(chan []Node)
-
-	go func() {
-		defer close(out)
-
-		for stmt := range in {
-			out <- f(stmt)
+		g := p.parseItems(n.Item, nodes[i+1:end])
+		g.Span = n.Span
+		g.Comments = n.Comments
+		if closed {
+			g.Span = g.Span.Join(nodes[end].Span)
+			g.Comments = closeComments(g, nodes[end])
 		}
-	}()
+		out = append(out, joinSpans(listed(g)))
 
-	return pipeline(out, jobs[1:]...)
-}
-
-func slicify(in chan Node) chan []Node {
-	out := make(chan []Node)
-
-	go func() {
-		defer close(out)
-
-		slice := make([]Node, 0)
-		for n := range in {
-			if n.Item.Type == lex.Separator || n.Item.Type == lex.EOF {
-				if len(slice) > 0 {
-					out <- slice
-					slice = make([]Node, 0)
-				}
-				continue
-			}
-
-			slice = append(slice, n)
-		}
-
-		if len(slice) > 0 {
-			out <- slice
+		// skip the close, or leave where the parse synchronized.
+		i = end
+		if !closed {
+			i--
 		}
-	}()
+	}
 
 	return out
 }
 
-func bracify(in chan Node) chan Node {
+// matching returns the index of the close matching the open at nodes[i], and
+// true, or the index of the end of the input, and false, if there is none.
+func matching(nodes []Node, i int, open, close lex.Type) (int, bool) {
 
-	out := make(chan Node)
-	go func() {
-		defer close(out)
+	depth := 1
+	for j := i + 1; j < len(nodes); j++ {
+		depth = depth + adjustDepth(nodes[j], open, close)
 
-		for n := range in {
-
-			if !n.Item.Type.Match(lex.LeftBrace) || n.Resolved {
-				out <- n
-				continue
-			}
-
-			sub := make(chan Node)
-			go func(openBrace Node) {
-				defer close(sub)
-
-				depth := 1
-				for n := range in {
-					depth = depth + adjustDepth(n, lex.LeftBrace, lex.RightBrace)
-
-					switch {
-					case depth == 0:
-						return
-					case n.Item.Type.Match(lex.EOF):
-						log.Printf("%s:%d:%d open brace without close %q",
-							openBrace.Item.Name(), openBrace.Item.Line, openBrace.Item.Column,
-							openBrace.Item.Value)
-						return
-					}
-
-					sub <- n
-				}
-			}(n)
-
-			out <- parseItems(n.Item, sub)
+		switch {
+		case depth == 0:
+			return j, true
+		case nodes[j].Item.Type.Match(lex.EOF):
+			return j, false
 		}
-	}()
+	}
 
-	return out
+	return len(nodes), false
 }
 
-func parenthify(in chan Node) chan Node {
-
-	out := make(chan Node)
-	go func() {
-		defer close(out)
+// synchronize returns the index of the end of the statement an unclosed paren
+// at nodes[i] is in: the next separator, or close brace, outside the braces
+// after the paren, or the end of the input.
+func synchronize(nodes []Node, i int) int {
 
-		for n := range in {
+	depth := 0
+	for j := i + 1; j < len(nodes); j++ {
+		depth = depth + adjustDepth(nodes[j], lex.LeftBrace, lex.RightBrace)
 
-			if !n.Item.Type.Match(lex.LeftParen) || n.Resolved {
-				out <- n
-				continue
-			}
-
-			sub := make(chan Node)
-			go func(openParen Node) {
-				defer close(sub)
-
-				depth := 1
-				for n := range in {
-					depth = depth + adjustDepth(n, lex.LeftParen, lex.RightParen)
-
-					switch {
-					case depth == 0:
-						return
-					case n.Item.Type.Match(lex.EOF):
-						log.Printf("%s:%d:%d open paren without close %q",
-							openParen.Item.Name(), openParen.Item.Line, openParen.Item.Column,
-							openParen.Item.Value)
-						return
-					}
-
-					sub <- n
-				}
-			}(n)
-
-			out <- parseItems(n.Item, sub)
+		switch {
+		case depth < 0,
+			depth == 0 && nodes[j].Item.Type.Match(lex.Separator, lex.EOF):
+			return j
 		}
-	}()
+	}
 
-	return out
+	return len(nodes)
 }
 
 func adjustDepth(n Node, open, close lex.Type) int {
@@ -525,41 +327,41 @@ func adjustDepth(n Node, open, close lex.Type) int {
 	return 0
 }
 
-func nodify(in chan lex.Item) chan Node {
-	out := make(chan Node)
+// nodify reads all the items produced by the lexer, up to and including
+// EOF, and converts them to nodes, dropping comments, or attaching them to
+// the nodes if keepComments is set.
+func nodify(l *lex.Lexer, keepComments bool) []Node {
 
-	go func() {
-		defer close(out)
+	nodes := []Node{}
+	var leading []lex.Item
 
-		for item := range in {
-			out <- Node{
-				Item: item,
-				Resolved: item.Type.Match(
-					lex.Ident, lex.Number,
-					lex.Break, lex.Continue,
-					lex.Nil, lex.True, lex.False,
-					lex.DoubleQuoteString, lex.SingleQuoteString, lex.BacktickString),
+	for item := l.Next(); ; item = l.Next() {
+		if item.Type == lex.HashComment || item.Type == lex.SlashComment {
+			if keepComments {
+				leading = attachComment(nodes, item, leading)
 			}
+			continue
 		}
-	}()
 
-	return out
-}
-
-func noComment(in chan lex.Item) chan lex.Item {
-	out := make(chan lex.Item)
-
-	go func() {
-		defer close(out)
-
-		for next := range in {
-			if next.Type == lex.HashComment || next.Type == lex.SlashComment {
-				continue
-			}
-
-			out <- next
+		var comments *Comments
+		if len(leading) > 0 && !item.Type.Match(lex.Separator, lex.Comma) {
+			comments, leading = &Comments{Leading: leading}, nil
 		}
-	}()
 
-	return out
+		nodes = append(nodes, Node{
+			Item:     item,
+			Span:     item.Span(),
+			Comments: comments,
+			Resolved: item.Type.Match(
+				lex.Ident, lex.Number,
+				lex.Break, lex.Continue,
+				lex.Nil, lex.True, lex.False,
+				lex.DoubleQuoteString, lex.SingleQuoteString, lex.BacktickString,
+				lex.Regex),
+		})
+
+		if item.Type == lex.EOF {
+			return nodes
+		}
+	}
 }
@@ -0,0 +1,60 @@
+package parser
+
+// Visitor holds the hooks that Walk calls for each node. Either may be nil.
+type Visitor struct {
+	// Pre is called before the children of a node are walked. It returns the
+	// node to use in place of the node, which may be the node itself, and
+	// whether to walk the children of that node.
+	Pre func(node Node) (Node, bool)
+	// Post is called after the children of a node are walked, and returns
+	// the node to use in place of the node.
+	Post func(node Node) Node
+}
+
+// Walk walks a parse tree depth first, calling the hooks of a visitor for
+// each node, and returns the tree with the nodes replaced as the hooks
+// decided. The tree that was walked is not changed. For example, to rename a
+// variable:
+//
+//	renamed := parser.Walk(tree, parser.Visitor{
+//		Post: func(n parser.Node) parser.Node {
+//			if n.Type() == lex.Ident && n.Item.Value == "old" {
+//				n.Item.Value = "new"
+//			}
+//			return n
+//		},
+//	})
+func Walk(node Node, v Visitor) Node {
+
+	descend := true
+	if v.Pre != nil {
+		node, descend = v.Pre(node)
+	}
+
+	if descend && len(node.Children) > 0 {
+		children := make([]Node, len(node.Children))
+		for i, c := range node.Children {
+			children[i] = Walk(c, v)
+		}
+		node.Children = children
+	}
+
+	if v.Post != nil {
+		node = v.Post(node)
+	}
+
+	return node
+}
+
+// Inspect calls f for each node of a parse tree, depth first, walking the
+// children of a node only if f returns true.
+func Inspect(node Node, f func(node Node) bool) {
+
+	if !f(node) {
+		return
+	}
+
+	for _, c := range node.Children {
+		Inspect(c, f)
+	}
+}
@@ -0,0 +1,118 @@
+// Package values converts between Go values and the values used by scripts,
+// so that programs embedding meh need not depend on how the interpreter
+// represents them.
+package values
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pdk/meh/compile"
+)
+
+// ToGo converts a script value, from a context, e.g. the top context of the
+// program that produced it, to a plain Go value:
+//
+//   - the (true, value) tuple produced by a program or function is unwrapped
+//     to its value, and other tuples become []interface{}
+//   - lists become []interface{}, and maps become map[string]interface{}
+//   - records become the Go struct, or pointer to struct, they expose
+//   - functions become func(args ...interface{}) (interface{}, error), which
+//     call the function in a new child of the context, and so with its
+//     names, capabilities, fuel, and limits
+//
+// Other values (nil, int64, float64, string, bool, and the like) are returned
+// as they are.
+func ToGo(ctx *compile.Context, v compile.Value) interface{} {
+
+	switch x := v.(type) {
+	case compile.Tuple:
+		if len(x.Values) == 2 && x.Values[0] == true {
+			return ToGo(ctx, compile.Result(x))
+		}
+		list := make([]interface{}, len(x.Values))
+		for i, e := range x.Values {
+			list[i] = ToGo(ctx, e)
+		}
+		return list
+	case []compile.Value:
+		list := make([]interface{}, len(x))
+		for i, e := range x {
+			list[i] = ToGo(ctx, e)
+		}
+		return list
+	case map[string]compile.Value:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[k] = ToGo(ctx, e)
+		}
+		return m
+	case compile.Record:
+		return x.Interface()
+	case func(*compile.Context, ...compile.Value) (compile.Value, error):
+		return func(args ...interface{}) (interface{}, error) {
+			vals := make([]compile.Value, len(args))
+			for i, a := range args {
+				var err error
+				vals[i], err = FromGo(a)
+				if err != nil {
+					return nil, fmt.Errorf("argument %d: %v", i+1, err)
+				}
+			}
+			call := compile.NewContext(ctx)
+			res, err := call.Call(x, vals...)
+			if err != nil {
+				return nil, err
+			}
+			return ToGo(call, res), nil
+		}
+	}
+
+	return v
+}
+
+// FromGo converts a Go value to a script value, as compile.Context.Bind
+// does. It returns an error for values that scripts cannot use: channels,
+// complex numbers, unsafe pointers, and maps without string keys. Unsigned
+// ints too large for an int become floats.
+func FromGo(v interface{}) (compile.Value, error) {
+
+	if err := usable(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return compile.FromGo(v), nil
+}
+
+// usable checks that a value, and anything FromGo converts along with it,
+// can be used by scripts. Struct fields are converted only when accessed, so
+// are not checked.
+func usable(rv reflect.Value) error {
+
+	switch rv.Kind() {
+	case reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return fmt.Errorf("cannot convert %s", rv.Type())
+	case reflect.Ptr, reflect.Interface:
+		if !rv.IsNil() {
+			return usable(rv.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := usable(rv.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %v", i, err)
+			}
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot convert %s: keys must be strings", rv.Type())
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := usable(iter.Value()); err != nil {
+				return fmt.Errorf("key %q: %v", iter.Key().String(), err)
+			}
+		}
+	}
+
+	return nil
+}
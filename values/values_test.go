@@ -0,0 +1,73 @@
+package values
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pdk/meh/compile"
+)
+
+func TestToGoFunctionKeepsSandbox(t *testing.T) {
+
+	program, err := compile.NewProgram("sandbox", `fn(n) { do { n = n + 1 } until n >= 100000 }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := program.Run(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := program.Top()
+	top.SetFuel(1000)
+
+	spin, ok := ToGo(top, result).(func(args ...interface{}) (interface{}, error))
+	if !ok {
+		t.Fatalf("ToGo(function) = %T, want a Go func", ToGo(top, result))
+	}
+
+	if _, err := spin(1); !errors.Is(err, compile.ErrOutOfFuel) {
+		t.Errorf("calling a function of a fueled program: %v, want %v", err, compile.ErrOutOfFuel)
+	}
+}
+
+func TestToGoFunctionSeesNames(t *testing.T) {
+
+	program, err := compile.NewProgram("names", `fn(name) { return greeting + ", " + name }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := program.Top()
+	top.Bind("greeting", "hello")
+
+	result, err := program.Run(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	greet := ToGo(top, result).(func(args ...interface{}) (interface{}, error))
+
+	got, err := greet("meh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello, meh" {
+		t.Errorf("greet(meh) = %v, want hello, meh", got)
+	}
+}
+
+func TestFromGoLargeUint(t *testing.T) {
+
+	v, err := FromGo(uint64(1 << 63))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := compile.FromGo(uint64(1 << 63)); v != want {
+		t.Errorf("FromGo(1<<63) = %#v, want %#v as compile.FromGo", v, want)
+	}
+	if v != float64(1<<63) {
+		t.Errorf("FromGo(1<<63) = %#v, want float64", v)
+	}
+}
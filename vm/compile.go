@@ -0,0 +1,438 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/diag"
+	"github.com/pdk/meh/lex"
+	"github.com/pdk/meh/parser"
+)
+
+// Chunk is the compiled code of a program or function.
+type Chunk struct {
+	code   []Instr
+	items  []lex.Item // the source of each instruction, for errors
+	consts []compile.Value
+	names  []string
+	loops  []loopInfo
+	funcs  []*Chunk       // the bodies of function literals, for String
+	calls  map[int]string // the name of the function of each call, for stacks
+}
+
+// loopInfo describes a loop: how many loops enclose it, and where its
+// condition and end are.
+type loopInfo struct {
+	depth int
+	cont  int
+	end   int
+}
+
+// compiler compiles a program or function to a Chunk.
+type compiler struct {
+	chunk *Chunk
+	loops []loopScope // the loops enclosing the code being compiled
+}
+
+type loopScope struct {
+	id    int
+	label string
+}
+
+// Compile compiles a parsed program to a Chunk.
+func Compile(node parser.Node) (*Chunk, error) {
+
+	c := &compiler{chunk: &Chunk{}}
+	if err := c.expr(node); err != nil {
+		return nil, err
+	}
+
+	return c.chunk, nil
+}
+
+// emit appends an instruction, and returns its address.
+func (c *compiler) emit(op Op, arg int, item lex.Item) int {
+	c.chunk.code = append(c.chunk.code, Instr{Op: op, Arg: arg})
+	c.chunk.items = append(c.chunk.items, item)
+	return len(c.chunk.code) - 1
+}
+
+// patch makes the jump at an address go to the next instruction.
+func (c *compiler) patch(addr int) {
+	c.chunk.code[addr].Arg = len(c.chunk.code)
+}
+
+func (c *compiler) constant(v compile.Value) int {
+	c.chunk.consts = append(c.chunk.consts, v)
+	return len(c.chunk.consts) - 1
+}
+
+func (c *compiler) name(name string) int {
+	for i, n := range c.chunk.names {
+		if n == name {
+			return i
+		}
+	}
+	c.chunk.names = append(c.chunk.names, name)
+	return len(c.chunk.names) - 1
+}
+
+// expr compiles code that pushes the value of an expression.
+func (c *compiler) expr(node parser.Node) error {
+
+	switch node.Type() {
+	case lex.LeftBrace:
+		return c.block(node)
+	case lex.Nil, lex.True, lex.False, lex.Number, lex.Regex,
+		lex.DoubleQuoteString, lex.SingleQuoteString, lex.BacktickString:
+		return c.literal(node)
+	case lex.Ident:
+		c.emit(OpGet, c.name(node.Item.Value), node.Item)
+		return nil
+	case lex.Assign:
+		return c.assign(node)
+	case lex.Plus, lex.Minus, lex.Mult, lex.Div, lex.Modulo,
+		lex.Equal, lex.NotEqual, lex.Greater, lex.GreaterOrEqual, lex.Less, lex.LessOrEqual:
+		return c.operator(node)
+	case lex.And:
+		return c.logic(node, OpAnd)
+	case lex.Or:
+		return c.logic(node, OpOr)
+	case lex.Is:
+		return c.is(node)
+	case lex.Dot:
+		if err := c.expr(node.Children[0]); err != nil {
+			return err
+		}
+		c.emit(OpDot, c.name(node.Children[1].Item.Value), node.Item)
+		return nil
+	case lex.FuncApply:
+		return c.call(node)
+	case lex.Function:
+		return c.function(node)
+	case lex.Return:
+		return c.ret(node)
+	case lex.Break:
+		return c.flow(node, OpBreak, compile.NewBreak())
+	case lex.Continue:
+		return c.flow(node, OpContinue, compile.NewContinue())
+	case lex.Until:
+		return c.doUntil(node)
+	}
+
+	if _, ok := compile.CustomOperator(node.Type()); ok {
+		return c.operator(node)
+	}
+
+	return node.Error(fmt.Errorf("cannot compile %s", node))
+}
+
+// block compiles the statements of a block, and wraps the value of the last
+// in a tuple.
+func (c *compiler) block(node parser.Node) error {
+
+	if len(node.Children) == 0 {
+		c.emit(OpConst, c.constant(nil), node.Item)
+	}
+
+	// compile every statement, even after one fails, so that all the
+	// errors are reported together.
+	var errs diag.List
+	for i, stmt := range node.Children {
+		if i > 0 {
+			c.emit(OpPop, 0, stmt.Item)
+		}
+		c.emit(OpStmt, 0, stmt.Item)
+		if err := c.expr(stmt); err != nil {
+			errs = errs.Append(err, diag.Compile)
+		}
+	}
+	errs = append(errs, compile.ArityErrors(node.Children)...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	c.emit(OpTuple, 0, node.Item)
+
+	return nil
+}
+
+// literal compiles a literal value to a constant, letting package compile
+// decide what the literal means.
+func (c *compiler) literal(node parser.Node) error {
+
+	e, err := compile.Compile(node)
+	if err != nil {
+		return err
+	}
+
+	v, err := e(compile.NewContext(nil))
+	if err != nil {
+		return err
+	}
+
+	c.emit(OpConst, c.constant(v), node.Item)
+
+	return nil
+}
+
+func (c *compiler) assign(node parser.Node) error {
+
+	if len(node.Children) != 2 {
+		return node.Error(fmt.Errorf("assignment requires exactly 2 children"))
+	}
+
+	lhs := node.Children[0]
+	if !lhs.Type().Match(lex.Ident) {
+		return node.Error(fmt.Errorf("assignment requires an identifier"))
+	}
+
+	if err := c.expr(node.Children[1]); err != nil {
+		return err
+	}
+
+	c.emit(OpSet, c.name(lhs.Item.Value), node.Item)
+
+	return nil
+}
+
+func (c *compiler) operator(node parser.Node) error {
+
+	for _, operand := range node.Children {
+		if err := c.expr(operand); err != nil {
+			return err
+		}
+	}
+
+	c.emit(OpOperator, int(node.Type()), node.Item)
+
+	return nil
+}
+
+func (c *compiler) logic(node parser.Node, op Op) error {
+
+	if err := c.expr(node.Children[0]); err != nil {
+		return err
+	}
+
+	jump := c.emit(op, 0, node.Item)
+
+	if err := c.expr(node.Children[1]); err != nil {
+		return err
+	}
+
+	c.emit(OpLogic, 0, node.Item)
+	c.patch(jump)
+
+	return nil
+}
+
+func (c *compiler) is(node parser.Node) error {
+
+	name := node.Children[1].Item.Value
+	if !compile.IsTypeName(name) {
+		return node.Error(fmt.Errorf("unknown type name %q", name))
+	}
+
+	if err := c.expr(node.Children[0]); err != nil {
+		return err
+	}
+
+	c.emit(OpIs, c.name(name), node.Item)
+
+	return nil
+}
+
+func (c *compiler) call(node parser.Node) error {
+
+	if err := c.expr(node.Children[0]); err != nil {
+		return err
+	}
+
+	args := node.Children[1].Children
+	for _, a := range args {
+		if err := c.expr(a); err != nil {
+			return err
+		}
+	}
+
+	pc := c.emit(OpCall, len(args), node.Item)
+	if c.chunk.calls == nil {
+		c.chunk.calls = make(map[int]string)
+	}
+	c.chunk.calls[pc] = compile.CallName(node)
+
+	return nil
+}
+
+// function compiles a function literal. Functions are dynamically scoped, so
+// a function value captures nothing, and is compiled to a constant.
+func (c *compiler) function(node parser.Node) error {
+
+	// a third child is the return type annotation, which is not enforced at
+	// runtime.
+	if len(node.Children) != 2 && len(node.Children) != 3 {
+		return node.Error(fmt.Errorf("malformed function: requires param list & body"))
+	}
+
+	params, err := parameterNames(node.Children[0])
+	if err != nil {
+		return err
+	}
+
+	body := node.Children[1]
+	if !body.Type().Match(lex.LeftBrace) {
+		return node.Error(fmt.Errorf("malformed function: requires block"))
+	}
+
+	chunk, err := Compile(body)
+	if err != nil {
+		return err
+	}
+
+	c.chunk.funcs = append(c.chunk.funcs, chunk)
+	c.emit(OpConst, c.constant(chunk.function(params)), node.Item)
+
+	return nil
+}
+
+func parameterNames(node parser.Node) ([]string, error) {
+
+	if !node.Type().Match(lex.LeftParen) {
+		return nil, node.Error(fmt.Errorf("malformed function, parameter list required"))
+	}
+
+	names := []string{}
+	for _, next := range node.Children {
+		// drop type annotations, e.g. `a: int`
+		if next.Type().Match(lex.Colon) && len(next.Children) == 2 {
+			next = next.Children[0]
+		}
+		if !next.Type().Match(lex.Ident) {
+			return nil, next.Error(fmt.Errorf("malformed function, parameter list must be identifiers"))
+		}
+		names = append(names, next.Item.Value)
+	}
+
+	return names, nil
+}
+
+func (c *compiler) ret(node parser.Node) error {
+
+	if len(node.Children) == 0 {
+		c.emit(OpConst, c.constant(nil), node.Item)
+	} else if err := c.expr(node.Children[0]); err != nil {
+		return err
+	}
+
+	c.emit(OpReturn, 0, node.Item)
+
+	return nil
+}
+
+// flow compiles a break or continue. One that targets a loop of the chunk
+// jumps; an unlabeled one outside a loop is returned as a change of flow, as
+// in package compile, and a labeled one no loop has the label of is an
+// error, as a break cannot leave the chunk of a function.
+func (c *compiler) flow(node parser.Node, op Op, unlabeled compile.Value) error {
+
+	label := ""
+	if len(node.Children) > 0 {
+		label = node.Children[0].Item.Value
+	}
+
+	for i := len(c.loops) - 1; i >= 0; i-- {
+		if label == "" || c.loops[i].label == label {
+			c.emit(op, c.loops[i].id, node.Item)
+			return nil
+		}
+	}
+
+	if label != "" {
+		return node.Error(fmt.Errorf("%s to unknown label %q", node.Item.Value, label))
+	}
+
+	c.emit(OpFlow, c.constant(unlabeled), node.Item)
+
+	return nil
+}
+
+// doUntil compiles `do { body } until cond`. The value of the loop is the
+// value of the body the last time it completed, which is kept on the stack.
+func (c *compiler) doUntil(node parser.Node) error {
+
+	do := node.Children[0]
+	if !do.Type().Match(lex.Do) || len(do.Children) == 0 {
+		return node.Error(fmt.Errorf("until requires a preceding do block"))
+	}
+
+	label := ""
+	if len(do.Children) > 1 {
+		label = do.Children[1].Item.Value
+	}
+
+	id := len(c.chunk.loops)
+	c.chunk.loops = append(c.chunk.loops, loopInfo{depth: len(c.loops)})
+
+	c.emit(OpConst, c.constant(nil), node.Item)
+	c.emit(OpLoop, id, node.Item)
+	top := len(c.chunk.code)
+
+	c.loops = append(c.loops, loopScope{id: id, label: label})
+	err := c.expr(do.Children[0])
+	c.loops = c.loops[:len(c.loops)-1]
+	if err != nil {
+		return err
+	}
+
+	c.emit(OpKeep, 0, node.Item)
+	c.chunk.loops[id].cont = len(c.chunk.code)
+
+	if err := c.expr(node.Children[1]); err != nil {
+		return err
+	}
+
+	c.emit(OpJumpIfFalse, top, node.Item)
+	c.chunk.loops[id].end = c.emit(OpEndLoop, id, node.Item)
+
+	return nil
+}
+
+// String disassembles the chunk, and the functions it contains.
+func (c *Chunk) String() string {
+
+	var b strings.Builder
+
+	for pc, in := range c.code {
+		fmt.Fprintf(&b, "%04d %4d:%-3d %-13s", pc, c.items[pc].Line, c.items[pc].Column, in.Op)
+
+		switch in.Op {
+		case OpConst, OpFlow:
+			fmt.Fprintf(&b, " %d (%s)", in.Arg, describe(c.consts[in.Arg]))
+		case OpGet, OpSet, OpIs, OpDot:
+			fmt.Fprintf(&b, " %d (%s)", in.Arg, c.names[in.Arg])
+		case OpOperator:
+			fmt.Fprintf(&b, " %s", lex.Type(in.Arg))
+		case OpPop, OpLogic, OpTuple, OpStmt, OpKeep, OpReturn:
+		default:
+			fmt.Fprintf(&b, " %d", in.Arg)
+		}
+
+		b.WriteString("\n")
+	}
+
+	for i, f := range c.funcs {
+		fmt.Fprintf(&b, "\nfn %d:\n%s", i, f)
+	}
+
+	return b.String()
+}
+
+func describe(v compile.Value) string {
+	if compile.TypeName(v) == "fn" {
+		return "fn"
+	}
+	return fmt.Sprintf("%s %v", compile.TypeName(v), v)
+}
@@ -0,0 +1,103 @@
+package vm
+
+import "fmt"
+
+// Op is a VM operation.
+type Op byte
+
+// The operations of the VM. Each is described with its effect on the stack.
+const (
+	// OpConst pushes the constant Arg.
+	OpConst Op = iota
+	// OpPop drops the top value.
+	OpPop
+	// OpGet pushes the value of the name Arg.
+	OpGet
+	// OpSet assigns the top value to the name Arg, leaving it on the stack.
+	OpSet
+	// OpOperator pops two values, and pushes the result of applying the
+	// operator (a lex.Type) Arg to them.
+	OpOperator
+	// OpIs pops a value, and pushes whether its type is named by the name
+	// Arg.
+	OpIs
+	// OpDot pops a map or record, and pushes its member named by the name
+	// Arg.
+	OpDot
+	// OpCall pops Arg arguments and a function, and pushes the result of
+	// calling the function.
+	OpCall
+	// OpAnd jumps to Arg, leaving the top value as the result, if it is false,
+	// and otherwise pops it.
+	OpAnd
+	// OpOr jumps to Arg, leaving the top value as the result, if it is true,
+	// and otherwise pops it.
+	OpOr
+	// OpLogic replaces the top value with the result of a && or ||
+	// expression that it decided.
+	OpLogic
+	// OpJump jumps to Arg.
+	OpJump
+	// OpJumpIfFalse pops a value, and jumps to Arg if it is false.
+	OpJumpIfFalse
+	// OpTuple replaces the top value with the (true, value) tuple that is
+	// the value of a block.
+	OpTuple
+	// OpStmt starts a statement, checking if the run was interrupted.
+	OpStmt
+	// OpLoop starts the loop Arg, noting the stack height.
+	OpLoop
+	// OpEndLoop ends the loop Arg.
+	OpEndLoop
+	// OpBreak unwinds the stack to the height noted by the loop Arg, and
+	// jumps to its end.
+	OpBreak
+	// OpContinue unwinds the stack to the height noted by the loop Arg, and
+	// jumps to its condition.
+	OpContinue
+	// OpKeep replaces the second value with the top value, which it pops.
+	OpKeep
+	// OpReturn pops a value, and returns it from the function.
+	OpReturn
+	// OpFlow returns the constant Arg, a change of flow that the function
+	// cannot handle, e.g. a break outside of a loop.
+	OpFlow
+)
+
+var opNames = [...]string{
+	OpConst:       "CONST",
+	OpPop:         "POP",
+	OpGet:         "GET",
+	OpSet:         "SET",
+	OpOperator:    "OPERATOR",
+	OpIs:          "IS",
+	OpDot:         "DOT",
+	OpCall:        "CALL",
+	OpAnd:         "AND",
+	OpOr:          "OR",
+	OpLogic:       "LOGIC",
+	OpJump:        "JUMP",
+	OpJumpIfFalse: "JUMP_IF_FALSE",
+	OpTuple:       "TUPLE",
+	OpStmt:        "STMT",
+	OpLoop:        "LOOP",
+	OpEndLoop:     "END_LOOP",
+	OpBreak:       "BREAK",
+	OpContinue:    "CONTINUE",
+	OpKeep:        "KEEP",
+	OpReturn:      "RETURN",
+	OpFlow:        "FLOW",
+}
+
+func (op Op) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("Op(%d)", op)
+}
+
+// Instr is an instruction: an operation and its argument.
+type Instr struct {
+	Op  Op
+	Arg int
+}
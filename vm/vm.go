@@ -0,0 +1,216 @@
+// Package vm runs scripts on a stack-based virtual machine, as an
+// alternative to the tree of closures built by package compile. Programs are
+// compiled to a compact list of instructions, which a single loop executes.
+// The VM shares package compile's values, contexts, and builtins, so that
+// functions compiled by either can call the other, and the settings of a
+// context (fuel, limits, cancellation) apply to both.
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/lex"
+)
+
+// Run runs the chunk in a context, and returns its value, as a compile.Expr
+// for the same program would.
+func (c *Chunk) Run(ctx *compile.Context) (compile.Value, error) {
+
+	stack := make([]compile.Value, 0, 16)
+	frames := []int{} // the stack height at the start of each enclosing loop
+
+	for pc := 0; pc < len(c.code); pc++ {
+
+		if err := ctx.UseFuel(); err != nil {
+			return nil, c.errorAt(pc, err)
+		}
+
+		in := c.code[pc]
+		top := len(stack) - 1
+
+		switch in.Op {
+		case OpConst:
+			stack = append(stack, c.consts[in.Arg])
+
+		case OpPop:
+			stack = stack[:top]
+
+		case OpGet:
+			stack = append(stack, ctx.Get(c.names[in.Arg]))
+
+		case OpSet:
+			if _, err := ctx.Set(c.names[in.Arg], stack[top]); err != nil {
+				return nil, err
+			}
+
+		case OpOperator:
+			lVal, rVal := stack[top-1], stack[top]
+			result, err := operate(ctx, lex.Type(in.Arg), lVal, rVal)
+			if err == nil {
+				err = ctx.Account(result)
+			}
+			if err != nil {
+				return nil, c.positioned(pc, err)
+			}
+			stack = append(stack[:top-1], result)
+
+		case OpIs:
+			stack[top] = compile.TypeName(stack[top]) == c.names[in.Arg]
+
+		case OpDot:
+			v, err := compile.Member(stack[top], c.names[in.Arg])
+			if err != nil {
+				return nil, c.errorAt(pc, err)
+			}
+			stack[top] = v
+
+		case OpCall:
+			fnAt := top - in.Arg
+			fn := stack[fnAt]
+			if _, ok := compile.Callable(fn); !ok {
+				return nil, c.errorAt(pc, fmt.Errorf("cannot invoke non-function: %T %v", fn, fn))
+			}
+
+			args := append([]compile.Value{}, stack[fnAt+1:]...)
+			call, err := ctx.EnterCall(c.calls[pc], c.items[pc])
+			if err != nil {
+				return nil, c.errorAt(pc, err)
+			}
+			res, err := call.Call(fn, args...)
+			if err == nil {
+				err = ctx.Account(res)
+			}
+			if err != nil {
+				err = call.Traced(c.positioned(pc, err))
+				call.ExitCall()
+				return nil, err
+			}
+			call.ExitCall()
+			stack = append(stack[:fnAt], res)
+
+		case OpAnd:
+			if !ctx.IsTruthy(stack[top]) {
+				stack[top] = ctx.LogicResult(stack[top])
+				pc = in.Arg - 1
+			} else {
+				stack = stack[:top]
+			}
+
+		case OpOr:
+			if ctx.IsTruthy(stack[top]) {
+				stack[top] = ctx.LogicResult(stack[top])
+				pc = in.Arg - 1
+			} else {
+				stack = stack[:top]
+			}
+
+		case OpLogic:
+			stack[top] = ctx.LogicResult(stack[top])
+
+		case OpJump:
+			pc = in.Arg - 1
+
+		case OpJumpIfFalse:
+			cond := stack[top]
+			stack = stack[:top]
+			if !ctx.IsTruthy(cond) {
+				pc = in.Arg - 1
+			}
+
+		case OpTuple:
+			stack[top] = compile.NewTuple(true, stack[top])
+
+		case OpStmt:
+			if err := ctx.Interrupted(); err != nil {
+				return nil, c.errorAt(pc, err)
+			}
+
+		case OpLoop:
+			depth := c.loops[in.Arg].depth
+			frames = append(frames[:depth], len(stack))
+
+		case OpEndLoop:
+			frames = frames[:c.loops[in.Arg].depth]
+
+		case OpBreak:
+			loop := c.loops[in.Arg]
+			stack = stack[:frames[loop.depth]]
+			pc = loop.end - 1
+
+		case OpContinue:
+			loop := c.loops[in.Arg]
+			stack = stack[:frames[loop.depth]]
+			frames = frames[:loop.depth+1]
+			pc = loop.cont - 1
+
+		case OpKeep:
+			stack[top-1] = stack[top]
+			stack = stack[:top]
+
+		case OpReturn:
+			return compile.NewReturn(stack[top]), nil
+
+		case OpFlow:
+			return c.consts[in.Arg], nil
+
+		default:
+			return nil, c.errorAt(pc, fmt.Errorf("unknown operation %s", in.Op))
+		}
+	}
+
+	return stack[len(stack)-1], nil
+}
+
+// operate applies a built-in or registered operator to two values.
+func operate(ctx *compile.Context, op lex.Type, lVal, rVal compile.Value) (compile.Value, error) {
+
+	if handler, ok := compile.CustomOperator(op); ok {
+		return handler(ctx, lVal, rVal)
+	}
+
+	return compile.Operate(op, lVal, rVal)
+}
+
+// function returns a function value that runs the chunk, as the body of a
+// function with the given parameters.
+func (c *Chunk) function(params []string) func(*compile.Context, ...compile.Value) (compile.Value, error) {
+	return func(ctx *compile.Context, vals ...compile.Value) (compile.Value, error) {
+
+		if len(vals) != len(params) {
+			return nil, fmt.Errorf("failed to apply function: received %d arguments for %d parameters", len(vals), len(params))
+		}
+
+		funcCtx := compile.NewContext(ctx)
+		for i, p := range params {
+			if _, err := funcCtx.Set(p, vals[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		return c.Run(funcCtx)
+	}
+}
+
+// errorAt gives an error the position of the instruction at pc.
+func (c *Chunk) errorAt(pc int, err error) error {
+	return c.items[pc].Error(err)
+}
+
+// positioned gives an error the position of the instruction at pc, unless
+// the error already carries a position, or is a script's exit.
+func (c *Chunk) positioned(pc int, err error) error {
+
+	var ierr lex.ItemError
+	if errors.As(err, &ierr) {
+		return err
+	}
+
+	var exit compile.Exit
+	if errors.As(err, &exit) {
+		return err
+	}
+
+	return c.errorAt(pc, err)
+}
@@ -0,0 +1,208 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pdk/meh/compile"
+	"github.com/pdk/meh/parser"
+)
+
+// TestRuntimeErrorParity checks that the VM reports the errors of a run as
+// the tree of closures does, at the same positions.
+func TestRuntimeErrorParity(t *testing.T) {
+
+	for _, src := range []string{
+		"x = 1\ny = 2\ny + x(2)\n",
+		"f = \"f\"\nf()\n",
+		"1 + \"a\"\n",
+		"m = dict()\nm.missing.x\n",
+	} {
+		want := runTree(t, src)
+		got := runVM(t, src)
+
+		if want == nil || got == nil {
+			t.Errorf("%q: tree error %v, VM error %v", src, want, got)
+			continue
+		}
+		if got.Error() != want.Error() {
+			t.Errorf("%q: VM error\n\t%v\nwant\n\t%v", src, got, want)
+		}
+	}
+}
+
+// TestEngineParity runs scripts on the VM and the tree of closures, and
+// checks that both produce the same value, or the same error.
+func TestEngineParity(t *testing.T) {
+
+	semantics, err := ioutil.ReadFile("../ex/semantics.meh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []string{
+		string(semantics),
+		"1 / 0\n",
+		"7 % 0\n",
+		"7.0 / 0 > 1\n",
+		"x = 0\nouter: do { do { x = x + 1; continue outer } until false } until x > 3\nx\n",
+		"x = 0\nouter: do { do { break outer } until false; x = 1 } until true\nx\n",
+		"i = 0\ndo { i = i + 1; i == 2 && break } until i > 5\n",
+		"f = fn(n) { do { n == 3 && return n * 2; n = n + 1 } until false }\nf(0)\n",
+		"f = fn() { return }\nf()\n",
+		"return 5\n6\n",
+		"error(\"failed\")\n",
+		"f = fn(n) { n == 0 && error(\"bottom\"); f(n - 1) }\nf(3)\n",
+		"f = fn(n) { f(n + 1) }\nf(0)\n",
+		"f = fn(a, b) { a + b }\ng = f\ng(1)\n",
+		"x = 5\nf = fn() { x = x + 1; x }\nlist(f(), x)\n",
+	} {
+		want, wantErr := evalTree(t, src)
+		got, gotErr := evalVM(t, src)
+
+		if (wantErr == nil) != (gotErr == nil) || (wantErr != nil && gotErr.Error() != wantErr.Error()) {
+			t.Errorf("%q: VM error\n\t%v\nwant\n\t%v", src, gotErr, wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: VM value %v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestCallOfCall(t *testing.T) {
+
+	for _, c := range []struct {
+		src  string
+		want compile.Value
+	}{
+		{"mk = fn(a) { fn(b) { b * 3 } }\nmk(1)(2)\n", int64(6)},
+		{"mk = fn(a) { return fn(b) { b * 3 } }\nmk(1)(2)\n", int64(6)},
+		{"mk = fn() { fn() { fn(c) { c * 2 } } }\nmk()()(3)\n", int64(6)},
+		{"mk = fn() { fn(x) { x + 1 } }\nmap(list(1, 2), mk())\n", []compile.Value{int64(2), int64(3)}},
+	} {
+		for engine, eval := range map[string]func(*testing.T, string) (compile.Value, error){
+			"tree": evalTree,
+			"VM":   evalVM,
+		} {
+			got, err := eval(t, c.src)
+			if err != nil {
+				t.Errorf("%q: %s: %v", c.src, engine, err)
+				continue
+			}
+			if got = compile.Result(got); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%q: %s value %v, want %v", c.src, engine, got, c.want)
+			}
+		}
+	}
+}
+
+func TestGoContextStops(t *testing.T) {
+
+	for _, src := range []string{
+		"do { x = 1 } until false\n",
+		"sleep(60000)\n",
+		"f = fn() { do { x = 1 } until false }\nf()\n",
+	} {
+		for engine, run := range map[string]func(*compile.Context, parser.Node) error{
+			"tree": func(ctx *compile.Context, node parser.Node) error {
+				expr, err := compile.Compile(node)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = expr(ctx)
+				return err
+			},
+			"VM": func(ctx *compile.Context, node parser.Node) error {
+				chunk, err := Compile(node)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = chunk.Run(ctx)
+				return err
+			},
+		} {
+			c, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			ctx := compile.NewContext(compile.NewTopContext())
+			ctx.SetGoContext(c)
+
+			start := time.Now()
+			err := run(ctx, parse(t, src))
+			cancel()
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("%q: %s: got %v, want context.DeadlineExceeded", src, engine, err)
+			}
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("%q: %s: stopped after %v", src, engine, d)
+			}
+
+			c, cancel = context.WithCancel(context.Background())
+			cancel()
+			ctx = compile.NewContext(compile.NewTopContext())
+			ctx.SetGoContext(c)
+
+			if err := run(ctx, parse(t, src)); !errors.Is(err, context.Canceled) {
+				t.Errorf("%q: %s: got %v, want context.Canceled", src, engine, err)
+			}
+		}
+	}
+}
+
+func runTree(t *testing.T, src string) error {
+	_, err := evalTree(t, src)
+	return err
+}
+
+func runVM(t *testing.T, src string) error {
+	_, err := evalVM(t, src)
+	return err
+}
+
+func evalTree(t *testing.T, src string) (compile.Value, error) {
+
+	expr, err := compile.Compile(parse(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := expr(compile.NewTopContext())
+	return compile.Result(v), err
+}
+
+func evalVM(t *testing.T, src string) (compile.Value, error) {
+
+	chunk, err := Compile(parse(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := chunk.Run(compile.NewTopContext())
+	return compile.Result(v), err
+}
+
+func parse(t *testing.T, src string) parser.Node {
+
+	node, errs := parser.NewFromString("parity.meh", src).Parse()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	return node
+}
+
+func TestUnknownLabel(t *testing.T) {
+
+	for _, src := range []string{
+		"x = 0\ndo { do { break otuer } until false; x = 1 } until true\n",
+		"outer: do { f = fn() { continue outer } } until true\n",
+	} {
+		if _, err := Compile(parse(t, src)); err == nil {
+			t.Errorf("%q: compiled", src)
+		}
+	}
+}